@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/byteair"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+// The count of items included in one "Write" request
+// is better to less than 10000 when upload data
+const maxWriteDataItems = 10000
+
+// BatchWriter accepts the data of each topic one by one,
+// and writes them in batches by "WriteData" through RequestHelper
+type BatchWriter struct {
+	client        byteair.Client
+	requestHelper *common.RequestHelper
+	config        *common.BatchWriterConfig
+
+	lock    sync.Mutex
+	writers map[string]*common.BatchWriter
+}
+
+func NewBatchWriter(client byteair.Client, requestHelper *common.RequestHelper,
+	config *common.BatchWriterConfig) *BatchWriter {
+	return &BatchWriter{
+		client:        client,
+		requestHelper: requestHelper,
+		config:        config,
+		writers:       make(map[string]*common.BatchWriter),
+	}
+}
+
+// WriteData adds the data to the batch of topic, and writes the batch if it is full
+func (w *BatchWriter) WriteData(topic string, dataList ...map[string]interface{}) error {
+	records := make([]interface{}, len(dataList))
+	for i, data := range dataList {
+		records[i] = data
+	}
+	return w.topicWriter(topic).Write(records...)
+}
+
+func (w *BatchWriter) topicWriter(topic string) *common.BatchWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	writer, ok := w.writers[topic]
+	if !ok {
+		writer = common.NewBatchWriter(common.APIWriteData, maxWriteDataItems, w.config,
+			func(records []interface{}) error {
+				return w.writeData(topic, records)
+			})
+		w.writers[topic] = writer
+	}
+	return writer
+}
+
+func (w *BatchWriter) writeData(topic string, records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		dataList := make([]map[string]interface{}, len(records))
+		for i, record := range records {
+			dataList[i] = record.(map[string]interface{})
+		}
+		return w.client.WriteData(dataList, topic, opts...)
+	}
+	opts := streamingWriteOptions()
+	// The data failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteData).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// Flush writes the data in batches of all the topics immediately
+func (w *BatchWriter) Flush() error {
+	for _, writer := range w.topicWriters() {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the remaining data, and stops accepting new data
+func (w *BatchWriter) Close() error {
+	var firstErr error
+	for _, writer := range w.topicWriters() {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (w *BatchWriter) topicWriters() []*common.BatchWriter {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	writers := make([]*common.BatchWriter, 0, len(w.writers))
+	for _, writer := range w.writers {
+		writers = append(writers, writer)
+	}
+	return writers
+}
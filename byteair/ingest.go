@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+// The count of batches written at the same time by default
+const defaultIngestConcurrency = 4
+
+// ingest writes the data in a CSV, JSONL or Parquet file, e.g.
+// "go run . ingest --topic user --file users.parquet --date 2021-11-01".
+// Each row is written as a map keyed by the column names, so the columns
+// should be the fields of the topic, the nested groups of Parquet are kept as
+// nested objects. The Parquet file is read lazily, and at most concurrency+1
+// batches are kept in memory, so that the history data with hundreds of
+// millions of rows can be synced by "history_sync" stage
+func ingest(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of data, such as user, item and behavior")
+	file := flags.String("file", "", "the path of the data file")
+	format := flags.String("format", "", "csv, jsonl or parquet, decided by the extension of file by default")
+	stage := flags.String("stage", StageHistorySync, "the stage of data, such as history_sync and incremental_sync_daily")
+	date := flags.String("date", "", "the date of data, e.g. 2021-11-01, default is now, or the date recorded in the checkpoint")
+	batchSize := flags.Int("batch-size", maxWriteDataItems, "the count of data written by one request")
+	concurrency := flags.Int("concurrency", defaultIngestConcurrency, "the count of requests sent at the same time")
+	checkpointPath := flags.String("checkpoint", "", "the path of the checkpoint file, the restarted run continues from where it stopped")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *topic == "" || *file == "" {
+		return fmt.Errorf("topic and file are required")
+	}
+	if *date != "" {
+		if _, err := parseDataDate(*date); err != nil {
+			return err
+		}
+	}
+	reader, err := common.OpenRowReader(*file, *format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	var checkpoint *common.Checkpoint
+	if *checkpointPath != "" {
+		if checkpoint, err = common.OpenCheckpoint(*checkpointPath, *file); err != nil {
+			return err
+		}
+		defer checkpoint.Close()
+	}
+	// The restarted run writes the data with the date of the run before
+	recordedDate, err := checkpoint.KeepDate(*date)
+	if err != nil {
+		return err
+	}
+	dataDate, err := parseDataDate(recordedDate)
+	if err != nil {
+		return err
+	}
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		dataList := make([]map[string]interface{}, len(records))
+		for i, record := range records {
+			dataList[i] = record.(map[string]interface{})
+		}
+		return client.WriteData(dataList, *topic, opts...)
+	}
+	opts := []option.Option{
+		option.WithStage(*stage),
+		option.WithDataDate(dataDate),
+		option.WithTimeout(DefaultImportTimeout),
+	}
+	helper := requestHelper.ForAPI(common.APIWriteData)
+	summary, err := common.Ingest(reader, &common.IngestConfig{
+		API:          common.APIWriteData,
+		BatchSize:    *batchSize,
+		MaxBatchSize: maxWriteDataItems,
+		Concurrency:  *concurrency,
+		Checkpoint:   checkpoint,
+		Convert: func(row *common.Row) (interface{}, error) {
+			return row.Fields, nil
+		},
+		Write: func(batch *common.IngestBatch, onFailure common.ItemFailureHandler) error {
+			// The data failing for server side reason are resubmitted,
+			// and the ones failing permanently are reported in the summary
+			return helper.DoWriteWithResubmit(call, batch.Records, batch.RequestOpts(opts), DefaultRetryTimes, onFailure)
+		},
+	})
+	summary.Log(common.APIWriteData)
+	if err != nil {
+		logs.Error("[Ingest] read %s fail, msg:%s", *file, err.Error())
+	}
+	return err
+}
+
+// parseDataDate parses the date of data, such as "2021-11-01",
+// or the time in RFC3339 which is the default date of checkpoint
+func parseDataDate(date string) (time.Time, error) {
+	if dataDate, err := time.Parse("2006-01-02", date); err == nil {
+		return dataDate, nil
+	}
+	if dataDate, err := time.Parse(time.RFC3339, date); err == nil {
+		return dataDate, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date:%s, e.g. 2021-11-01", date)
+}
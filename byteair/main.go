@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -10,7 +11,6 @@ import (
 	"github.com/byteplus-sdk/sdk-go/byteair"
 	bp "github.com/byteplus-sdk/sdk-go/byteair/protocol"
 	cp "github.com/byteplus-sdk/sdk-go/common/protocol"
-	"github.com/byteplus-sdk/sdk-go/core"
 	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/google/uuid"
@@ -38,20 +38,6 @@ var (
 )
 
 const (
-	/*
-	 * 租户相关信息
-	 */
-	// AK 在推荐平台->密钥管理生成的AK，用于鉴权
-	AK = "xxxxxxxxxxxx"
-	// SK 在推荐平台->密钥管理生成的SK，用于鉴权
-	SK = "xxxxxxxxxxxx"
-
-	// TenantId 火山引擎申请的账号id/租户id(tenant_id)，如"2100021"
-	TenantId = "xxxxxxxxxxxx"
-
-	// ProjectId 个性化推荐服务新建的项目id(project_id)，如"1231314"
-	ProjectId = "xxxxxxxxxxx"
-
 	/*
 	 * stage枚举值，与推荐平台四种同步阶段相对应
 	 */
@@ -82,23 +68,55 @@ const (
 
 func init() {
 	logs.Level = logs.LevelDebug
-	client, _ = (&byteair.ClientBuilder{}).
-		TenantId(TenantId). // 必传，租户id
-		ProjectId(ProjectId). // 必传，项目id
-		AK(AK). // 必传，密钥AK，请填写自己账户的AK
-		SK(SK). // 必传，密钥SK，请填写自己账户的SK
-		Region(core.RegionAirCn). // 必传，必须填core.RegionAir，默认使用byteair-api-cn1.snssdk.com为host
-		Build()
-	requestHelper = &common.RequestHelper{Client: client}
+	// 租户相关信息(tenant_id、project_id、ak、sk)从配置文件和环境变量读取，环境变量优先，例如：
+	// "BYTEPLUS_CONFIG=config.yaml BYTEPLUS_PROFILE=staging go run ."，详见common.ConfigLoader
+	// 设置了环境变量BYTEPLUS_MOCK_HOST时，请求发往本地的mock server，用于离线调试，例如：
+	// 先执行"go run ./mockserver/cmd -vertical byteair"，再执行"BYTEPLUS_MOCK_HOST=127.0.0.1:8080 go run ."
+	config, err := common.LoadClientConfig(common.VerticalByteAir)
+	if err != nil {
+		logs.Error("[Init] load client config fail, msg:%s", err.Error())
+		os.Exit(1)
+	}
+	// region默认为air_cn，即使用byteair-api-cn1.snssdk.com为host
+	client, _ = config.ByteAirClientBuilder().Build()
+	// Limit the QPS of each api on client side to avoid exceeding the quota,
+	// the limits are shared by all the requests sent by requestHelper.
+	// Please adjust them according to the quota of your account
+	rateLimiters := common.NewRateLimiterGroup(map[string]*common.RateLimiterConfig{
+		common.APIWriteData: {QPS: 50},
+		common.APIDone:      {QPS: 1},
+		common.APIPredict:   {QPS: 100},
+		common.APICallback:  {QPS: 100},
+	})
+	requestHelper = &common.RequestHelper{Client: client, RateLimiters: rateLimiters}
 }
 
 /**
  * 下面example请求中使用的是demo的参数，可能无法直接请求通过，
- * 需要替换constant.go中相关参数为真实参数
+ * 需要在配置文件或环境变量中填写真实的租户相关信息
  */
 func main() {
+	// 重新提交死信文件中失败的请求，e.g. "go run . replay dead_letters.jsonl"
+	if len(os.Args) == 3 && os.Args[1] == "replay" {
+		replayDeadLetters(os.Args[2])
+		client.Release()
+		return
+	}
+	// 上传CSV、JSONL或Parquet文件中的数据，用于历史数据同步，
+	// e.g. "go run . ingest --topic user --file users.parquet --date 2021-11-01"
+	if len(os.Args) > 1 && os.Args[1] == "ingest" {
+		err := ingest(os.Args[2:])
+		client.Release()
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 实时数据上传
 	writeDataExample()
+	// 逐条写入数据，攒批上传
+	batchWriteDataExample()
 
 	// 标识天级离线数据上传完成
 	doneExample()
@@ -130,7 +148,7 @@ func writeDataExample() {
 	call := func(dataList interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.WriteData(dataList.([]map[string]interface{}), topic, opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, dataList, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIWriteData).DoWithRetry(call, dataList, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("[WriteData] occur error, msg:%s", err.Error())
 		return
@@ -145,6 +163,26 @@ func writeDataExample() {
 		response.GetStatus(), response.GetErrors())
 }
 
+// 攒批数据上传example
+func batchWriteDataExample() {
+	// 逐条写入的数据按topic攒批上传，攒满或等待1秒后发送
+	batchWriter := NewBatchWriter(client, requestHelper, &common.BatchWriterConfig{
+		Linger: time.Second,
+	})
+	for _, data := range mockDataList(10) {
+		if err := batchWriter.WriteData(TopicUser, data); err != nil {
+			logs.Error("[BatchWriteData] occur error, msg:%s", err.Error())
+			return
+		}
+	}
+	// 退出前需上传剩余的数据
+	if err := batchWriter.Close(); err != nil {
+		logs.Error("[BatchWriteData] occur error, msg:%s", err.Error())
+		return
+	}
+	logs.Info("[BatchWriteData] success")
+}
+
 // 实时数据同步write参数构造，需要传入日期，e.g. 2021-10-01
 func streamingWriteOptions() []option.Option {
 	//customHeaders := map[string]string{}
@@ -193,7 +231,7 @@ func doneExample() {
 	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.Done(dateList, topic, opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, dateList, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIDone).DoWithRetry(call, dateList, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("[Done] occur error, msg:%s", err.Error())
 		return
@@ -256,6 +294,8 @@ func recommendExample() {
 	// who according to tenant's situation
 	// The `scene` is provided by ByteDance,
 	predictOpts = append(predictOpts, option.WithScene(scene))
+	// Wait for the quota of predict, it never fails without deadline
+	_ = requestHelper.RateLimiters.Wait(context.Background(), common.APIPredict)
 	predictResponse, err := client.Predict(predictRequest, predictOpts...)
 	if err != nil {
 		logs.Error("predict occur error, msg:%s", err.Error())
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/byteair/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+// The stage of the real-time data, the data of the other stages, such as
+// "pre_sync", "history_sync" and "incremental_sync_daily", need the date
+const stageIncrementalSyncStreaming = "incremental_sync_streaming"
+
+func newByteAirVertical(config *common.ClientConfig) (*vertical, error) {
+	client, err := config.ByteAirClientBuilder().Build()
+	if err != nil {
+		return nil, err
+	}
+	return &vertical{
+		name:          common.VerticalByteAir,
+		client:        client,
+		maxWriteItems: maxWriteDataItems,
+		// The topics are the enums provided by bytedance according to the tenant's situation
+		writeTopic: func(topic string) *writeTopic {
+			return &writeTopic{
+				api: common.APIWriteData,
+				buildRequest: func(records []json.RawMessage) (interface{}, error) {
+					return decodeDataList(records)
+				},
+				call: func(dataList interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.WriteData(dataList.([]map[string]interface{}), topic, opts...)
+				},
+			}
+		},
+		defaultStage: stageIncrementalSyncStreaming,
+		defaultScene: "default",
+		predict: func(scene string) *requestCall {
+			return &requestCall{
+				api:        common.APIPredict,
+				newRequest: func() proto.Message { return &PredictRequest{} },
+				call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.Predict(request.(*PredictRequest), append(opts, option.WithScene(scene))...)
+				},
+			}
+		},
+		callback: &requestCall{
+			api:        common.APICallback,
+			newRequest: func() proto.Message { return &CallbackRequest{} },
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.Callback(request.(*CallbackRequest), opts...)
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+// The layouts of the dates in the flags
+var dateLayouts = []string{"2006-01-02", "20060102"}
+
+// options returns the options of a request with a new request id
+func (env *commandEnv) options(extra ...option.Option) (string, []option.Option) {
+	requestId := uuid.NewString()
+	opts := []option.Option{
+		option.WithRequestId(requestId),
+		option.WithTimeout(env.timeout),
+	}
+	return requestId, append(opts, extra...)
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return newUsageError("invalid arguments of %s, msg:%s", flags.Name(), err.Error())
+	}
+	if flags.NArg() > 0 {
+		return newUsageError("unexpected arguments of %s:%s", flags.Name(), strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, newUsageError("invalid date:%s, it should be like 2006-01-02", value)
+}
+
+// readRecords reads the records in a JSON array or JSON lines from the file or stdin
+func readRecords(file string) ([]json.RawMessage, error) {
+	data, err := readInput(file)
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, newUsageError("no record is found in input")
+	}
+	return records, nil
+}
+
+// readRequest reads the request in JSON from the file or stdin
+func readRequest(file string, request proto.Message) error {
+	data, err := readInput(file)
+	if err != nil {
+		return err
+	}
+	if err := recordUnmarshaler.Unmarshal(data, request); err != nil {
+		return newUsageError("decode request fail, msg:%s", err.Error())
+	}
+	return nil
+}
+
+// splitRecords splits the records into the batches of at most size records
+func splitRecords(records []json.RawMessage, size int) [][]json.RawMessage {
+	var batches [][]json.RawMessage
+	for size > 0 && len(records) > size {
+		batches = append(batches, records[:size])
+		records = records[size:]
+	}
+	return append(batches, records)
+}
+
+// writeCommand writes the records by "WriteXXX" or "WriteData", e.g.
+// "write --topic user --file users.jsonl", the records more than the
+// limit of one request are written in several requests
+func writeCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("write", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of records, such as user, product, content and user_event")
+	file := flags.String("file", "", "the records in a JSON array or JSON lines, default is stdin")
+	stage := flags.String("stage", "", "the stage of data, only used by byteair, default is incremental_sync_streaming")
+	date := flags.String("date", "", "the date of data, such as 2021-11-01, only used by general and byteair")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	if *topic == "" {
+		return false, newUsageError("topic is required")
+	}
+	v := env.vertical
+	writeTopic := v.writeTopic(*topic)
+	if writeTopic == nil {
+		return false, newUsageError("unknown topic:%s of %s", *topic, v.name)
+	}
+	var extraOpts []option.Option
+	if *stage == "" {
+		*stage = v.defaultStage
+	}
+	if *stage != "" {
+		extraOpts = append(extraOpts, option.WithStage(*stage))
+	}
+	if *date != "" {
+		dataDate, err := parseDate(*date)
+		if err != nil {
+			return false, err
+		}
+		extraOpts = append(extraOpts, option.WithDataDate(dataDate))
+	}
+	records, err := readRecords(*file)
+	if err != nil {
+		return false, err
+	}
+	// Decode all the records before sending any of them
+	batches := splitRecords(records, v.maxWriteItems)
+	requests := make([]interface{}, len(batches))
+	for i, batch := range batches {
+		if requests[i], err = writeTopic.buildRequest(batch); err != nil {
+			return false, newUsageError("%s", err.Error())
+		}
+	}
+	helper := env.requestHelper.ForAPI(writeTopic.api)
+	success := true
+	for i, request := range requests {
+		requestId, opts := env.options(extraOpts...)
+		response, err := helper.DoWithRetry(writeTopic.call, request, opts, env.retryTimes)
+		success = env.output.print(requestId, len(batches[i]), response, err) && success
+	}
+	return success, nil
+}
+
+// importCommand imports the records by "ImportXXX" and polls the result, e.g.
+// "import --topic product --file products.json --is-end", only retail supports it
+func importCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of records, one of user, product and user_event")
+	file := flags.String("file", "", "the records in a JSON array or JSON lines, default is stdin")
+	date := flags.String("date", "", "the date of data in RFC3339, default is now")
+	isEnd := flags.Bool("is-end", false, "whether the data of the date is all imported")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	v := env.vertical
+	if v.importTopic == nil {
+		return false, newUsageError("import is not supported by %s, please use write", v.name)
+	}
+	importTopic := v.importTopic(*topic)
+	if importTopic == nil {
+		return false, newUsageError("unknown topic:%s of %s", *topic, v.name)
+	}
+	records, err := readRecords(*file)
+	if err != nil {
+		return false, err
+	}
+	// All the batches are imported with the same date
+	dataDate := common.DataDate(*date)
+	batches := splitRecords(records, common.MaxImportItems)
+	requests := make([]interface{}, len(batches))
+	for i, batch := range batches {
+		if requests[i], err = importTopic.buildRequest(batch, dataDate, *isEnd); err != nil {
+			return false, newUsageError("%s", err.Error())
+		}
+	}
+	helper := env.requestHelper.ForAPI(importTopic.api)
+	success := true
+	for i, request := range requests {
+		requestId, opts := env.options()
+		response := importTopic.newResponse()
+		if err := helper.DoImport(importTopic.call, request, response, opts, env.retryTimes); err != nil {
+			success = env.output.print(requestId, len(batches[i]), nil, err) && success
+			continue
+		}
+		success = env.output.print(requestId, len(batches[i]), response, nil) && success
+	}
+	return success, nil
+}
+
+// doneCommand marks the data of the dates are all written, e.g.
+// "done --topic user --date 2021-11-01,2021-11-02 --stage pre_sync"
+func doneCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("done", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of data, same as the one of write")
+	dates := flags.String("date", "", "the dates of data separated by \",\", such as 2021-11-01,2021-11-02")
+	stage := flags.String("stage", "", "the stage of data, only used by byteair, such as pre_sync")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	if *topic == "" || *dates == "" {
+		return false, newUsageError("topic and date are required")
+	}
+	var dateList []time.Time
+	for _, value := range strings.Split(*dates, ",") {
+		date, err := parseDate(strings.TrimSpace(value))
+		if err != nil {
+			return false, err
+		}
+		dateList = append(dateList, date)
+	}
+	var extraOpts []option.Option
+	if *stage != "" {
+		extraOpts = append(extraOpts, option.WithStage(*stage))
+	}
+	client := env.vertical.client
+	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
+		return client.Done(request.([]time.Time), *topic, opts...)
+	}
+	requestId, opts := env.options(extraOpts...)
+	response, err := env.requestHelper.ForAPI(common.APIDone).DoWithRetry(call, dateList, opts, env.retryTimes)
+	return env.output.print(requestId, 0, response, err), nil
+}
+
+// predictCommand gets the recommendation results, e.g.
+// "predict --scene home --file predict_request.json"
+func predictCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("predict", flag.ContinueOnError)
+	scene := flags.String("scene", env.vertical.defaultScene, "the scene provided by ByteDance")
+	file := flags.String("file", "", "the predict request in JSON, default is stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	return sendRequest(env, env.vertical.predict(*scene), *file, false)
+}
+
+// ackCommand sends back the items shown to user, e.g. "ack --file ack_request.json"
+func ackCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("ack", flag.ContinueOnError)
+	file := flags.String("file", "", "the AckServerImpressions request in JSON, default is stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	if env.vertical.ack == nil {
+		return false, newUsageError("ack is not supported by %s, please use callback", env.vertical.name)
+	}
+	return sendRequest(env, env.vertical.ack, *file, true)
+}
+
+// callbackCommand sends back the items shown to user, e.g. "callback --file callback_request.json"
+func callbackCommand(env *commandEnv, args []string) (bool, error) {
+	flags := flag.NewFlagSet("callback", flag.ContinueOnError)
+	file := flags.String("file", "", "the callback request in JSON, default is stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return false, err
+	}
+	if env.vertical.callback == nil {
+		return false, newUsageError("callback is not supported by %s, please use ack", env.vertical.name)
+	}
+	return sendRequest(env, env.vertical.callback, *file, true)
+}
+
+// sendRequest sends the request read from the file or stdin, the request
+// is retried if retry is true, predict is not retried to respond in time
+func sendRequest(env *commandEnv, requestCall *requestCall, file string, retry bool) (bool, error) {
+	request := requestCall.newRequest()
+	if err := readRequest(file, request); err != nil {
+		return false, err
+	}
+	requestId, opts := env.options()
+	var response proto.Message
+	var err error
+	if retry {
+		response, err = env.requestHelper.ForAPI(requestCall.api).DoWithRetry(
+			requestCall.call, request, opts, env.retryTimes)
+	} else {
+		response, err = requestCall.call(request, opts...)
+	}
+	return env.output.print(requestId, 0, response, err), nil
+}
+
+// operationCommand gets an import operation, or lists the operations, e.g.
+// "operation get --name xxx" and "operation list --filter "date>=2021-06-15 and done=true""
+func operationCommand(env *commandEnv, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, newUsageError("operation get or operation list is expected")
+	}
+	client := env.vertical.client
+	env.output.command = "operation " + args[0]
+	switch args[0] {
+	case "get":
+		flags := flag.NewFlagSet("operation get", flag.ContinueOnError)
+		name := flags.String("name", "", "the name of operation")
+		if err := parseFlags(flags, args[1:]); err != nil {
+			return false, err
+		}
+		if *name == "" {
+			return false, newUsageError("name is required")
+		}
+		call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return client.GetOperation(request.(*GetOperationRequest), opts...)
+		}
+		request := &GetOperationRequest{Name: *name}
+		requestId, opts := env.options()
+		response, err := env.requestHelper.ForAPI(common.APIGetOperation).DoWithRetry(
+			call, request, opts, env.retryTimes)
+		return env.output.print(requestId, 0, response, err), nil
+	case "list":
+		flags := flag.NewFlagSet("operation list", flag.ContinueOnError)
+		filter := flags.String("filter", "", "the filter of operations, such as \"date>=2021-06-15 and done=true\"")
+		pageSize := flags.Int("page-size", 100, "the count of operations in a page")
+		pageToken := flags.String("page-token", "", "the next_page_token of the previous page, empty for the first page")
+		all := flags.Bool("all", false, "list the pages after the first one by next_page_token, until the last page")
+		maxResults := flags.Int("max-results", 0, "the max count of operations listed with --all, 0 means no limit")
+		if err := parseFlags(flags, args[1:]); err != nil {
+			return false, err
+		}
+		// Reject the invalid filter before sending
+		if _, err := common.ParseOperationFilter(*filter); err != nil {
+			return false, newUsageError("%s", err.Error())
+		}
+		if *all {
+			return listAllOperations(env, &common.ListOperationsConfig{
+				Filter:      *filter,
+				PageSize:    *pageSize,
+				PageToken:   *pageToken,
+				MaxResults:  *maxResults,
+				PageTimeout: env.timeout,
+				RetryTimes:  env.retryTimes,
+			}), nil
+		}
+		call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return client.ListOperations(request.(*ListOperationsRequest), opts...)
+		}
+		request := &ListOperationsRequest{
+			Filter:    *filter,
+			PageSize:  int32(*pageSize),
+			PageToken: *pageToken,
+		}
+		requestId, opts := env.options()
+		response, err := env.requestHelper.ForAPI(common.APIListOperations).DoWithRetry(
+			call, request, opts, env.retryTimes)
+		return env.output.print(requestId, 0, response, err), nil
+	}
+	return false, newUsageError("unknown command:operation %s", args[0])
+}
+
+// listAllOperations prints the operations of all the pages as one response,
+// whose next_page_token continues the listing if it is stopped by an error
+// or the max results
+func listAllOperations(env *commandEnv, config *common.ListOperationsConfig) bool {
+	itr := common.NewOperationIterator(context.Background(), env.requestHelper, config)
+	response := &ListOperationsResponse{}
+	for itr.Next() {
+		response.Operations = append(response.Operations, itr.Operation())
+	}
+	response.NextPageToken = itr.NextPageToken()
+	err := itr.Err()
+	if err == nil {
+		response.Status = &Status{Code: core.StatusCodeSuccess}
+	}
+	return env.output.print("", len(response.Operations), response, err)
+}
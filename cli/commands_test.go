@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSplitRecords(t *testing.T) {
+	records := func(n int) []json.RawMessage {
+		result := make([]json.RawMessage, n)
+		for i := range result {
+			result[i] = json.RawMessage("{}")
+		}
+		return result
+	}
+	cases := []struct {
+		name    string
+		records int
+		size    int
+		// expect is the sizes of the batches
+		expect []int
+	}{
+		{name: "partial last batch", records: 5, size: 2, expect: []int{2, 2, 1}},
+		{name: "full batches", records: 4, size: 2, expect: []int{2, 2}},
+		{name: "less than size", records: 1, size: 2, expect: []int{1}},
+		{name: "no limit", records: 5, size: 0, expect: []int{5}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sizes []int
+			for _, batch := range splitRecords(records(c.records), c.size) {
+				sizes = append(sizes, len(batch))
+			}
+			if !reflect.DeepEqual(sizes, c.expect) {
+				t.Fatalf("expect batches of %v, got %v", c.expect, sizes)
+			}
+		})
+	}
+}
+
+func TestRetailImportTopicBuildRequest(t *testing.T) {
+	if topic := newRetailImportTopic(nil, "content"); topic != nil {
+		t.Fatalf("expect unknown topic, got %s", topic.api)
+	}
+	topic := newRetailImportTopic(nil, "user")
+	records := []json.RawMessage{json.RawMessage(`{"user_id":"1"}`), json.RawMessage(`{"userId":"2"}`)}
+	request, err := topic.buildRequest(records, "2021-06-15T00:00:00Z", true)
+	if err != nil {
+		t.Fatalf("expect request built, got err:%v", err)
+	}
+	expect := &ImportUsersRequest{
+		InputConfig: &UsersInputConfig{Source: &UsersInputConfig_UsersInlineSource{
+			UsersInlineSource: &UsersInlineSource{Users: []*User{{UserId: "1"}, {UserId: "2"}}},
+		}},
+		DateConfig: &DateConfig{Date: "2021-06-15T00:00:00Z", IsEnd: true},
+	}
+	if !proto.Equal(request.(proto.Message), expect) {
+		t.Fatalf("expect %v, got %v", expect, request)
+	}
+	if _, ok := topic.newResponse().(*ImportUsersResponse); !ok {
+		t.Fatalf("expect ImportUsersResponse, got %T", topic.newResponse())
+	}
+	if _, err := topic.buildRequest([]json.RawMessage{json.RawMessage(`{"user":"1"}`)}, "", false); err == nil {
+		t.Fatalf("expect error of unknown field")
+	}
+
+	cases := []struct {
+		topic    string
+		api      string
+		record   string
+		expect   proto.Message
+		response proto.Message
+	}{
+		{topic: "product", api: common.APIImportProducts, record: `{"product_id":"1"}`,
+			expect: &ImportProductsRequest{
+				InputConfig: &ProductsInputConfig{Source: &ProductsInputConfig_ProductsInlineSource{
+					ProductsInlineSource: &ProductsInlineSource{Products: []*Product{{ProductId: "1"}}},
+				}},
+				DateConfig: &DateConfig{Date: "2021-06-15T00:00:00Z"},
+			}, response: &ImportProductsResponse{}},
+		{topic: "user_event", api: common.APIImportUserEvents, record: `{"user_id":"1","event_type":"purchase"}`,
+			expect: &ImportUserEventsRequest{
+				InputConfig: &UserEventsInputConfig{Source: &UserEventsInputConfig_UserEventsInlineSource{
+					UserEventsInlineSource: &UserEventsInlineSource{UserEvents: []*UserEvent{{UserId: "1", EventType: "purchase"}}},
+				}},
+				DateConfig: &DateConfig{Date: "2021-06-15T00:00:00Z"},
+			}, response: &ImportUserEventsResponse{}},
+	}
+	for _, c := range cases {
+		topic := newRetailImportTopic(nil, c.topic)
+		if topic == nil || topic.api != c.api {
+			t.Fatalf("expect topic %s of %s, got %v", c.topic, c.api, topic)
+		}
+		request, err := topic.buildRequest([]json.RawMessage{json.RawMessage(c.record)}, "2021-06-15T00:00:00Z", false)
+		if err != nil || !proto.Equal(request.(proto.Message), c.expect) {
+			t.Fatalf("expect %v, got %v err:%v", c.expect, request, err)
+		}
+		if response := topic.newResponse(); reflect.TypeOf(response) != reflect.TypeOf(c.response) {
+			t.Fatalf("expect %T, got %T", c.response, response)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	. "github.com/byteplus-sdk/sdk-go/general/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// The max count of data written by one "WriteData" request
+const maxWriteDataItems = 10000
+
+func newGeneralVertical(config *common.ClientConfig) (*vertical, error) {
+	client, err := config.GeneralClientBuilder().Build()
+	if err != nil {
+		return nil, err
+	}
+	return &vertical{
+		name:          common.VerticalGeneral,
+		client:        client,
+		maxWriteItems: maxWriteDataItems,
+		// The topics are the enums provided by bytedance according to the tenant's situation
+		writeTopic: func(topic string) *writeTopic {
+			return &writeTopic{
+				api: common.APIWriteData,
+				buildRequest: func(records []json.RawMessage) (interface{}, error) {
+					return decodeDataList(records)
+				},
+				call: func(dataList interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.WriteData(dataList.([]map[string]interface{}), topic, opts...)
+				},
+			}
+		},
+		defaultScene: "home",
+		predict: func(scene string) *requestCall {
+			return &requestCall{
+				api:        common.APIPredict,
+				newRequest: func() proto.Message { return &PredictRequest{} },
+				call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.Predict(request.(*PredictRequest), scene, opts...)
+				},
+			}
+		},
+		callback: &requestCall{
+			api:        common.APICallback,
+			newRequest: func() proto.Message { return &CallbackRequest{} },
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.Callback(request.(*CallbackRequest), opts...)
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// readInput reads the input of a command from the file, or stdin if the file is "" or "-"
+func readInput(file string) ([]byte, error) {
+	if file == "" || file == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// decodeRecords splits the input into the records in JSON, the input
+// is a JSON array of records, or the records in JSON lines
+func decodeRecords(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	var records []json.RawMessage
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("decode records fail, msg:%s", err.Error())
+		}
+		return records, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var record json.RawMessage
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode record %d fail, msg:%s", len(records)+1, err.Error())
+		}
+		records = append(records, record)
+	}
+}
+
+// decodeJSONObject decodes a JSON object, the numbers are kept as json.Number,
+// so that the large integers, such as the ids, are not changed
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, fmt.Errorf("the record should be a JSON object")
+	}
+	return object, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeRecords(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		// expect is the records in JSON, it is ignored if invalid
+		expect  []string
+		invalid string
+	}{
+		{name: "array", input: ` [{"user_id":"1"}, {"user_id":"2"}] `,
+			expect: []string{`{"user_id":"1"}`, `{"user_id":"2"}`}},
+		{name: "lines", input: "{\"user_id\":\"1\"}\n\n{\"user_id\":\"2\"}\n",
+			expect: []string{`{"user_id":"1"}`, `{"user_id":"2"}`}},
+		{name: "large number is kept", input: `{"id":12345678901234567890}`,
+			expect: []string{`{"id":12345678901234567890}`}},
+		{name: "empty", input: " \n", expect: nil},
+		{name: "invalid array", input: `[{"user_id":"1"},]`, invalid: "decode records fail"},
+		{name: "invalid line", input: "{\"user_id\":\"1\"}\n{\"user_id\":", invalid: "decode record 2 fail"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			records, err := decodeRecords([]byte(c.input))
+			if c.invalid != "" {
+				if err == nil || !strings.Contains(err.Error(), c.invalid) {
+					t.Fatalf("expect error containing %q, got err:%v", c.invalid, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %v, got err:%v", c.expect, err)
+			}
+			if len(records) != len(c.expect) {
+				t.Fatalf("expect %d records, got %d", len(c.expect), len(records))
+			}
+			for i, record := range records {
+				if string(record) != c.expect[i] {
+					t.Fatalf("expect record %s, got %s", c.expect[i], record)
+				}
+			}
+		})
+	}
+}
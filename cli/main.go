@@ -0,0 +1,158 @@
+// The cli runs the apis of all the verticals by one binary, e.g.
+//
+//	go build -o byteplus ./cli
+//	./byteplus --vertical retailv2 write --topic user --file users.jsonl
+//	echo '{"user_id":"1"}' | ./byteplus --vertical retailv2 write --topic user
+//	./byteplus --vertical retail import --topic product --file products.json --is-end
+//	./byteplus --vertical byteair done --topic user --date 2021-11-01 --stage pre_sync
+//	./byteplus --vertical general predict --scene home --file predict_request.json
+//	./byteplus --vertical retail operation list --filter "date>=2021-06-15 and done=true"
+//
+// The credentials are loaded by common.LoadClientConfig, the result of each request is
+// printed to stdout as a line of JSON, and the exit code is not 0 if any request fails
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+)
+
+const (
+	DefaultRetryTimes = 2
+
+	DefaultTimeout = 800 * time.Millisecond
+)
+
+// The exit codes of the cli
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// command runs a subcommand with its arguments, and returns
+// false if any request fails, the results are printed by the output
+type command func(env *commandEnv, args []string) (bool, error)
+
+var commands = map[string]command{
+	"write":     writeCommand,
+	"import":    importCommand,
+	"done":      doneCommand,
+	"predict":   predictCommand,
+	"ack":       ackCommand,
+	"callback":  callbackCommand,
+	"operation": operationCommand,
+}
+
+// commandEnv is shared by the subcommands
+type commandEnv struct {
+	vertical      *vertical
+	requestHelper *common.RequestHelper
+	output        *output
+	timeout       time.Duration
+	retryTimes    int
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("byteplus", flag.ContinueOnError)
+	flags.Usage = func() { usage(flags) }
+	verticalName := flags.String("vertical", os.Getenv("BYTEPLUS_VERTICAL"),
+		"retail, retailv2, media, general or byteair, default is $BYTEPLUS_VERTICAL")
+	configPath := flags.String("config", "", "the path of config file, default is $BYTEPLUS_CONFIG")
+	profile := flags.String("profile", "", "the profile in config file, default is $BYTEPLUS_PROFILE")
+	timeout := flags.Duration("timeout", DefaultTimeout, "the timeout of each request")
+	retryTimes := flags.Int("retry", DefaultRetryTimes, "the retry times of each request")
+	verbose := flags.Bool("verbose", false, "print the debug logs of sdk")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		return exitUsage
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command:%s\n", name)
+		usage(flags)
+		return exitUsage
+	}
+	// Only the errors are logged by default, so that the output can be parsed
+	logs.Level = logs.LevelError
+	if *verbose {
+		logs.Level = logs.LevelDebug
+	}
+	loader := &common.ConfigLoader{Path: *configPath, Profile: *profile}
+	config, err := loader.Load(*verticalName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load client config fail, msg:%s\n", err.Error())
+		return exitUsage
+	}
+	v, err := newVertical(*verticalName, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build client fail, msg:%s\n", err.Error())
+		return exitFailure
+	}
+	defer v.client.Release()
+	env := &commandEnv{
+		vertical:      v,
+		requestHelper: &common.RequestHelper{Client: v.client},
+		output:        newOutput(os.Stdout, name, v.name),
+		timeout:       *timeout,
+		retryTimes:    *retryTimes,
+	}
+	return runCommand(env, name, cmd, flags.Args()[1:])
+}
+
+// runCommand runs the command, and returns the exit code by its result
+func runCommand(env *commandEnv, name string, cmd command, args []string) int {
+	success, err := cmd(env, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s fail, msg:%s\n", name, err.Error())
+		if _, ok := err.(*usageError); ok {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	if !success {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func usage(flags *flag.FlagSet) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: byteplus [flags] <command> [command flags]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"byteplus --vertical <vertical> <command> -h\" for the flags of command\n\nflags:\n")
+	flags.PrintDefaults()
+}
+
+// usageError is the invalid arguments of a command
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func newUsageError(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
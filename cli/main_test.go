@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRunUsage(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+	}{
+		{name: "no command", args: []string{"--vertical", "retail"}},
+		{name: "unknown flag", args: []string{"--unknown", "write"}},
+		{name: "unknown command", args: []string{"--vertical", "retail", "delete"}},
+		{name: "unknown vertical", args: []string{"--vertical", "news", "write"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if code := run(c.args); code != exitUsage {
+				t.Fatalf("expect exit code %d, got %d", exitUsage, code)
+			}
+		})
+	}
+}
+
+// newTestEnv creates the env of the vertical writing the users by call
+func newTestEnv(call common.Call, out *bytes.Buffer) *commandEnv {
+	v := &vertical{
+		name:          common.VerticalRetailV2,
+		maxWriteItems: 2,
+		writeTopic: func(topic string) *writeTopic {
+			if topic != "user" {
+				return nil
+			}
+			return &writeTopic{
+				api: common.APIWriteUsers,
+				buildRequest: func(records []json.RawMessage) (interface{}, error) {
+					return records, nil
+				},
+				call: call,
+			}
+		},
+	}
+	return &commandEnv{
+		vertical:      v,
+		requestHelper: &common.RequestHelper{},
+		output:        newOutput(out, "write", v.name),
+	}
+}
+
+func TestRunCommandExitCode(t *testing.T) {
+	file := t.TempDir() + "/users.jsonl"
+	content := "{\"user_id\":\"1\"}\n{\"user_id\":\"2\"}\n{\"user_id\":\"3\"}\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("expect file written, got err:%v", err)
+	}
+	success := func(interface{}, ...option.Option) (proto.Message, error) {
+		return &OperationResponse{Status: &Status{Code: 0}}, nil
+	}
+	calls := 0
+	// The second request fails, the others are still sent
+	secondFails := func(interface{}, ...option.Option) (proto.Message, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("bad request")
+		}
+		return &OperationResponse{Status: &Status{Code: 0}}, nil
+	}
+	failure := func(interface{}, ...option.Option) (proto.Message, error) {
+		return &OperationResponse{Status: &Status{Code: 400, Message: "invalid"}}, nil
+	}
+	cases := []struct {
+		name   string
+		call   common.Call
+		args   []string
+		expect int
+		// lines is the count of results printed
+		lines int
+	}{
+		{name: "success", call: success, args: []string{"--topic", "user", "--file", file},
+			expect: exitSuccess, lines: 2},
+		{name: "request error", call: secondFails, args: []string{"--topic", "user", "--file", file},
+			expect: exitFailure, lines: 2},
+		{name: "failure response", call: failure, args: []string{"--topic", "user", "--file", file},
+			expect: exitFailure, lines: 2},
+		{name: "unknown topic", call: success, args: []string{"--topic", "item", "--file", file},
+			expect: exitUsage},
+		{name: "unexpected argument", call: success, args: []string{"--topic", "user", file},
+			expect: exitUsage},
+		{name: "invalid date", call: success, args: []string{"--topic", "user", "--date", "06/15", "--file", file},
+			expect: exitUsage},
+		{name: "missing file", call: success, args: []string{"--topic", "user", "--file", file + ".missing"},
+			expect: exitFailure},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if code := runCommand(newTestEnv(c.call, out), "write", writeCommand, c.args); code != c.expect {
+				t.Fatalf("expect exit code %d, got %d", c.expect, code)
+			}
+			if lines := strings.Count(out.String(), "\n"); lines != c.lines {
+				t.Fatalf("expect %d results, got %q", c.lines, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/media"
+	. "github.com/byteplus-sdk/sdk-go/media/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+func newMediaVertical(config *common.ClientConfig) (*vertical, error) {
+	client, err := config.MediaClientBuilder().Build()
+	if err != nil {
+		return nil, err
+	}
+	return &vertical{
+		name:          common.VerticalMedia,
+		client:        client,
+		maxWriteItems: common.MaxWriteItems,
+		writeTopic: func(topic string) *writeTopic {
+			return newMediaWriteTopic(client, topic)
+		},
+		defaultScene: "home",
+		predict: func(scene string) *requestCall {
+			return &requestCall{
+				api:        common.APIPredict,
+				newRequest: func() proto.Message { return &PredictRequest{} },
+				call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.Predict(request.(*PredictRequest), scene, opts...)
+				},
+			}
+		},
+		ack: &requestCall{
+			api:        common.APIAckServerImpressions,
+			newRequest: func() proto.Message { return &AckServerImpressionsRequest{} },
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.AckServerImpressions(request.(*AckServerImpressionsRequest), opts...)
+			},
+		},
+	}, nil
+}
+
+func newMediaWriteTopic(client media.Client, topic string) *writeTopic {
+	switch topic {
+	case "user":
+		return &writeTopic{
+			api: common.APIWriteUsers,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &User{} })
+				if err != nil {
+					return nil, err
+				}
+				users := make([]*User, len(messages))
+				for i, message := range messages {
+					users[i] = message.(*User)
+				}
+				return &WriteUsersRequest{Users: users}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteUsers(request.(*WriteUsersRequest), opts...)
+			},
+		}
+	case "content":
+		return &writeTopic{
+			api: common.APIWriteContents,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &Content{} })
+				if err != nil {
+					return nil, err
+				}
+				contents := make([]*Content, len(messages))
+				for i, message := range messages {
+					contents[i] = message.(*Content)
+				}
+				return &WriteContentsRequest{Contents: contents}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteContents(request.(*WriteContentsRequest), opts...)
+			},
+		}
+	case "user_event":
+		return &writeTopic{
+			api: common.APIWriteUserEvents,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &UserEvent{} })
+				if err != nil {
+					return nil, err
+				}
+				userEvents := make([]*UserEvent, len(messages))
+				for i, message := range messages {
+					userEvents[i] = message.(*UserEvent)
+				}
+				return &WriteUserEventsRequest{UserEvents: userEvents}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteUserEvents(request.(*WriteUserEventsRequest), opts...)
+			},
+		}
+	}
+	return nil
+}
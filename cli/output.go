@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// result is a line of the output, which is the result of a request
+type result struct {
+	Command   string `json:"command"`
+	Vertical  string `json:"vertical"`
+	RequestId string `json:"request_id,omitempty"`
+
+	// Records is the count of records sent by write and import
+	Records int `json:"records,omitempty"`
+
+	Success  bool            `json:"success"`
+	Error    string          `json:"error,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// output prints the results as JSON lines, the responses are
+// marshaled by protojson with the field names in proto
+type output struct {
+	lock     sync.Mutex
+	encoder  *json.Encoder
+	command  string
+	vertical string
+}
+
+func newOutput(w io.Writer, command string, vertical string) *output {
+	return &output{encoder: json.NewEncoder(w), command: command, vertical: vertical}
+}
+
+var responseMarshaler = protojson.MarshalOptions{UseProtoNames: true}
+
+// print prints the result of a request, the request is failed if err is not nil,
+// or the response is not successful. It returns whether the request is successful
+func (o *output) print(requestId string, records int, response proto.Message, err error) bool {
+	r := &result{
+		Command:   o.command,
+		Vertical:  o.vertical,
+		RequestId: requestId,
+		Records:   records,
+	}
+	if response != nil {
+		data, marshalErr := responseMarshaler.Marshal(response)
+		if marshalErr == nil {
+			r.Response = data
+		} else if err == nil {
+			err = marshalErr
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Success = isSuccessResponse(response)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	_ = o.encoder.Encode(r)
+	return r.Success
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/retail"
+	. "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+func newRetailVertical(config *common.ClientConfig) (*vertical, error) {
+	client, err := config.RetailClientBuilder().Build()
+	if err != nil {
+		return nil, err
+	}
+	return &vertical{
+		name:          common.VerticalRetail,
+		client:        client,
+		maxWriteItems: common.MaxWriteItems,
+		writeTopic: func(topic string) *writeTopic {
+			return newRetailWriteTopic(client, topic)
+		},
+		importTopic: func(topic string) *importTopic {
+			return newRetailImportTopic(client, topic)
+		},
+		defaultScene: "home",
+		predict: func(scene string) *requestCall {
+			return &requestCall{
+				api:        common.APIPredict,
+				newRequest: func() proto.Message { return &PredictRequest{} },
+				call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+					return client.Predict(request.(*PredictRequest), scene, opts...)
+				},
+			}
+		},
+		ack: &requestCall{
+			api:        common.APIAckServerImpressions,
+			newRequest: func() proto.Message { return &AckServerImpressionsRequest{} },
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.AckServerImpressions(request.(*AckServerImpressionsRequest), opts...)
+			},
+		},
+	}, nil
+}
+
+func newRetailWriteTopic(client retail.Client, topic string) *writeTopic {
+	switch topic {
+	case "user":
+		return &writeTopic{
+			api: common.APIWriteUsers,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &User{} })
+				if err != nil {
+					return nil, err
+				}
+				users := make([]*User, len(messages))
+				for i, message := range messages {
+					users[i] = message.(*User)
+				}
+				return &WriteUsersRequest{Users: users}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteUsers(request.(*WriteUsersRequest), opts...)
+			},
+		}
+	case "product":
+		return &writeTopic{
+			api: common.APIWriteProducts,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &Product{} })
+				if err != nil {
+					return nil, err
+				}
+				products := make([]*Product, len(messages))
+				for i, message := range messages {
+					products[i] = message.(*Product)
+				}
+				return &WriteProductsRequest{Products: products}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteProducts(request.(*WriteProductsRequest), opts...)
+			},
+		}
+	case "user_event":
+		return &writeTopic{
+			api: common.APIWriteUserEvents,
+			buildRequest: func(records []json.RawMessage) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &UserEvent{} })
+				if err != nil {
+					return nil, err
+				}
+				userEvents := make([]*UserEvent, len(messages))
+				for i, message := range messages {
+					userEvents[i] = message.(*UserEvent)
+				}
+				return &WriteUserEventsRequest{UserEvents: userEvents}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.WriteUserEvents(request.(*WriteUserEventsRequest), opts...)
+			},
+		}
+	}
+	return nil
+}
+
+func newRetailImportTopic(client retail.Client, topic string) *importTopic {
+	switch topic {
+	case "user":
+		return &importTopic{
+			api: common.APIImportUsers,
+			buildRequest: func(records []json.RawMessage, date string, isEnd bool) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &User{} })
+				if err != nil {
+					return nil, err
+				}
+				users := make([]*User, len(messages))
+				for i, message := range messages {
+					users[i] = message.(*User)
+				}
+				return &ImportUsersRequest{
+					InputConfig: &UsersInputConfig{
+						Source: &UsersInputConfig_UsersInlineSource{
+							UsersInlineSource: &UsersInlineSource{Users: users},
+						}},
+					DateConfig: &DateConfig{Date: date, IsEnd: isEnd},
+				}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportUsers(request.(*ImportUsersRequest), opts...)
+			},
+			newResponse: func() proto.Message { return &ImportUsersResponse{} },
+		}
+	case "product":
+		return &importTopic{
+			api: common.APIImportProducts,
+			buildRequest: func(records []json.RawMessage, date string, isEnd bool) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &Product{} })
+				if err != nil {
+					return nil, err
+				}
+				products := make([]*Product, len(messages))
+				for i, message := range messages {
+					products[i] = message.(*Product)
+				}
+				return &ImportProductsRequest{
+					InputConfig: &ProductsInputConfig{
+						Source: &ProductsInputConfig_ProductsInlineSource{
+							ProductsInlineSource: &ProductsInlineSource{Products: products},
+						}},
+					DateConfig: &DateConfig{Date: date, IsEnd: isEnd},
+				}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportProducts(request.(*ImportProductsRequest), opts...)
+			},
+			newResponse: func() proto.Message { return &ImportProductsResponse{} },
+		}
+	case "user_event":
+		return &importTopic{
+			api: common.APIImportUserEvents,
+			buildRequest: func(records []json.RawMessage, date string, isEnd bool) (interface{}, error) {
+				messages, err := decodeMessages(records, func() proto.Message { return &UserEvent{} })
+				if err != nil {
+					return nil, err
+				}
+				userEvents := make([]*UserEvent, len(messages))
+				for i, message := range messages {
+					userEvents[i] = message.(*UserEvent)
+				}
+				return &ImportUserEventsRequest{
+					InputConfig: &UserEventsInputConfig{
+						Source: &UserEventsInputConfig_UserEventsInlineSource{
+							UserEventsInlineSource: &UserEventsInlineSource{UserEvents: userEvents},
+						}},
+					DateConfig: &DateConfig{Date: date, IsEnd: isEnd},
+				}, nil
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportUserEvents(request.(*ImportUserEventsRequest), opts...)
+			},
+			newResponse: func() proto.Message { return &ImportUserEventsResponse{} },
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/byteplus-sdk/example-go/common"
+	sdkcommon "github.com/byteplus-sdk/sdk-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// vertical adapts the client of a vertical to the commands,
+// a nil field means the command isn't supported by the vertical
+type vertical struct {
+	name   string
+	client sdkcommon.Client
+
+	// maxWriteItems is the max count of records written by one request
+	maxWriteItems int
+
+	// writeTopic returns how to write the records of the topic, nil if the topic is unknown
+	writeTopic func(topic string) *writeTopic
+
+	// importTopic returns how to import the records of the topic, nil if the topic is unknown
+	importTopic func(topic string) *importTopic
+
+	// defaultStage is the stage of write if it is not set
+	defaultStage string
+
+	// predict returns how to predict in the scene
+	predict      func(scene string) *requestCall
+	defaultScene string
+
+	ack      *requestCall
+	callback *requestCall
+}
+
+// writeTopic tells how to write the records of a topic
+type writeTopic struct {
+	api string
+
+	// buildRequest decodes the records in JSON, and builds the request of them
+	buildRequest func(records []json.RawMessage) (interface{}, error)
+	call         common.Call
+}
+
+// importTopic tells how to import the records of a topic
+type importTopic struct {
+	api string
+	// buildRequest decodes the records in JSON, and builds the request of them,
+	// date is the date of data in RFC3339, isEnd means the data of the date is all imported
+	buildRequest func(records []json.RawMessage, date string, isEnd bool) (interface{}, error)
+	call         common.Call
+	newResponse  func() proto.Message
+}
+
+// requestCall tells how to send a request decoded from JSON
+type requestCall struct {
+	api        string
+	newRequest func() proto.Message
+	call       common.Call
+}
+
+func newVertical(name string, config *common.ClientConfig) (*vertical, error) {
+	switch name {
+	case common.VerticalRetail:
+		return newRetailVertical(config)
+	case common.VerticalRetailV2:
+		return newRetailV2Vertical(config)
+	case common.VerticalMedia:
+		return newMediaVertical(config)
+	case common.VerticalGeneral:
+		return newGeneralVertical(config)
+	case common.VerticalByteAir:
+		return newByteAirVertical(config)
+	}
+	return nil, fmt.Errorf("unknown vertical:%s", name)
+}
+
+var recordUnmarshaler = protojson.UnmarshalOptions{}
+
+// decodeMessages decodes each record in JSON to a message created by newMessage
+func decodeMessages(records []json.RawMessage, newMessage func() proto.Message) ([]proto.Message, error) {
+	messages := make([]proto.Message, len(records))
+	for i, record := range records {
+		message := newMessage()
+		if err := recordUnmarshaler.Unmarshal(record, message); err != nil {
+			return nil, fmt.Errorf("decode record %d fail, msg:%s", i+1, err.Error())
+		}
+		messages[i] = message
+	}
+	return messages, nil
+}
+
+// decodeDataList decodes each record in JSON to a map, which is
+// the data of "WriteData", the numbers are kept as json.Number
+func decodeDataList(records []json.RawMessage) ([]map[string]interface{}, error) {
+	dataList := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		data, err := decodeJSONObject(record)
+		if err != nil {
+			return nil, fmt.Errorf("decode record %d fail, msg:%s", i+1, err.Error())
+		}
+		dataList[i] = data
+	}
+	return dataList, nil
+}
+
+// isSuccessResponse checks the response of any api, the write rejected
+// for idempotent is also successful, see common.IsUploadSuccess
+func isSuccessResponse(response proto.Message) bool {
+	if rsp, ok := response.(interface{ GetStatus() *Status }); ok {
+		status := rsp.GetStatus()
+		return status != nil && (common.IsUploadSuccess(status) || common.IsSuccess(status))
+	}
+	return common.IsSuccessResponse(response)
+}
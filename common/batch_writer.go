@@ -0,0 +1,186 @@
+package common
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+)
+
+const (
+	// The "WriteXXX" api can transfer max to 2000 items at one request
+	MaxWriteItems = 2000
+
+	// The "ImportXXX" api can transfer max to 10k items at one request
+	MaxImportItems = 10000
+
+	// The maximum time a record waits in the batch before being flushed
+	defaultBatchLinger = time.Second
+)
+
+// BatchWriterConfig is the configuration of BatchWriter,
+// the zero value of each field means using the default value
+type BatchWriterConfig struct {
+	// The count of records sent by one request, default is the maximum
+	// items the api can transfer at one request, larger value is ignored
+	BatchSize int
+
+	// The maximum time a record waits for the batch to be full,
+	// the batch is flushed anyway after Linger, default is 1s
+	Linger time.Duration
+
+	// OnLingerError receives the batch failed to be flushed after Linger, name
+	// is the one of the BatchWriter. If it is nil, the error is kept and
+	// returned by the next Write, Flush or Close of the BatchWriter
+	OnLingerError func(name string, records []interface{}, err error)
+}
+
+// FlushFunc sends the batch of records, whose length never exceeds
+// the batch size of the BatchWriter
+type FlushFunc func(records []interface{}) error
+
+// ErrWriterClosed is returned when writing to a closed BatchWriter
+var ErrWriterClosed = errors.New("batch writer is closed")
+
+// BatchWriter accepts records one by one, coalesces them into batches,
+// and flushes a batch when it is full or has waited for the linger time.
+// The records written at once are split if they exceed the batch size.
+// Flushes are serialized, so the records are sent in the order of writing
+type BatchWriter struct {
+	name      string
+	batchSize int
+	linger    time.Duration
+	flush     FlushFunc
+	onError   func(name string, records []interface{}, err error)
+
+	lock    sync.Mutex
+	records []interface{}
+	timer   *time.Timer
+	// batchSeq increases after each flush, so that the timer of
+	// a flushed batch doesn't flush the next batch too early
+	batchSeq uint64
+	closed   bool
+	// lingerErr is the error of the flush after linger, which
+	// is not returned yet, if OnLingerError is not set
+	lingerErr error
+}
+
+// NewBatchWriter creates a BatchWriter for the api with name, maxBatchSize is
+// the maximum items the api can transfer at one request, such as MaxWriteItems
+func NewBatchWriter(name string, maxBatchSize int, config *BatchWriterConfig, flush FlushFunc) *BatchWriter {
+	if config == nil {
+		config = &BatchWriterConfig{}
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 || batchSize > maxBatchSize {
+		batchSize = maxBatchSize
+	}
+	linger := config.Linger
+	if linger <= 0 {
+		linger = defaultBatchLinger
+	}
+	return &BatchWriter{
+		name:      name,
+		batchSize: batchSize,
+		linger:    linger,
+		flush:     flush,
+		onError:   config.OnLingerError,
+		records:   make([]interface{}, 0, batchSize),
+	}
+}
+
+// Write adds the records to the batch, the batch is flushed by the
+// calling goroutine each time it is full, and the error of the flush is
+// returned, in which case the records after the flushed ones are not added.
+// The error of the previous flush after linger is returned before adding
+// any record, see BatchWriterConfig.OnLingerError
+func (w *BatchWriter) Write(records ...interface{}) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if err := w.takeLingerErr(); err != nil {
+		return err
+	}
+	for _, record := range records {
+		w.records = append(w.records, record)
+		if len(w.records) == 1 {
+			seq := w.batchSeq
+			w.timer = time.AfterFunc(w.linger, func() {
+				w.lingerFlush(seq)
+			})
+		}
+		if len(w.records) >= w.batchSize {
+			if err := w.doFlush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *BatchWriter) lingerFlush(seq uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed || w.batchSeq != seq {
+		return
+	}
+	records := w.records
+	if err := w.doFlush(); err != nil {
+		logs.Error("[Batch%s] flush occur error, msg:%s", w.name, err.Error())
+		if w.onError != nil {
+			w.onError(w.name, records, err)
+		} else if w.lingerErr == nil {
+			w.lingerErr = err
+		}
+	}
+}
+
+// takeLingerErr returns the error of the flush after linger only once
+func (w *BatchWriter) takeLingerErr() error {
+	err := w.lingerErr
+	w.lingerErr = nil
+	return err
+}
+
+// Flush sends the records in the batch immediately, the error of the
+// previous flush after linger is returned if the batch is flushed successfully
+func (w *BatchWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.doFlush(); err != nil {
+		return err
+	}
+	return w.takeLingerErr()
+}
+
+func (w *BatchWriter) doFlush() error {
+	if len(w.records) == 0 {
+		return nil
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	records := w.records
+	w.records = make([]interface{}, 0, w.batchSize)
+	w.batchSeq++
+	return w.flush(records)
+}
+
+// Close flushes the remaining records, and stops accepting new records,
+// the error of the previous flush after linger is returned as Flush
+func (w *BatchWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.doFlush(); err != nil {
+		return err
+	}
+	return w.takeLingerErr()
+}
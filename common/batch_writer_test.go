@@ -0,0 +1,183 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flushRecorder records the sizes of the flushed batches, and fails
+// the flushes whose index is in failures
+type flushRecorder struct {
+	lock     sync.Mutex
+	sizes    []int
+	failures map[int]error
+	flushed  chan []interface{}
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{failures: map[int]error{}, flushed: make(chan []interface{}, 100)}
+}
+
+func (r *flushRecorder) flush(records []interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	index := len(r.sizes)
+	r.sizes = append(r.sizes, len(records))
+	r.flushed <- records
+	return r.failures[index]
+}
+
+func (r *flushRecorder) batchSizes() []int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]int(nil), r.sizes...)
+}
+
+func testRecords(count int) []interface{} {
+	result := make([]interface{}, count)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
+
+func TestBatchWriterSplit(t *testing.T) {
+	cases := []struct {
+		name      string
+		batchSize int
+		writes    []int
+		// The sizes of batches flushed by Write, and by Flush finally
+		expect []int
+	}{
+		{name: "split records written at once", batchSize: 3, writes: []int{7}, expect: []int{3, 3, 1}},
+		{name: "coalesce records written one by one", batchSize: 3, writes: []int{1, 1, 1, 1}, expect: []int{3, 1}},
+		{name: "exactly full", batchSize: 3, writes: []int{2, 1}, expect: []int{3}},
+		{name: "batch size larger than max", batchSize: 100, writes: []int{12}, expect: []int{10, 2}},
+		{name: "default batch size is max", batchSize: 0, writes: []int{25}, expect: []int{10, 10, 5}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := newFlushRecorder()
+			writer := NewBatchWriter(APIWriteUsers, 10,
+				&BatchWriterConfig{BatchSize: c.batchSize, Linger: time.Hour}, recorder.flush)
+			for _, count := range c.writes {
+				if err := writer.Write(testRecords(count)...); err != nil {
+					t.Fatalf("expect written, got err:%v", err)
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				t.Fatalf("expect flushed, got err:%v", err)
+			}
+			if sizes := recorder.batchSizes(); !reflect.DeepEqual(sizes, c.expect) {
+				t.Fatalf("expect batches %v, got %v", c.expect, sizes)
+			}
+		})
+	}
+}
+
+func TestBatchWriterStopAtFlushError(t *testing.T) {
+	recorder := newFlushRecorder()
+	recorder.failures[1] = errBadRequest
+	writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{Linger: time.Hour}, recorder.flush)
+	if err := writer.Write(testRecords(10)...); !errors.Is(err, errBadRequest) {
+		t.Fatalf("expect the error of flush, got err:%v", err)
+	}
+	// The records after the failed batch are not added
+	if err := writer.Close(); err != nil {
+		t.Fatalf("expect closed, got err:%v", err)
+	}
+	if sizes := recorder.batchSizes(); !reflect.DeepEqual(sizes, []int{3, 3}) {
+		t.Fatalf("expect batches [3 3], got %v", sizes)
+	}
+	if err := writer.Write(1); !errors.Is(err, ErrWriterClosed) {
+		t.Fatalf("expect ErrWriterClosed, got err:%v", err)
+	}
+}
+
+func TestBatchWriterLinger(t *testing.T) {
+	recorder := newFlushRecorder()
+	writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{Linger: 10 * time.Millisecond}, recorder.flush)
+	if err := writer.Write(1, 2); err != nil {
+		t.Fatalf("expect written, got err:%v", err)
+	}
+	select {
+	case batch := <-recorder.flushed:
+		if len(batch) != 2 {
+			t.Fatalf("expect the 2 records flushed after linger, got %v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect flushed after linger")
+	}
+	_ = writer.Close()
+}
+
+func TestBatchWriterIgnoreLingerOfFlushedBatch(t *testing.T) {
+	recorder := newFlushRecorder()
+	writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{Linger: time.Hour}, recorder.flush)
+	if err := writer.Write(testRecords(4)...); err != nil {
+		t.Fatalf("expect written, got err:%v", err)
+	}
+	// The timer of the first batch fires after the batch is flushed
+	writer.lingerFlush(0)
+	if sizes := recorder.batchSizes(); !reflect.DeepEqual(sizes, []int{3}) {
+		t.Fatalf("expect the next batch not flushed by the timer of the flushed one, got %v", sizes)
+	}
+	writer.lingerFlush(1)
+	if sizes := recorder.batchSizes(); !reflect.DeepEqual(sizes, []int{3, 1}) {
+		t.Fatalf("expect the next batch flushed by its own timer, got %v", sizes)
+	}
+}
+
+func TestBatchWriterLingerError(t *testing.T) {
+	t.Run("returned by next write", func(t *testing.T) {
+		recorder := newFlushRecorder()
+		recorder.failures[0] = errBadRequest
+		writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{Linger: time.Hour}, recorder.flush)
+		_ = writer.Write(1)
+		writer.lingerFlush(0)
+		if err := writer.Write(2); !errors.Is(err, errBadRequest) {
+			t.Fatalf("expect the error of linger flush, got err:%v", err)
+		}
+		// The error is only returned once
+		if err := writer.Write(3); err != nil {
+			t.Fatalf("expect written, got err:%v", err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("expect closed, got err:%v", err)
+		}
+	})
+	t.Run("returned by close", func(t *testing.T) {
+		recorder := newFlushRecorder()
+		recorder.failures[0] = errBadRequest
+		writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{Linger: time.Hour}, recorder.flush)
+		_ = writer.Write(1)
+		writer.lingerFlush(0)
+		if err := writer.Close(); !errors.Is(err, errBadRequest) {
+			t.Fatalf("expect the error of linger flush, got err:%v", err)
+		}
+	})
+	t.Run("passed to callback", func(t *testing.T) {
+		recorder := newFlushRecorder()
+		recorder.failures[0] = errBadRequest
+		var failedName string
+		var failed []interface{}
+		writer := NewBatchWriter(APIWriteUsers, 3, &BatchWriterConfig{
+			Linger: time.Hour,
+			OnLingerError: func(name string, records []interface{}, err error) {
+				failedName, failed = name, records
+			},
+		}, recorder.flush)
+		_ = writer.Write(1, 2)
+		writer.lingerFlush(0)
+		if failedName != APIWriteUsers || !reflect.DeepEqual(failed, []interface{}{1, 2}) {
+			t.Fatalf("expect the failed batch passed to callback, got %s %v", failedName, failed)
+		}
+		if err := writer.Write(3); err != nil {
+			t.Fatalf("expect the error not returned when callback is set, got err:%v", err)
+		}
+		_ = writer.Close()
+	})
+}
@@ -0,0 +1,311 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	checkpointOpStart = "start"
+	checkpointOpBatch = "batch"
+)
+
+// CheckpointBatch is the progress of a batch of rows in the Checkpoint
+type CheckpointBatch struct {
+	// FirstRow and LastRow are the range of the row numbers read for
+	// the batch, including the invalid rows, which are not sent
+	FirstRow int64 `json:"first_row"`
+	LastRow  int64 `json:"last_row"`
+
+	// RequestId is the request id of the batch, which is kept after
+	// restart, so that the batch sent again is deduplicated by the server
+	RequestId string `json:"request_id"`
+
+	// Operation is the name of the import operation, which is
+	// polled again after restart instead of sending the batch again
+	Operation string `json:"operation,omitempty"`
+
+	// Done means the batch is confirmed by the server, it is skipped after restart
+	Done bool `json:"done,omitempty"`
+}
+
+func (b *CheckpointBatch) key() string {
+	return fmt.Sprintf("%d-%d", b.FirstRow, b.LastRow)
+}
+
+// checkpointEntry is a line of the checkpoint file,
+// the last entry of a batch is its current progress
+type checkpointEntry struct {
+	Op        string           `json:"op"`
+	Source    string           `json:"source,omitempty"`
+	BatchSize int              `json:"batch_size,omitempty"`
+	Date      string           `json:"date,omitempty"`
+	Batch     *CheckpointBatch `json:"batch,omitempty"`
+}
+
+// Checkpoint records the progress of a bulk import run in a file, which
+// is the offset of the rows confirmed, the request ids of the batches sent,
+// and the names of the import operations, so that the restarted run skips
+// the confirmed batches, polls the operations in flight again, and
+// continues from where it stopped, see IngestConfig.Checkpoint.
+// The run should read the same source with the same batch size,
+// and the date of the imported data is kept by KeepDate.
+// A nil Checkpoint does nothing
+type Checkpoint struct {
+	path   string
+	source string
+
+	lock      sync.Mutex
+	file      *os.File
+	batchSize int
+	date      string
+	batches   map[string]*CheckpointBatch
+}
+
+// OpenCheckpoint opens the checkpoint file of the source, such as the path of
+// the data file, the progress in it is loaded if the file exists.
+// An error is returned if the file records the progress of another source
+func OpenCheckpoint(path string, source string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		path:    path,
+		source:  source,
+		batches: make(map[string]*CheckpointBatch),
+	}
+	if err := checkpoint.load(); err != nil {
+		return nil, err
+	}
+	if err := checkpoint.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint.file = file
+	return checkpoint, nil
+}
+
+func (c *Checkpoint) load() error {
+	file, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := &checkpointEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			// The last line may be partially written when the process dies
+			continue
+		}
+		switch entry.Op {
+		case checkpointOpStart:
+			if entry.Source != c.source {
+				return fmt.Errorf("checkpoint %s is for %s, not %s", c.path, entry.Source, c.source)
+			}
+			c.batchSize = entry.BatchSize
+			if entry.Date != "" {
+				c.date = entry.Date
+			}
+		case checkpointOpBatch:
+			if entry.Batch != nil {
+				c.batches[entry.Batch.key()] = entry.Batch
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the file to only contain the last progress of each batch
+func (c *Checkpoint) compact() error {
+	tmpPath := c.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	entries := []*checkpointEntry{{Op: checkpointOpStart, Source: c.source, BatchSize: c.batchSize, Date: c.date}}
+	for _, batch := range c.sortedBatches() {
+		entries = append(entries, &checkpointEntry{Op: checkpointOpBatch, Batch: batch})
+	}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+func (c *Checkpoint) sortedBatches() []*CheckpointBatch {
+	batches := make([]*CheckpointBatch, 0, len(c.batches))
+	for _, batch := range c.batches {
+		batches = append(batches, batch)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].FirstRow < batches[j].FirstRow
+	})
+	return batches
+}
+
+// begin checks the batch size is same as the one recorded,
+// the batches can't be matched after restart otherwise
+func (c *Checkpoint) begin(batchSize int) error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	recorded := c.batchSize
+	if recorded != 0 && recorded != batchSize && len(c.batches) > 0 {
+		c.lock.Unlock()
+		return fmt.Errorf("checkpoint %s is recorded with batch size %d, not %d",
+			c.path, recorded, batchSize)
+	}
+	c.batchSize = batchSize
+	date := c.date
+	c.lock.Unlock()
+	if recorded == batchSize {
+		return nil
+	}
+	return c.append(&checkpointEntry{Op: checkpointOpStart, Source: c.source, BatchSize: batchSize, Date: date})
+}
+
+// KeepDate returns the date of the imported data recorded in the checkpoint,
+// so that the restarted run imports the rows with the same date as before.
+// If it is not recorded, date is recorded and returned, or the current time
+// in RFC3339 if date is empty. An error is returned if date is not empty and
+// differs from the recorded one. A nil Checkpoint only fills the empty date
+func (c *Checkpoint) KeepDate(date string) (string, error) {
+	if c == nil {
+		return DataDate(date), nil
+	}
+	c.lock.Lock()
+	recorded, batchSize := c.date, c.batchSize
+	if recorded == "" {
+		date = DataDate(date)
+		c.date = date
+	}
+	c.lock.Unlock()
+	if recorded != "" {
+		if date != "" && date != recorded {
+			return "", fmt.Errorf("checkpoint %s is recorded with date %s, not %s", c.path, recorded, date)
+		}
+		return recorded, nil
+	}
+	return date, c.append(&checkpointEntry{Op: checkpointOpStart, Source: c.source, BatchSize: batchSize, Date: date})
+}
+
+// Offset returns the last row of the confirmed batches from the first
+// row without gap, the rows before it can be skipped without being sent
+func (c *Checkpoint) Offset() int64 {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	offset := int64(0)
+	for _, batch := range c.sortedBatches() {
+		if !batch.Done || batch.FirstRow != offset+1 {
+			break
+		}
+		offset = batch.LastRow
+	}
+	return offset
+}
+
+// Batch returns the progress of the batch of the rows,
+// a new one with a fresh request id if it is not recorded
+func (c *Checkpoint) Batch(firstRow, lastRow int64) *CheckpointBatch {
+	batch := &CheckpointBatch{FirstRow: firstRow, LastRow: lastRow}
+	if c != nil {
+		c.lock.Lock()
+		recorded, ok := c.batches[batch.key()]
+		c.lock.Unlock()
+		if ok {
+			copied := *recorded
+			return &copied
+		}
+	}
+	batch.RequestId = uuid.NewString()
+	return batch
+}
+
+// Save records the progress of the batch, it should be called before
+// the batch is sent, after the operation is created, and after it is confirmed
+func (c *Checkpoint) Save(batch *CheckpointBatch) error {
+	if c == nil {
+		return nil
+	}
+	copied := *batch
+	c.lock.Lock()
+	c.batches[batch.key()] = &copied
+	c.lock.Unlock()
+	return c.append(&checkpointEntry{Op: checkpointOpBatch, Batch: &copied})
+}
+
+func (c *Checkpoint) append(entry *checkpointEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return fmt.Errorf("checkpoint is closed, path:%s", c.path)
+	}
+	if _, err := c.file.Write(line); err != nil {
+		return err
+	}
+	return c.file.Sync()
+}
+
+// Close closes the checkpoint file
+func (c *Checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// DataDate returns the date of the imported data, which
+// is the current time in RFC3339 if date is empty
+func DataDate(date string) string {
+	if date == "" {
+		return time.Now().Format(time.RFC3339)
+	}
+	return date
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func openTestCheckpoint(t *testing.T, path string) *Checkpoint {
+	t.Helper()
+	checkpoint, err := OpenCheckpoint(path, "users.jsonl")
+	if err != nil {
+		t.Fatalf("expect checkpoint opened, got err:%v", err)
+	}
+	return checkpoint
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	checkpoint := openTestCheckpoint(t, path)
+	if err := checkpoint.begin(2); err != nil {
+		t.Fatalf("expect begun, got err:%v", err)
+	}
+	first := checkpoint.Batch(1, 2)
+	if first.RequestId == "" || first.Done {
+		t.Fatalf("expect a fresh batch, got %+v", first)
+	}
+	first.Done = true
+	second := checkpoint.Batch(3, 4)
+	second.Operation = "operations/2"
+	third := checkpoint.Batch(5, 6)
+	third.Done = true
+	for _, batch := range []*CheckpointBatch{first, second, third} {
+		if err := checkpoint.Save(batch); err != nil {
+			t.Fatalf("expect saved, got err:%v", err)
+		}
+	}
+	_ = checkpoint.Close()
+
+	checkpoint = openTestCheckpoint(t, path)
+	defer checkpoint.Close()
+	// The third batch is confirmed, but the second one isn't
+	if offset := checkpoint.Offset(); offset != 2 {
+		t.Fatalf("expect offset 2, got %d", offset)
+	}
+	if batch := checkpoint.Batch(3, 4); batch.RequestId != second.RequestId || batch.Operation != "operations/2" {
+		t.Fatalf("expect the progress of the second batch kept, got %+v", batch)
+	}
+	if batch := checkpoint.Batch(5, 6); !batch.Done {
+		t.Fatalf("expect the third batch done, got %+v", batch)
+	}
+	if err := checkpoint.begin(2); err != nil {
+		t.Fatalf("expect begun with the same batch size, got err:%v", err)
+	}
+	if err := checkpoint.begin(3); err == nil {
+		t.Fatalf("expect error of another batch size")
+	}
+}
+
+func TestCheckpointOfOtherSource(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	_ = openTestCheckpoint(t, path).Close()
+	if _, err := OpenCheckpoint(path, "products.jsonl"); err == nil {
+		t.Fatalf("expect error of another source")
+	}
+}
+
+func TestCheckpointIgnoreTruncatedLastLine(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	checkpoint := openTestCheckpoint(t, path)
+	batch := checkpoint.Batch(1, 2)
+	batch.Done = true
+	if err := checkpoint.Save(batch); err != nil {
+		t.Fatalf("expect saved, got err:%v", err)
+	}
+	_ = checkpoint.Close()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("expect file opened, got err:%v", err)
+	}
+	_, _ = file.WriteString(`{"op":"batch","batch":{"first_row":3,"last`)
+	_ = file.Close()
+
+	checkpoint = openTestCheckpoint(t, path)
+	defer checkpoint.Close()
+	if offset := checkpoint.Offset(); offset != 2 {
+		t.Fatalf("expect offset 2, got %d", offset)
+	}
+}
+
+func TestCheckpointKeepDate(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	checkpoint := openTestCheckpoint(t, path)
+	if err := checkpoint.begin(2); err != nil {
+		t.Fatalf("expect begun, got err:%v", err)
+	}
+	date, err := checkpoint.KeepDate("")
+	if err != nil {
+		t.Fatalf("expect date recorded, got err:%v", err)
+	}
+	if _, err := time.Parse(time.RFC3339, date); err != nil {
+		t.Fatalf("expect the current time in RFC3339, got %s", date)
+	}
+	_ = checkpoint.Close()
+
+	checkpoint = openTestCheckpoint(t, path)
+	defer checkpoint.Close()
+	cases := []struct {
+		date    string
+		invalid bool
+	}{
+		{date: ""},
+		{date: date},
+		{date: "2021-06-15T00:00:00Z", invalid: true},
+	}
+	for _, c := range cases {
+		kept, err := checkpoint.KeepDate(c.date)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("expect error of date %s, got %s", c.date, kept)
+			}
+			continue
+		}
+		if err != nil || kept != date {
+			t.Fatalf("expect the recorded date %s, got %s err:%v", date, kept, err)
+		}
+	}
+	// The batch size recorded before the date is kept
+	if checkpoint.batchSize != 2 {
+		t.Fatalf("expect batch size 2, got %d", checkpoint.batchSize)
+	}
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	var checkpoint *Checkpoint
+	if err := checkpoint.begin(2); err != nil {
+		t.Fatalf("expect nothing done, got err:%v", err)
+	}
+	if offset := checkpoint.Offset(); offset != 0 {
+		t.Fatalf("expect offset 0, got %d", offset)
+	}
+	batch := checkpoint.Batch(1, 2)
+	if batch.RequestId == "" {
+		t.Fatalf("expect a fresh request id")
+	}
+	if err := checkpoint.Save(batch); err != nil {
+		t.Fatalf("expect nothing done, got err:%v", err)
+	}
+	if date, err := checkpoint.KeepDate("2021-06-15T00:00:00Z"); err != nil || date != "2021-06-15T00:00:00Z" {
+		t.Fatalf("expect the date given, got %s err:%v", date, err)
+	}
+	if err := checkpoint.Close(); err != nil {
+		t.Fatalf("expect nothing done, got err:%v", err)
+	}
+}
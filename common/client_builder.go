@@ -0,0 +1,117 @@
+package common
+
+import (
+	"github.com/byteplus-sdk/sdk-go/byteair"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/general"
+	"github.com/byteplus-sdk/sdk-go/media"
+	"github.com/byteplus-sdk/sdk-go/retail"
+	"github.com/byteplus-sdk/sdk-go/retailv2"
+)
+
+// RetailClientBuilder creates the retail.ClientBuilder by the config,
+// the optional settings, such as MetricsConfig, can be set before Build
+func (c *ClientConfig) RetailClientBuilder() *retail.ClientBuilder {
+	builder := &retail.ClientBuilder{}
+	builder.Tenant(c.Tenant).
+		TenantId(c.TenantId).
+		Token(c.Token).
+		Region(c.region())
+	if c.Schema != "" {
+		builder.Schema(c.Schema)
+	}
+	if len(c.Hosts) > 0 {
+		builder.Hosts(c.Hosts)
+	}
+	if len(c.Headers) > 0 {
+		builder.Headers(c.Headers)
+	}
+	return builder
+}
+
+// RetailV2ClientBuilder creates the retailv2.ClientBuilder by the config,
+// the optional settings, such as MetricsConfig, can be set before Build
+func (c *ClientConfig) RetailV2ClientBuilder() *retailv2.ClientBuilder {
+	builder := &retailv2.ClientBuilder{}
+	builder.Tenant(c.Tenant).
+		TenantId(c.TenantId).
+		Token(c.Token).
+		Region(c.region())
+	if c.Schema != "" {
+		builder.Schema(c.Schema)
+	}
+	if len(c.Hosts) > 0 {
+		builder.Hosts(c.Hosts)
+	}
+	if len(c.Headers) > 0 {
+		builder.Headers(c.Headers)
+	}
+	return builder
+}
+
+// MediaClientBuilder creates the media.ClientBuilder by the config,
+// the optional settings, such as MetricsConfig, can be set before Build
+func (c *ClientConfig) MediaClientBuilder() *media.ClientBuilder {
+	builder := &media.ClientBuilder{}
+	builder.Tenant(c.Tenant).
+		TenantId(c.TenantId).
+		Token(c.Token).
+		Region(c.region())
+	if c.Schema != "" {
+		builder.Schema(c.Schema)
+	}
+	if len(c.Hosts) > 0 {
+		builder.Hosts(c.Hosts)
+	}
+	if len(c.Headers) > 0 {
+		builder.Headers(c.Headers)
+	}
+	return builder
+}
+
+// GeneralClientBuilder creates the general.ClientBuilder by the config,
+// the optional settings, such as MetricsConfig, can be set before Build
+func (c *ClientConfig) GeneralClientBuilder() *general.ClientBuilder {
+	builder := &general.ClientBuilder{}
+	builder.Tenant(c.Tenant).
+		TenantId(c.TenantId).
+		Token(c.Token).
+		Region(c.region())
+	if c.Schema != "" {
+		builder.Schema(c.Schema)
+	}
+	if len(c.Hosts) > 0 {
+		builder.Hosts(c.Hosts)
+	}
+	if len(c.Headers) > 0 {
+		builder.Headers(c.Headers)
+	}
+	return builder
+}
+
+// ByteAirClientBuilder creates the byteair.ClientBuilder by the config,
+// the optional settings, such as MetricsConfig, can be set before Build
+func (c *ClientConfig) ByteAirClientBuilder() *byteair.ClientBuilder {
+	builder := &byteair.ClientBuilder{}
+	builder.TenantId(c.TenantId).
+		ProjectId(c.ProjectId).
+		AK(c.AK).
+		SK(c.SK).
+		Region(c.region())
+	if c.Schema != "" {
+		builder.Schema(c.Schema)
+	}
+	if len(c.Hosts) > 0 {
+		builder.Hosts(c.Hosts)
+	}
+	if len(c.Headers) > 0 {
+		builder.Headers(c.Headers)
+	}
+	return builder
+}
+
+// region returns the core.Region of the config, which is checked by Validate
+func (c *ClientConfig) region() core.Region {
+	region, _ := c.CoreRegion()
+	return region
+}
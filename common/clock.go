@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time, RequestHelper uses it to decide
+// when polling the import result should stop
+type Clock interface {
+	Now() time.Time
+}
+
+// Sleeper waits between the retries and the polls of RequestHelper,
+// it should return a *CanceledError as soon as ctx is done
+type Sleeper interface {
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SystemClock is the Clock and Sleeper in real time,
+// which are used when they are not set
+var SystemClock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleepContext(ctx, d)
+}
+
+// JitterSource provides the random numbers in [0, 1) for the backoffs with jitter
+type JitterSource interface {
+	Float64() float64
+}
+
+// NewJitterSource returns a JitterSource seeded by seed, the same seed
+// produces the same sequence of jitters, it is safe for concurrent use
+func NewJitterSource(seed int64) JitterSource {
+	return &lockedSource{rand: rand.New(rand.NewSource(seed))}
+}
+
+type lockedSource struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func (s *lockedSource) Float64() float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rand.Float64()
+}
+
+// globalSource uses the global source of math/rand
+type globalSource struct{}
+
+func (globalSource) Float64() float64 {
+	return rand.Float64()
+}
+
+func jitterSource(source JitterSource) JitterSource {
+	if source == nil {
+		return globalSource{}
+	}
+	return source
+}
@@ -0,0 +1,482 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultConsumerCount = 5
+
+	defaultConcurrentRetryTimes = 2
+)
+
+// ConcurrentHelperConfig is the configuration of ConcurrentHelper,
+// the zero value of each field means using the default value
+type ConcurrentHelperConfig struct {
+	// The count of goroutines executing the submitted requests, default is 5
+	ConsumerCount int
+
+	// The retry times of each submitted request, default is 2,
+	// it is ignored if RequestHelper.RetryPolicy.MaxAttempts is set
+	RetryTimes int
+
+	// The count of submitted tasks can be queued when all the consumers
+	// are busy, default is 0, which means a task can only be submitted
+	// when there is a free consumer
+	QueueCapacity int
+
+	// Backpressure decides what to do when submitting to a full queue,
+	// default is BackpressureBlock
+	Backpressure BackpressurePolicy
+
+	// The maximum time waiting for the queue to have space,
+	// only used by BackpressureBlockWithTimeout
+	SubmitTimeout time.Duration
+
+	// DeadLetterSink stores the requests which ultimately fail, or are
+	// dropped or abandoned before sent, they are only logged if it is nil
+	DeadLetterSink DeadLetterSink
+
+	// WAL keeps the submissions not complete on disk, so that they can be
+	// submitted again after the process crashes, it is disabled if nil.
+	// The Request of submission should be serializable to enable it
+	WAL *WAL
+
+	// Clock and Sleeper replace the ones of RequestHelper for the requests
+	// executed by the helper, Clock also decides the time of dead letters.
+	// Default is the ones of RequestHelper
+	Clock   Clock
+	Sleeper Sleeper
+}
+
+// BackpressurePolicy decides what ConcurrentHelper.Submit does
+// when the queue is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks the submit until the queue has space
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureBlockWithTimeout blocks the submit at most
+	// ConcurrentHelperConfig.SubmitTimeout, then ErrQueueFull is returned
+	BackpressureBlockWithTimeout
+
+	// BackpressureFailFast returns ErrQueueFull immediately
+	BackpressureFailFast
+
+	// BackpressureDropOldest drops the oldest task in the queue to make room,
+	// the Handler of the dropped task is called and its Future is completed
+	// with ErrTaskDropped, and the task is marked complete in WAL.
+	// It works as BackpressureBlock if QueueCapacity is 0
+	BackpressureDropOldest
+)
+
+// Submission is a request executed asynchronously by ConcurrentHelper
+type Submission struct {
+	// API is the name of the request, such as APIWriteUsers,
+	// used in logs and to select the RateLimiter
+	API string
+
+	// Call sends the Request to server
+	Call Call
+
+	Request interface{}
+
+	Opts []option.Option
+
+	// ImportResponse receives the result of the import task.
+	// If it is not nil, the Request is executed by RequestHelper.DoImport,
+	// otherwise by RequestHelper.DoWithRetry
+	ImportResponse proto.Message
+
+	// Handler receives the result of the Request,
+	// the result is only logged if it is nil
+	Handler ResultHandler
+
+	// Meta is the extra arguments of Call besides the Request, such as the
+	// "topic" of WriteData, it is kept in the DeadLetter for replaying
+	Meta map[string]string
+}
+
+// ResultHandler receives the response of the submission,
+// err is not nil if the request can't be sent successfully
+type ResultHandler func(response proto.Message, err error)
+
+// ErrHelperClosed is returned when submitting to a ConcurrentHelper,
+// which has been closed or is shutting down
+var ErrHelperClosed = errors.New("concurrent helper is closed")
+
+// ErrQueueFull is returned when submitting to a full queue,
+// if the backpressure policy is fail fast or block with timeout
+var ErrQueueFull = errors.New("concurrent helper queue is full")
+
+// ErrTaskDropped completes the Future of the oldest task in queue, which
+// is dropped for the new submission by BackpressureDropOldest
+var ErrTaskDropped = errors.New("task dropped for newer submission")
+
+// ErrTaskAbandoned completes the Future of the submission,
+// which is not executed before the deadline of shutdown
+var ErrTaskAbandoned = errors.New("task abandoned by shutdown")
+
+type task struct {
+	submission *Submission
+	handler    ResultHandler
+	future     *Future
+}
+
+// ConcurrentHelper executes the submitted requests by a fixed count of
+// consumer goroutines, it is shared by all the verticals, which only need
+// to turn their requests to Submission
+type ConcurrentHelper struct {
+	requestHelper *RequestHelper
+	retryTimes    int
+	taskChan      chan *task
+	backpressure  BackpressurePolicy
+	submitTimeout time.Duration
+	deadLetters   DeadLetterSink
+	wal           *WAL
+
+	// ctx is canceled when the shutdown deadline is exceeded,
+	// which stops the retrying of executing tasks
+	ctx       context.Context
+	cancel    context.CancelFunc
+	consumers sync.WaitGroup
+
+	// closing is closed first when shutdown, to wake up the blocked submits,
+	// and the taskChan can be closed after all the submits return
+	closing     chan struct{}
+	closeOnce   sync.Once
+	submitLock  sync.RWMutex
+	abandonLock sync.Mutex
+	abandoned   []*Future
+}
+
+func NewConcurrentHelper(requestHelper *RequestHelper, config *ConcurrentHelperConfig) *ConcurrentHelper {
+	if config == nil {
+		config = &ConcurrentHelperConfig{}
+	}
+	consumerCount := config.ConsumerCount
+	if consumerCount <= 0 {
+		consumerCount = defaultConsumerCount
+	}
+	retryTimes := config.RetryTimes
+	if retryTimes <= 0 {
+		retryTimes = defaultConcurrentRetryTimes
+	}
+	queueCapacity := config.QueueCapacity
+	if queueCapacity < 0 {
+		queueCapacity = 0
+	}
+	if config.Clock != nil || config.Sleeper != nil {
+		helper := *requestHelper
+		if config.Clock != nil {
+			helper.Clock = config.Clock
+		}
+		if config.Sleeper != nil {
+			helper.Sleeper = config.Sleeper
+		}
+		requestHelper = &helper
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &ConcurrentHelper{
+		requestHelper: requestHelper,
+		retryTimes:    retryTimes,
+		taskChan:      make(chan *task, queueCapacity),
+		backpressure:  config.Backpressure,
+		submitTimeout: config.SubmitTimeout,
+		deadLetters:   config.DeadLetterSink,
+		wal:           config.WAL,
+		ctx:           ctx,
+		cancel:        cancel,
+		closing:       make(chan struct{}),
+	}
+	h.consumers.Add(consumerCount)
+	for i := 0; i < consumerCount; i++ {
+		core.AsyncExecute(h.consume)
+	}
+	return h
+}
+
+func (h *ConcurrentHelper) consume() {
+	defer h.consumers.Done()
+	// Exit after the taskChan is closed and all the tasks in it are taken
+	for t := range h.taskChan {
+		if h.ctx.Err() != nil {
+			h.abandon(t, ErrTaskAbandoned)
+			continue
+		}
+		response, err := h.execute(t.submission)
+		if IsCanceledError(err) {
+			h.abandon(t, err)
+			continue
+		}
+		if err != nil {
+			h.putDeadLetter(t.submission, err)
+		} else if status := getResponseStatus(response); status != nil && !isAcceptedStatus(status) {
+			h.putDeadLetter(t.submission, fmt.Errorf("server return failure info, status:%s", status))
+		} else {
+			h.completeWAL(t.submission)
+		}
+		t.handler(response, err)
+		t.future.complete(response, err)
+	}
+}
+
+// isAcceptedStatus tells whether the server accepts the request,
+// the request rejected for idempotent has been accepted before
+func isAcceptedStatus(status *Status) bool {
+	return IsSuccess(status) || IsUploadSuccess(status)
+}
+
+// putDeadLetter keeps the failed submission by the DeadLetterSink if it is set,
+// and marks it complete in WAL, so that it isn't submitted again on startup,
+// which may repeat a non-idempotent write. It is still pending in WAL only
+// if the DeadLetterSink fails to keep it
+func (h *ConcurrentHelper) putDeadLetter(submission *Submission, err error) {
+	if h.deadLetters == nil {
+		h.completeWAL(submission)
+		return
+	}
+	letter, marshalErr := NewDeadLetter(submission.API, submission.Request, submission.Opts, submission.Meta, err)
+	if marshalErr != nil {
+		logs.Error("[Async%s] serialize dead letter fail, msg:%s", submission.API, marshalErr.Error())
+		h.completeWAL(submission)
+		return
+	}
+	letter.Time = h.requestHelper.now()
+	if putErr := h.deadLetters.Put(letter); putErr != nil {
+		logs.Error("[Async%s] put dead letter fail, msg:%s", submission.API, putErr.Error())
+		return
+	}
+	h.completeWAL(submission)
+}
+
+func (h *ConcurrentHelper) completeWAL(submission *Submission) {
+	if err := h.wal.appendComplete(getRequestId(submission.Opts)); err != nil {
+		logs.Error("[Async%s] mark complete in wal fail, msg:%s", submission.API, err.Error())
+	}
+}
+
+func (h *ConcurrentHelper) appendWAL(submission *Submission) error {
+	if h.wal == nil {
+		return nil
+	}
+	entry, err := NewDeadLetter(submission.API, submission.Request, submission.Opts, submission.Meta, nil)
+	if err != nil {
+		return err
+	}
+	return h.wal.appendSubmit(entry)
+}
+
+// abandon completes the task abandoned by shutdown, which is kept by the dead
+// letter if the DeadLetterSink is set, otherwise it is still pending in WAL,
+// and will be submitted again on startup
+func (h *ConcurrentHelper) abandon(t *task, err error) {
+	logs.Warn("[Async%s] abandoned, msg:%s", t.submission.API, err.Error())
+	if h.deadLetters != nil {
+		h.putDeadLetter(t.submission, err)
+	}
+	t.handler(nil, err)
+	t.future.complete(nil, err)
+	h.abandonLock.Lock()
+	h.abandoned = append(h.abandoned, t.future)
+	h.abandonLock.Unlock()
+}
+
+// drop completes the task dropped by BackpressureDropOldest, which is
+// kept by the dead letter if the DeadLetterSink is set, and won't be
+// submitted again from the WAL on startup
+func (h *ConcurrentHelper) drop(t *task) {
+	logs.Warn("[Async%s] dropped for queue full", t.submission.API)
+	h.putDeadLetter(t.submission, ErrTaskDropped)
+	t.handler(nil, ErrTaskDropped)
+	t.future.complete(nil, ErrTaskDropped)
+}
+
+// Submit tasks.
+// If all the consumers are busy, the task waits in the queue, and what to
+// do when the queue is full depends on the configured BackpressurePolicy,
+// by default the submit will be blocked until one of the tasks is taken.
+// The returned Future is completed after the Handler of submission is called,
+// it can be waited for the response of server.
+// If WAL is configured, the submission is kept by it before Submit returns.
+// ErrHelperClosed is returned after Shutdown or Close is called.
+// It is recommended to increase the data amount contained in a single request.
+// It is not recommended to use too many concurrent imports,
+// which may lead to server overload and limit the flow of the request
+func (h *ConcurrentHelper) Submit(submission *Submission) (*Future, error) {
+	if submission == nil || submission.Call == nil {
+		return nil, errors.New("submission without call")
+	}
+	handler := submission.Handler
+	if handler == nil {
+		handler = logResultHandler(submission.API)
+	}
+	if getRequestId(submission.Opts) == "" {
+		// Fix the request id before sending, so that it is known by
+		// the dead letter, and the replay is treated as the same request
+		withId := *submission
+		withId.Opts = append(append([]option.Option(nil), submission.Opts...),
+			option.WithRequestId(uuid.NewString()))
+		submission = &withId
+	}
+	t := &task{
+		submission: submission,
+		handler:    handler,
+		future:     newFuture(submission.Request),
+	}
+	h.submitLock.RLock()
+	defer h.submitLock.RUnlock()
+	select {
+	case <-h.closing:
+		return nil, ErrHelperClosed
+	default:
+	}
+	// The submission is accepted after it is kept by WAL
+	if err := h.appendWAL(submission); err != nil {
+		return nil, err
+	}
+	if err := h.enqueue(t); err != nil {
+		h.completeWAL(submission)
+		return nil, err
+	}
+	return t.future, nil
+}
+
+func (h *ConcurrentHelper) enqueue(t *task) error {
+	switch h.backpressure {
+	case BackpressureFailFast:
+		select {
+		case h.taskChan <- t:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	case BackpressureBlockWithTimeout:
+		timer := time.NewTimer(h.submitTimeout)
+		defer timer.Stop()
+		select {
+		case h.taskChan <- t:
+			return nil
+		case <-h.closing:
+			return ErrHelperClosed
+		case <-timer.C:
+			return ErrQueueFull
+		}
+	case BackpressureDropOldest:
+		if cap(h.taskChan) == 0 {
+			break
+		}
+		for {
+			select {
+			case h.taskChan <- t:
+				return nil
+			default:
+			}
+			// The oldest task may be taken by consumer at the same time,
+			// so try again whether or not a task is dropped
+			select {
+			case oldest := <-h.taskChan:
+				h.drop(oldest)
+			default:
+			}
+		}
+	}
+	select {
+	case h.taskChan <- t:
+		return nil
+	case <-h.closing:
+		return ErrHelperClosed
+	}
+}
+
+// QueueDepth returns the count of tasks waiting in the queue
+func (h *ConcurrentHelper) QueueDepth() int {
+	return len(h.taskChan)
+}
+
+// QueueCapacity returns the maximum count of tasks can wait in the queue
+func (h *ConcurrentHelper) QueueCapacity() int {
+	return cap(h.taskChan)
+}
+
+// Shutdown stops accepting new submissions, and waits until all the
+// submitted tasks complete, including the ones not started yet.
+// If ctx is done before that, the retrying of the executing tasks is
+// stopped, and the tasks not started are abandoned, whose Handlers are
+// called and Futures are completed with ErrTaskAbandoned or *CanceledError.
+// All the abandoned Futures are returned, with the ctx.Err().
+// Shutdown always waits for the executing calls to return, so it is safe
+// to release the client after Shutdown returns.
+func (h *ConcurrentHelper) Shutdown(ctx context.Context) ([]*Future, error) {
+	h.closeOnce.Do(func() {
+		close(h.closing)
+		// Wait for the blocked submits to return before closing taskChan
+		h.submitLock.Lock()
+		close(h.taskChan)
+		h.submitLock.Unlock()
+	})
+	finished := make(chan struct{})
+	go func() {
+		h.consumers.Wait()
+		close(finished)
+	}()
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+		h.cancel()
+		<-finished
+	}
+	h.abandonLock.Lock()
+	defer h.abandonLock.Unlock()
+	return append([]*Future(nil), h.abandoned...), err
+}
+
+// Close stops accepting new submissions,
+// and waits until all the submitted tasks complete
+func (h *ConcurrentHelper) Close() {
+	_, _ = h.Shutdown(context.Background())
+}
+
+func (h *ConcurrentHelper) execute(submission *Submission) (proto.Message, error) {
+	call := submission.Call.WithContext()
+	// Limit the rate by the RateLimiter of the api in RequestHelper
+	ctx := WithAPI(h.ctx, submission.API)
+	if submission.ImportResponse == nil {
+		return h.requestHelper.DoWithRetryContext(ctx, call,
+			submission.Request, submission.Opts, h.retryTimes)
+	}
+	err := h.requestHelper.DoImportContext(ctx, call, submission.Request,
+		submission.ImportResponse, submission.Opts, h.retryTimes)
+	if err != nil {
+		return nil, err
+	}
+	return submission.ImportResponse, nil
+}
+
+func logResultHandler(api string) ResultHandler {
+	return func(response proto.Message, err error) {
+		if err != nil {
+			logs.Error("[Async%s] occur error, msg:%s", api, err.Error())
+			return
+		}
+		if IsSuccessResponse(response) {
+			logs.Info("[Async%s] success", api)
+			return
+		}
+		logs.Error("[Async%s] fail, rsp:\n%s", api, response)
+	}
+}
@@ -0,0 +1,294 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+// blockingCall blocks until release is closed, started
+// receives a value when the call is executed
+type blockingCall struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingCall() *blockingCall {
+	return &blockingCall{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (c *blockingCall) call(_ interface{}, _ ...option.Option) (proto.Message, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return &OperationResponse{Status: &Status{}}, nil
+}
+
+// handlerRecorder records the errors passed to the handlers of submissions
+type handlerRecorder struct {
+	lock sync.Mutex
+	errs []error
+}
+
+func (r *handlerRecorder) handler(_ proto.Message, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *handlerRecorder) handledErrs() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+func TestConcurrentHelperCloseDrainQueue(t *testing.T) {
+	helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{ConsumerCount: 1, QueueCapacity: 5})
+	recorder := &handlerRecorder{}
+	call := newFakeCall(status(0))
+	var futures []*Future
+	for i := 0; i < 5; i++ {
+		future, err := helper.Submit(&Submission{API: APIWriteUsers, Call: call.call, Handler: recorder.handler})
+		if err != nil {
+			t.Fatalf("expect submitted, got err:%v", err)
+		}
+		futures = append(futures, future)
+	}
+	helper.Close()
+	for _, future := range futures {
+		if _, err := future.Wait(); err != nil {
+			t.Fatalf("expect the queued task is executed before close, got err:%v", err)
+		}
+	}
+	if errs := recorder.handledErrs(); len(errs) != 5 {
+		t.Fatalf("expect 5 handled results, got %v", errs)
+	}
+	if _, err := helper.Submit(&Submission{API: APIWriteUsers, Call: call.call}); !errors.Is(err, ErrHelperClosed) {
+		t.Fatalf("expect ErrHelperClosed after close, got err:%v", err)
+	}
+}
+
+func TestConcurrentHelperShutdownAbandonQueuedTasks(t *testing.T) {
+	helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{ConsumerCount: 1, QueueCapacity: 3})
+	recorder := &handlerRecorder{}
+	executing := newBlockingCall()
+	first, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call, Handler: recorder.handler})
+	if err != nil {
+		t.Fatalf("expect submitted, got err:%v", err)
+	}
+	<-executing.started
+	queued := newFakeCall(status(0))
+	for i := 0; i < 3; i++ {
+		if _, err := helper.Submit(&Submission{API: APIWriteUsers, Call: queued.call, Handler: recorder.handler}); err != nil {
+			t.Fatalf("expect submitted, got err:%v", err)
+		}
+	}
+	// The executing call returns after the shutdown deadline
+	time.AfterFunc(100*time.Millisecond, func() { close(executing.release) })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	abandoned, err := helper.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got err:%v", err)
+	}
+	if len(abandoned) != 3 {
+		t.Fatalf("expect 3 abandoned tasks, got %d", len(abandoned))
+	}
+	for _, future := range abandoned {
+		if _, err := future.Wait(); !errors.Is(err, ErrTaskAbandoned) {
+			t.Fatalf("expect ErrTaskAbandoned, got err:%v", err)
+		}
+	}
+	if _, err := first.Wait(); err != nil {
+		t.Fatalf("expect the executing call is waited, got err:%v", err)
+	}
+	if attempts := queued.attempts(); attempts != 0 {
+		t.Fatalf("expect the abandoned tasks are not executed, got %d attempts", attempts)
+	}
+	errs := recorder.handledErrs()
+	if len(errs) != 4 {
+		t.Fatalf("expect the handlers of all the tasks are called, got %v", errs)
+	}
+	abandonedErrs := 0
+	for _, err := range errs {
+		if errors.Is(err, ErrTaskAbandoned) {
+			abandonedErrs++
+		}
+	}
+	if abandonedErrs != 3 {
+		t.Fatalf("expect 3 handlers called with ErrTaskAbandoned, got %v", errs)
+	}
+}
+
+// fillQueue submits a blocking task taken by the only consumer, then fills the
+// queue, so that the next submit meets a full queue
+func fillQueue(t *testing.T, helper *ConcurrentHelper, executing *blockingCall,
+	handler ResultHandler, request interface{}) *Future {
+	if _, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call}); err != nil {
+		t.Fatalf("expect submitted, got err:%v", err)
+	}
+	<-executing.started
+	queued, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call,
+		Request: request, Handler: handler})
+	if err != nil {
+		t.Fatalf("expect queued, got err:%v", err)
+	}
+	if depth := helper.QueueDepth(); depth != helper.QueueCapacity() {
+		t.Fatalf("expect full queue, got depth %d", depth)
+	}
+	return queued
+}
+
+func TestConcurrentHelperBackpressureQueueFull(t *testing.T) {
+	cases := []struct {
+		name         string
+		backpressure BackpressurePolicy
+		// The minimum time of blocking before ErrQueueFull is returned
+		minBlocked time.Duration
+	}{
+		{name: "fail fast", backpressure: BackpressureFailFast},
+		{name: "block with timeout", backpressure: BackpressureBlockWithTimeout, minBlocked: 50 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{
+				ConsumerCount: 1,
+				QueueCapacity: 1,
+				Backpressure:  c.backpressure,
+				SubmitTimeout: c.minBlocked,
+			})
+			executing := newBlockingCall()
+			fillQueue(t, helper, executing, nil, nil)
+			start := time.Now()
+			_, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call})
+			if !errors.Is(err, ErrQueueFull) {
+				t.Fatalf("expect ErrQueueFull, got err:%v", err)
+			}
+			if blocked := time.Since(start); blocked < c.minBlocked {
+				t.Fatalf("expect blocked at least %s, got %s", c.minBlocked, blocked)
+			}
+			close(executing.release)
+			helper.Close()
+		})
+	}
+}
+
+func TestConcurrentHelperBackpressureBlock(t *testing.T) {
+	helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{ConsumerCount: 1, QueueCapacity: 1})
+	executing := newBlockingCall()
+	fillQueue(t, helper, executing, nil, nil)
+	submitted := make(chan error, 1)
+	go func() {
+		_, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call})
+		submitted <- err
+	}()
+	select {
+	case err := <-submitted:
+		t.Fatalf("expect submit blocked by full queue, got err:%v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(executing.release)
+	if err := <-submitted; err != nil {
+		t.Fatalf("expect submitted after the queue has space, got err:%v", err)
+	}
+	helper.Close()
+}
+
+func TestConcurrentHelperBackpressureDropOldest(t *testing.T) {
+	walPath := t.TempDir() + "/submissions.wal"
+	wal, _, err := OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expect wal opened, got err:%v", err)
+	}
+	helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{
+		ConsumerCount: 1,
+		QueueCapacity: 1,
+		Backpressure:  BackpressureDropOldest,
+		WAL:           wal,
+	})
+	executing := newBlockingCall()
+	recorder := &handlerRecorder{}
+	oldest := fillQueue(t, helper, executing, recorder.handler, &Status{Message: "oldest"})
+	newest, err := helper.Submit(&Submission{API: APIWriteUsers, Call: executing.call,
+		Request: &Status{Message: "newest"}})
+	if err != nil {
+		t.Fatalf("expect submitted by dropping the oldest, got err:%v", err)
+	}
+	if _, err := oldest.Wait(); !errors.Is(err, ErrTaskDropped) {
+		t.Fatalf("expect the oldest is dropped, got err:%v", err)
+	}
+	if errs := recorder.handledErrs(); len(errs) != 1 || !errors.Is(errs[0], ErrTaskDropped) {
+		t.Fatalf("expect the handler of the oldest called with ErrTaskDropped, got %v", errs)
+	}
+	close(executing.release)
+	if _, err := newest.Wait(); err != nil {
+		t.Fatalf("expect the newest is executed, got err:%v", err)
+	}
+	helper.Close()
+	_ = wal.Close()
+	// The dropped submission is complete, and won't be submitted again
+	_, pending, err := OpenWAL(walPath)
+	if err != nil {
+		t.Fatalf("expect wal opened again, got err:%v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expect no pending submission, got %d", len(pending))
+	}
+}
+
+// deadLetterSinkFunc puts the dead letters by the func
+type deadLetterSinkFunc func(letter *DeadLetter) error
+
+func (f deadLetterSinkFunc) Put(letter *DeadLetter) error {
+	return f(letter)
+}
+
+func TestConcurrentHelperCompleteFailedSubmissionInWAL(t *testing.T) {
+	cases := []struct {
+		name string
+		sink DeadLetterSink
+		// Whether the failed submission is still pending in WAL
+		pending bool
+	}{
+		{name: "without dead letter sink"},
+		{name: "kept by dead letter sink", sink: deadLetterSinkFunc(func(*DeadLetter) error { return nil })},
+		{name: "dead letter sink fails", pending: true,
+			sink: deadLetterSinkFunc(func(*DeadLetter) error { return errors.New("disk full") })},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			walPath := t.TempDir() + "/submissions.wal"
+			wal, _, err := OpenWAL(walPath)
+			if err != nil {
+				t.Fatalf("expect wal opened, got err:%v", err)
+			}
+			helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{
+				ConsumerCount:  1,
+				DeadLetterSink: c.sink,
+				WAL:            wal,
+			})
+			call := newFakeCall(fail(errBadRequest))
+			future, err := helper.Submit(&Submission{API: APIWriteUsers, Call: call.call, Request: &Status{}})
+			if err != nil {
+				t.Fatalf("expect submitted, got err:%v", err)
+			}
+			if _, err := future.Wait(); !errors.Is(err, errBadRequest) {
+				t.Fatalf("expect the submission fails, got err:%v", err)
+			}
+			helper.Close()
+			_ = wal.Close()
+			_, pending, err := OpenWAL(walPath)
+			if err != nil {
+				t.Fatalf("expect wal opened again, got err:%v", err)
+			}
+			if len(pending) > 0 != c.pending {
+				t.Fatalf("expect pending %v, got %d pending submissions", c.pending, len(pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"gopkg.in/yaml.v3"
+)
+
+// The verticals of the examples, which decide the required fields and the default region
+const (
+	VerticalRetail   = "retail"
+	VerticalRetailV2 = "retailv2"
+	VerticalMedia    = "media"
+	VerticalGeneral  = "general"
+	VerticalByteAir  = "byteair"
+)
+
+// The environment variables read by LoadClientConfig, which override the config file
+const (
+	// ConfigFileEnv is the path of the config file, "config.yaml", "config.yml"
+	// or "config.toml" in the working directory is used if it is not set
+	ConfigFileEnv = "BYTEPLUS_CONFIG"
+
+	// ProfileEnv selects the profile in the config file, such as "staging"
+	ProfileEnv = "BYTEPLUS_PROFILE"
+
+	TenantEnv    = "BYTEPLUS_TENANT"
+	TenantIdEnv  = "BYTEPLUS_TENANT_ID"
+	TokenEnv     = "BYTEPLUS_TOKEN"
+	ProjectIdEnv = "BYTEPLUS_PROJECT_ID"
+	AKEnv        = "BYTEPLUS_AK"
+	SKEnv        = "BYTEPLUS_SK"
+
+	// RegionEnv is one of sg, cn, us, air_cn and air_sg
+	RegionEnv = "BYTEPLUS_REGION"
+	SchemaEnv = "BYTEPLUS_SCHEMA"
+
+	// HostsEnv is the hosts separated by ",", such as "host1,host2"
+	HostsEnv = "BYTEPLUS_HOSTS"
+
+	// HeadersEnv is the headers in the form of "key1=value1,key2=value2"
+	HeadersEnv = "BYTEPLUS_HEADERS"
+
+	// MockHostEnv is the address of the local mock server, such as "127.0.0.1:8080",
+	// the requests are sent to it by http instead of the real server when it is set,
+	// see package mockserver
+	MockHostEnv = "BYTEPLUS_MOCK_HOST"
+)
+
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+var regions = map[string]core.Region{
+	"sg":     core.RegionSg,
+	"cn":     core.RegionCn,
+	"us":     core.RegionUs,
+	"air_cn": core.RegionAirCn,
+	"air_sg": core.RegionAirSg,
+}
+
+var defaultRegions = map[string]string{
+	VerticalRetail:   "sg",
+	VerticalRetailV2: "sg",
+	VerticalMedia:    "sg",
+	VerticalGeneral:  "cn",
+	VerticalByteAir:  "air_cn",
+}
+
+// ClientConfig is the credentials and the endpoint of a client,
+// the ClientBuilder of each vertical is created by it, such as RetailClientBuilder
+type ClientConfig struct {
+	// Tenant is a unique identity assigned by Bytedance, which is need to fill in URL.
+	// It is sometimes called "company"
+	Tenant string `json:"tenant,omitempty" yaml:"tenant,omitempty" toml:"tenant,omitempty"`
+
+	// TenantId is a unique ID assigned by Bytedance, which is used to generate
+	// an authenticated signature when building a request.
+	// It is sometimes called "appkey"
+	TenantId string `json:"tenant_id,omitempty" yaml:"tenant_id,omitempty" toml:"tenant_id,omitempty"`
+
+	// Token is a unique token assigned by bytedance, which is used to generate
+	// an authenticated signature when building a request.
+	// It is sometimes called "secret"
+	Token string `json:"token,omitempty" yaml:"token,omitempty" toml:"token,omitempty"`
+
+	// ProjectId, AK and SK are only used by byteair, AK and SK are
+	// generated in the key management of the recommendation platform
+	ProjectId string `json:"project_id,omitempty" yaml:"project_id,omitempty" toml:"project_id,omitempty"`
+	AK        string `json:"ak,omitempty" yaml:"ak,omitempty" toml:"ak,omitempty"`
+	SK        string `json:"sk,omitempty" yaml:"sk,omitempty" toml:"sk,omitempty"`
+
+	// Region is one of sg, cn, us, air_cn and air_sg,
+	// the default one of the vertical is used if it is empty
+	Region string `json:"region,omitempty" yaml:"region,omitempty" toml:"region,omitempty"`
+
+	// Schema and Hosts replace the default ones of the region if they are set
+	Schema string   `json:"schema,omitempty" yaml:"schema,omitempty" toml:"schema,omitempty"`
+	Hosts  []string `json:"hosts,omitempty" yaml:"hosts,omitempty" toml:"hosts,omitempty"`
+
+	// Headers are added to each request
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+}
+
+// configFile is the content of the config file, the fields of the
+// selected profile override the ones at the top level, e.g.
+//
+//	region: sg
+//	profile: staging
+//	profiles:
+//	  staging:
+//	    tenant: retail_demo_staging
+//	    tenant_id: "xxxxxxxxxxxx"
+//	    token: xxxxxxxxxxxxxxxxxxxxx
+//	  production:
+//	    tenant: retail_demo
+//	    ...
+type configFile struct {
+	ClientConfig `yaml:",inline"`
+
+	// Profile is the profile used if BYTEPLUS_PROFILE is not set
+	Profile  string                   `yaml:"profile,omitempty" toml:"profile,omitempty"`
+	Profiles map[string]*ClientConfig `yaml:"profiles,omitempty" toml:"profiles,omitempty"`
+}
+
+// ConfigLoader loads the ClientConfig from the config file and the environment
+// variables, the later one overrides the former one in the order of:
+//
+//	the default region of vertical
+//	the top level of config file
+//	the profile of config file
+//	the environment variables, such as BYTEPLUS_TOKEN
+//	the local mock server, see MockHostEnv
+type ConfigLoader struct {
+	// Path is the path of config file, BYTEPLUS_CONFIG is used if it is empty
+	Path string
+
+	// Profile is the profile selected, BYTEPLUS_PROFILE is used if it is empty
+	Profile string
+
+	// LookupEnv reads the environment variables, default is os.LookupEnv
+	LookupEnv func(key string) (string, bool)
+}
+
+// LoadClientConfig loads the ClientConfig of the vertical by the default ConfigLoader
+func LoadClientConfig(vertical string) (*ClientConfig, error) {
+	return (&ConfigLoader{}).Load(vertical)
+}
+
+// Load loads the ClientConfig of the vertical, and validates the required fields of it
+func (l *ConfigLoader) Load(vertical string) (*ClientConfig, error) {
+	if _, ok := defaultRegions[vertical]; !ok {
+		return nil, fmt.Errorf("unknown vertical:%s", vertical)
+	}
+	config := &ClientConfig{Region: defaultRegions[vertical]}
+	file, err := l.readFile()
+	if err != nil {
+		return nil, err
+	}
+	profile := l.Profile
+	if profile == "" {
+		profile = l.getenv(ProfileEnv)
+	}
+	if file != nil {
+		config.merge(&file.ClientConfig)
+		if profile == "" {
+			profile = file.Profile
+		}
+	}
+	if profile != "" {
+		var profileConfig *ClientConfig
+		if file != nil {
+			profileConfig = file.Profiles[profile]
+		}
+		if profileConfig == nil {
+			return nil, fmt.Errorf("profile %s is not found in config file", profile)
+		}
+		config.merge(profileConfig)
+	}
+	envConfig, err := l.envConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.merge(envConfig)
+	if host, ok := l.mockHost(); ok {
+		config.mock(vertical, host)
+	}
+	if err := config.Validate(vertical); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (l *ConfigLoader) getenv(key string) string {
+	lookupEnv := l.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	value, _ := lookupEnv(key)
+	return strings.TrimSpace(value)
+}
+
+func (l *ConfigLoader) mockHost() (string, bool) {
+	host := l.getenv(MockHostEnv)
+	return host, host != ""
+}
+
+// readFile reads the config file, nil is returned if no config file is found
+func (l *ConfigLoader) readFile() (*configFile, error) {
+	path := l.Path
+	if path == "" {
+		path = l.getenv(ConfigFileEnv)
+	}
+	if path == "" {
+		for _, defaultPath := range defaultConfigFiles {
+			if _, err := os.Stat(defaultPath); err == nil {
+				path = defaultPath
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &configFile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, file)
+	default:
+		return nil, fmt.Errorf("unsupported config file:%s, it should be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file fail, path:%s msg:%s", path, err.Error())
+	}
+	return file, nil
+}
+
+func (l *ConfigLoader) envConfig() (*ClientConfig, error) {
+	config := &ClientConfig{
+		Tenant:    l.getenv(TenantEnv),
+		TenantId:  l.getenv(TenantIdEnv),
+		Token:     l.getenv(TokenEnv),
+		ProjectId: l.getenv(ProjectIdEnv),
+		AK:        l.getenv(AKEnv),
+		SK:        l.getenv(SKEnv),
+		Region:    l.getenv(RegionEnv),
+		Schema:    l.getenv(SchemaEnv),
+	}
+	if hosts := l.getenv(HostsEnv); hosts != "" {
+		for _, host := range strings.Split(hosts, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				config.Hosts = append(config.Hosts, host)
+			}
+		}
+	}
+	if headers := l.getenv(HeadersEnv); headers != "" {
+		config.Headers = make(map[string]string)
+		for _, header := range strings.Split(headers, ",") {
+			kv := strings.SplitN(header, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, fmt.Errorf("invalid %s:%s, it should be key1=value1,key2=value2", HeadersEnv, headers)
+			}
+			config.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return config, nil
+}
+
+// merge overrides the fields with the non-empty ones of other,
+// the headers are merged by key
+func (c *ClientConfig) merge(other *ClientConfig) {
+	overrideString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	overrideString(&c.Tenant, other.Tenant)
+	overrideString(&c.TenantId, other.TenantId)
+	overrideString(&c.Token, other.Token)
+	overrideString(&c.ProjectId, other.ProjectId)
+	overrideString(&c.AK, other.AK)
+	overrideString(&c.SK, other.SK)
+	overrideString(&c.Region, other.Region)
+	overrideString(&c.Schema, other.Schema)
+	if len(other.Hosts) > 0 {
+		c.Hosts = other.Hosts
+	}
+	if len(other.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers)+len(other.Headers))
+		for key, value := range c.Headers {
+			headers[key] = value
+		}
+		for key, value := range other.Headers {
+			headers[key] = value
+		}
+		c.Headers = headers
+	}
+}
+
+// mock points the config to the local mock server, which doesn't check
+// the credentials, so the missing required fields are filled with "mock"
+func (c *ClientConfig) mock(vertical string, host string) {
+	c.Schema = "http"
+	c.Hosts = []string{host}
+	for _, field := range c.requiredFields(vertical) {
+		if *field.value == "" {
+			*field.value = "mock"
+		}
+	}
+}
+
+type configField struct {
+	name  string
+	value *string
+}
+
+func (c *ClientConfig) requiredFields(vertical string) []configField {
+	if vertical == VerticalByteAir {
+		return []configField{
+			{"tenant_id", &c.TenantId},
+			{"project_id", &c.ProjectId},
+			{"ak", &c.AK},
+			{"sk", &c.SK},
+		}
+	}
+	return []configField{
+		{"tenant", &c.Tenant},
+		{"tenant_id", &c.TenantId},
+		{"token", &c.Token},
+	}
+}
+
+// Validate checks the required fields of the vertical are set, and the region is known
+func (c *ClientConfig) Validate(vertical string) error {
+	var missing []string
+	for _, field := range c.requiredFields(vertical) {
+		if *field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the required fields of %s are missing:%s, please set them in config file or environment variables",
+			vertical, strings.Join(missing, ","))
+	}
+	if _, err := c.CoreRegion(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CoreRegion returns the core.Region of the Region
+func (c *ClientConfig) CoreRegion() (core.Region, error) {
+	region, ok := regions[strings.ToLower(c.Region)]
+	if !ok {
+		return region, fmt.Errorf("unknown region:%s, it should be one of sg, cn, us, air_cn and air_sg", c.Region)
+	}
+	return region, nil
+}
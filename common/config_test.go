@@ -0,0 +1,143 @@
+package common
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfigFile = `
+tenant: file_tenant
+tenant_id: file_tenant_id
+token: file_token
+headers:
+  X-From: file
+profile: staging
+profiles:
+  staging:
+    tenant: staging_tenant
+    hosts: [staging.host]
+  production:
+    tenant: production_tenant
+    region: us
+    headers:
+      X-Env: production
+`
+
+func envOf(env map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestConfigLoaderLoad(t *testing.T) {
+	path := t.TempDir() + "/config.yaml"
+	if err := ioutil.WriteFile(path, []byte(testConfigFile), 0644); err != nil {
+		t.Fatalf("expect config file written, got err:%v", err)
+	}
+	credentialEnv := map[string]string{TenantEnv: "env_tenant", TenantIdEnv: "env_tenant_id", TokenEnv: "env_token"}
+	cases := []struct {
+		name     string
+		vertical string
+		path     string
+		profile  string
+		env      map[string]string
+		expect   *ClientConfig
+		// errContains is the part of the error message expected, empty means no error
+		errContains string
+	}{
+		{name: "default region by env", vertical: VerticalGeneral, env: credentialEnv,
+			expect: &ClientConfig{Tenant: "env_tenant", TenantId: "env_tenant_id", Token: "env_token", Region: "cn"}},
+		{name: "profile of file", vertical: VerticalRetail, path: path,
+			expect: &ClientConfig{Tenant: "staging_tenant", TenantId: "file_tenant_id", Token: "file_token",
+				Region: "sg", Hosts: []string{"staging.host"}, Headers: map[string]string{"X-From": "file"}}},
+		{name: "profile by env overrides the one of file", vertical: VerticalRetail, path: path,
+			env: map[string]string{ProfileEnv: "production"},
+			expect: &ClientConfig{Tenant: "production_tenant", TenantId: "file_tenant_id", Token: "file_token",
+				Region: "us", Headers: map[string]string{"X-From": "file", "X-Env": "production"}}},
+		{name: "profile of loader overrides env", vertical: VerticalRetail, path: path, profile: "staging",
+			env: map[string]string{ProfileEnv: "production"},
+			expect: &ClientConfig{Tenant: "staging_tenant", TenantId: "file_tenant_id", Token: "file_token",
+				Region: "sg", Hosts: []string{"staging.host"}, Headers: map[string]string{"X-From": "file"}}},
+		{name: "config file by env", vertical: VerticalRetail,
+			env: map[string]string{ConfigFileEnv: path, TokenEnv: " env_token "},
+			expect: &ClientConfig{Tenant: "staging_tenant", TenantId: "file_tenant_id", Token: "env_token",
+				Region: "sg", Hosts: []string{"staging.host"}, Headers: map[string]string{"X-From": "file"}}},
+		{name: "env overrides profile", vertical: VerticalRetail, path: path,
+			env: map[string]string{TenantEnv: "env_tenant", RegionEnv: "cn", SchemaEnv: "http",
+				HostsEnv: "host1, host2,", HeadersEnv: "X-From=env, X-Trace = 1"},
+			expect: &ClientConfig{Tenant: "env_tenant", TenantId: "file_tenant_id", Token: "file_token",
+				Region: "cn", Schema: "http", Hosts: []string{"host1", "host2"},
+				Headers: map[string]string{"X-From": "env", "X-Trace": "1"}}},
+		{name: "mock overrides all", vertical: VerticalByteAir, env: map[string]string{
+			ProjectIdEnv: "env_project", HostsEnv: "host1", MockHostEnv: "127.0.0.1:8080"},
+			expect: &ClientConfig{TenantId: "mock", ProjectId: "env_project", AK: "mock", SK: "mock",
+				Region: "air_cn", Schema: "http", Hosts: []string{"127.0.0.1:8080"}}},
+		{name: "unknown vertical", vertical: "news", env: credentialEnv, errContains: "unknown vertical"},
+		{name: "missing profile", vertical: VerticalRetail, path: path, profile: "testing",
+			errContains: "profile testing is not found"},
+		{name: "profile without file", vertical: VerticalRetail, env: map[string]string{ProfileEnv: "staging"},
+			errContains: "profile staging is not found"},
+		{name: "missing config file", vertical: VerticalRetail, path: path + ".missing", errContains: "no such file"},
+		{name: "missing required fields", vertical: VerticalByteAir, env: credentialEnv,
+			errContains: "missing:project_id,ak,sk"},
+		{name: "unknown region", vertical: VerticalRetail,
+			env:         map[string]string{TenantEnv: "t", TenantIdEnv: "t", TokenEnv: "t", RegionEnv: "eu"},
+			errContains: "unknown region:eu"},
+		{name: "header without value", vertical: VerticalRetail,
+			env:         map[string]string{TenantEnv: "t", TenantIdEnv: "t", TokenEnv: "t", HeadersEnv: "X-From"},
+			errContains: "invalid " + HeadersEnv},
+		{name: "header without key", vertical: VerticalRetail,
+			env:         map[string]string{TenantEnv: "t", TenantIdEnv: "t", TokenEnv: "t", HeadersEnv: "X-From=env,=1"},
+			errContains: "invalid " + HeadersEnv},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			loader := &ConfigLoader{Path: c.path, Profile: c.profile, LookupEnv: envOf(c.env)}
+			config, err := loader.Load(c.vertical)
+			if c.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), c.errContains) {
+					t.Fatalf("expect error containing %q, got err:%v", c.errContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %+v, got err:%v", c.expect, err)
+			}
+			if !reflect.DeepEqual(config, c.expect) {
+				t.Fatalf("expect %+v, got %+v", c.expect, config)
+			}
+		})
+	}
+}
+
+func TestConfigLoaderLoadTOML(t *testing.T) {
+	path := t.TempDir() + "/config.toml"
+	content := `
+tenant = "file_tenant"
+tenant_id = "file_tenant_id"
+token = "file_token"
+
+[profiles.production]
+tenant = "production_tenant"
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("expect config file written, got err:%v", err)
+	}
+	loader := &ConfigLoader{Path: path, Profile: "production", LookupEnv: envOf(nil)}
+	config, err := loader.Load(VerticalMedia)
+	if err != nil {
+		t.Fatalf("expect loaded, got err:%v", err)
+	}
+	expect := &ClientConfig{Tenant: "production_tenant", TenantId: "file_tenant_id", Token: "file_token", Region: "sg"}
+	if !reflect.DeepEqual(config, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, config)
+	}
+	loader.Path = t.TempDir() + "/config.json"
+	_ = ioutil.WriteFile(loader.Path, []byte("{}"), 0644)
+	if _, err := loader.Load(VerticalMedia); err == nil || !strings.Contains(err.Error(), "unsupported config file") {
+		t.Fatalf("expect unsupported config file, got err:%v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeadLetter is a request which ultimately fails, it keeps enough
+// information to be replayed through the same client call
+type DeadLetter struct {
+	Time time.Time `json:"time"`
+
+	// API is the name of the request, such as APIWriteUsers
+	API string `json:"api"`
+
+	// RequestId is the request id used by the last attempt, replaying with
+	// it prevents the server from saving duplicate data
+	RequestId string `json:"request_id,omitempty"`
+
+	// Stage and DataDate are the options of the request, which decide
+	// how the server saves the data
+	Stage    string     `json:"stage,omitempty"`
+	DataDate *time.Time `json:"data_date,omitempty"`
+
+	// Meta is the extra arguments of the call besides the request,
+	// such as the "topic" of WriteData
+	Meta map[string]string `json:"meta,omitempty"`
+
+	Error string `json:"error"`
+
+	// Payload is the request in json, the proto message is serialized by protojson
+	Payload json.RawMessage `json:"payload"`
+}
+
+// DeadLetterSink stores the requests which ultimately fail,
+// the implementation should be safe for concurrent use
+type DeadLetterSink interface {
+	Put(letter *DeadLetter) error
+}
+
+// NewDeadLetter creates the DeadLetter of the request, which fails with err.
+// The request id is taken from opts, and request should be a proto message
+// or a value can be serialized by encoding/json
+func NewDeadLetter(api string, request interface{}, opts []option.Option,
+	meta map[string]string, err error) (*DeadLetter, error) {
+	var payload []byte
+	var marshalErr error
+	if message, ok := request.(proto.Message); ok {
+		payload, marshalErr = protojson.Marshal(message)
+	} else {
+		payload, marshalErr = json.Marshal(request)
+	}
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	options := option.Conv2Options(opts...)
+	letter := &DeadLetter{
+		Time:      time.Now(),
+		API:       api,
+		RequestId: options.RequestId,
+		Stage:     options.Stage,
+		Meta:      meta,
+		Payload:   payload,
+	}
+	if !options.DataDate.IsZero() {
+		letter.DataDate = &options.DataDate
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	return letter, nil
+}
+
+// DecodeProto parses the payload to the request of proto message
+func (l *DeadLetter) DecodeProto(request proto.Message) error {
+	return protojson.Unmarshal(l.Payload, request)
+}
+
+// DecodeJSON parses the payload to the request of other types,
+// such as the data list of WriteData. The numbers in interface{} are
+// decoded as json.Number, so that the int64 ids don't lose precision
+func (l *DeadLetter) DecodeJSON(request interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(l.Payload))
+	decoder.UseNumber()
+	return decoder.Decode(request)
+}
+
+// Options returns the options kept in the letter, the original request id
+// is used, so that the server treats the request which has been saved
+// as idempotent, instead of saving duplicate data
+func (l *DeadLetter) Options() []option.Option {
+	var opts []option.Option
+	if l.RequestId != "" {
+		opts = append(opts, option.WithRequestId(l.RequestId))
+	}
+	if l.Stage != "" {
+		opts = append(opts, option.WithStage(l.Stage))
+	}
+	if l.DataDate != nil {
+		opts = append(opts, option.WithDataDate(*l.DataDate))
+	}
+	return opts
+}
+
+func getRequestId(opts []option.Option) string {
+	return option.Conv2Options(opts...).RequestId
+}
+
+// FileDeadLetterSink appends the dead letters to a local file in JSONL,
+// one letter per line. The file is opened for each letter, so it can be
+// moved away by TakeDeadLetters while the sink is in use
+type FileDeadLetterSink struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewFileDeadLetterSink(path string) *FileDeadLetterSink {
+	return &FileDeadLetterSink{path: path}
+}
+
+func (s *FileDeadLetterSink) Put(letter *DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(line); err != nil {
+		_ = file.Close()
+		return err
+	}
+	// The letter should survive the crash of process
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadDeadLetters reads all the dead letters in the file written by FileDeadLetterSink
+func ReadDeadLetters(path string) ([]*DeadLetter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var letters []*DeadLetter
+	scanner := bufio.NewScanner(file)
+	// The payload of a request with thousands of items may be very long
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		letter := &DeadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), letter); err != nil {
+			return nil, fmt.Errorf("parse dead letter fail, line:%d msg:%s", lineNum, err.Error())
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// TakeDeadLetters moves the file to "<path>.<timestamp>.replayed", and reads
+// all the dead letters in it, so that the letters failing again when
+// replayed are written to a new file, instead of being mixed with the old ones
+func TakeDeadLetters(path string) ([]*DeadLetter, error) {
+	takenPath := fmt.Sprintf("%s.%d.replayed", path, time.Now().Unix())
+	if err := os.Rename(path, takenPath); err != nil {
+		return nil, err
+	}
+	return ReadDeadLetters(takenPath)
+}
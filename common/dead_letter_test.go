@@ -0,0 +1,58 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+)
+
+func TestDeadLetterDecodeJSONKeepInt64(t *testing.T) {
+	// Larger than 2^53, which can't be kept by float64
+	const id int64 = 9007199254740993
+	dataList := []map[string]interface{}{{"user_id": id, "score": 1.5}}
+	letter, err := NewDeadLetter(APIWriteData, dataList, nil, nil, errBadRequest)
+	if err != nil {
+		t.Fatalf("expect dead letter created, got err:%v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := letter.DecodeJSON(&decoded); err != nil {
+		t.Fatalf("expect decoded, got err:%v", err)
+	}
+	number, ok := decoded[0]["user_id"].(json.Number)
+	if !ok {
+		t.Fatalf("expect json.Number, got %T", decoded[0]["user_id"])
+	}
+	if value, err := number.Int64(); err != nil || value != id {
+		t.Fatalf("expect %d, got %s err:%v", id, number, err)
+	}
+	// The replayed request is serialized to the same payload
+	payload, _ := json.Marshal(decoded)
+	if string(payload) != string(letter.Payload) {
+		t.Fatalf("expect payload %s, got %s", letter.Payload, payload)
+	}
+}
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	date := time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+	opts := []option.Option{option.WithRequestId("request-1"), option.WithStage("pre_sync"),
+		option.WithDataDate(date)}
+	letter, err := NewDeadLetter(APIWriteUsers, &Status{Code: 400, Message: "bad"}, opts,
+		map[string]string{"topic": "user"}, errBadRequest)
+	if err != nil {
+		t.Fatalf("expect dead letter created, got err:%v", err)
+	}
+	request := &Status{}
+	if err := letter.DecodeProto(request); err != nil || request.GetMessage() != "bad" {
+		t.Fatalf("expect the proto request decoded, got %v err:%v", request, err)
+	}
+	options := option.Conv2Options(letter.Options()...)
+	if options.RequestId != "request-1" || options.Stage != "pre_sync" || !options.DataDate.Equal(date) {
+		t.Fatalf("expect the options kept, got %+v", options)
+	}
+	if letter.Error != errBadRequest.Error() || letter.Meta["topic"] != "user" {
+		t.Fatalf("expect the error and meta kept, got %+v", letter)
+	}
+}
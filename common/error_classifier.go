@@ -0,0 +1,98 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/byteplus-sdk/sdk-go/core"
+)
+
+// The messages of network exceptions which usually disappear after a while.
+// SDK may only keep the message of the original error, so the error
+// can't always be identified by type
+var transientErrMarks = []string{
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"server misbehaving",
+	"temporary failure in name resolution",
+	"server closed connection",
+	"timed out",
+	"unexpected eof",
+}
+
+// The phrases in the messages of item errors in write response, which mean the
+// server fails to save the record for the moment, instead of the record is
+// invalid. They are matched as whole words, so that the validation error
+// of a field named like "internal_id" or "timeout_ms" isn't retried
+var retryableItemErrPattern = regexp.MustCompile(`(?i)\b(?:timeout|timed out|time out|too many requests|` +
+	`overload(?:ed)?|internal (?:server )?error|(?:service|temporarily) unavailable|server (?:is )?busy|try again)\b`)
+
+// Matches the http status code in messages like "code:503" or "status: 502"
+var httpStatusPattern = regexp.MustCompile(`(?i)(?:status|code)\D{0,8}(\d{3})\b`)
+
+// IsRetryableError is the default RetryPolicy.RetryableError,
+// a request failing with timeout or transient network exception is retried
+func IsRetryableError(err error) bool {
+	return core.IsTimeoutError(err) || IsTransientError(err)
+}
+
+// IsTransientError reports whether err is caused by a network exception
+// which may disappear when request again, such as connection refused,
+// connection reset, temporary DNS failure or 5xx http status. The host
+// not found is not transient, which is usually caused by a wrong host
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	msg := strings.ToLower(err.Error())
+	for _, mark := range transientErrMarks {
+		if strings.Contains(msg, mark) {
+			return true
+		}
+	}
+	if strings.HasSuffix(msg, "eof") {
+		return true
+	}
+	return isServerErrorStatus(msg)
+}
+
+func isServerErrorStatus(msg string) bool {
+	for _, match := range httpStatusPattern.FindAllStringSubmatch(msg, -1) {
+		code, _ := strconv.Atoi(match[1])
+		if code >= 500 && code < 600 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryableItemError is the default RetryPolicy.RetryableItemError,
+// the record failed for server side reason, such as timeout, overload or
+// the status code 429 and 5xx in message, is resubmitted, while the one
+// failed for invalid data is not
+func IsRetryableItemError(message string) bool {
+	if retryableItemErrPattern.MatchString(message) {
+		return true
+	}
+	for _, match := range httpStatusPattern.FindAllStringSubmatch(message, -1) {
+		code, _ := strconv.Atoi(match[1])
+		if code == 429 || code >= 500 && code < 600 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// faultServer fails the first "faults" requests by the fault handler,
+// and records the request id of every request it receives
+type faultServer struct {
+	*httptest.Server
+	lock       sync.Mutex
+	requestIds []string
+}
+
+func newFaultServer(faults int, fault http.HandlerFunc) *faultServer {
+	s := &faultServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requestIds = append(s.requestIds, r.Header.Get("Request-Id"))
+		received := len(s.requestIds)
+		s.lock.Unlock()
+		if received <= faults {
+			fault(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *faultServer) receivedRequestIds() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.requestIds...)
+}
+
+// The mark of the network errors returned by the http caller of sdk-go core
+const sdkNetErrMark = "[netError]"
+
+// httpCall sends the request id in options by header, and returns the
+// errors in the formats of the http caller of sdk-go core, which flattens
+// the error of transport to a plain message with the net error mark,
+// so the classifier can only depend on the message
+func httpCall(url string) Call {
+	client := &http.Client{Timeout: time.Second}
+	return func(_ interface{}, opts ...option.Option) (proto.Message, error) {
+		options := &option.Options{}
+		for _, opt := range opts {
+			opt(options)
+		}
+		req, _ := http.NewRequest(http.MethodPost, url, nil)
+		req.Header.Set("Request-Id", options.RequestId)
+		rsp, err := client.Do(req)
+		if err != nil {
+			return nil, sdkNetError(err.Error())
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return nil, sdkStatusError(rsp.StatusCode)
+		}
+		return &emptypb.Empty{}, nil
+	}
+}
+
+// sdkNetError returns the error of sdk-go core when the transport fails with msg
+func sdkNetError(msg string) error {
+	if strings.Contains(strings.ToLower(msg), "timeout") {
+		return errors.New(sdkNetErrMark + " timeout")
+	}
+	return errors.New(sdkNetErrMark + " " + msg)
+}
+
+// sdkStatusError returns the error of sdk-go core when the http status isn't 200
+func sdkStatusError(code int) error {
+	return fmt.Errorf("%s http status not 200, code:%d", sdkNetErrMark, code)
+}
+
+func resetConnection(w http.ResponseWriter, _ *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	// Close with RST instead of FIN
+	_ = conn.(*net.TCPConn).SetLinger(0)
+	_ = conn.Close()
+}
+
+func serviceUnavailable(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func fastRetryHelper() *RequestHelper {
+	return &RequestHelper{
+		RetryPolicy: &RetryPolicy{
+			Backoff: &ConstantBackoff{Interval: time.Millisecond},
+		},
+	}
+}
+
+func TestDoWithRetryRecoverFromTransientError(t *testing.T) {
+	cases := []struct {
+		name  string
+		fault http.HandlerFunc
+	}{
+		{name: "connection reset", fault: resetConnection},
+		{name: "service unavailable", fault: serviceUnavailable},
+		{name: "bad gateway", fault: func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newFaultServer(2, c.fault)
+			defer server.Close()
+
+			opts := []option.Option{option.WithRequestId("fixed-request-id")}
+			_, err := fastRetryHelper().DoWithRetry(httpCall(server.URL), nil, opts, 2)
+			if err != nil {
+				t.Fatalf("expect success after retry, got err:%v", err)
+			}
+			requestIds := server.receivedRequestIds()
+			if len(requestIds) != 3 {
+				t.Fatalf("expect 3 attempts, got %d", len(requestIds))
+			}
+			for _, requestId := range requestIds {
+				if requestId != "fixed-request-id" {
+					t.Fatalf("expect same request id across retries, got %v", requestIds)
+				}
+			}
+		})
+	}
+}
+
+func TestDoWithRetryReuseGeneratedRequestId(t *testing.T) {
+	server := newFaultServer(1, serviceUnavailable)
+	defer server.Close()
+
+	_, err := fastRetryHelper().DoWithRetry(httpCall(server.URL), nil, nil, 1)
+	if err != nil {
+		t.Fatalf("expect success after retry, got err:%v", err)
+	}
+	requestIds := server.receivedRequestIds()
+	if len(requestIds) != 2 || requestIds[0] == "" || requestIds[0] != requestIds[1] {
+		t.Fatalf("expect the generated request id is reused, got %v", requestIds)
+	}
+}
+
+func TestDoWithRetryExhaustedByTransientError(t *testing.T) {
+	refusedServer := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := refusedServer.URL
+	// Nothing listens on the address after closing
+	refusedServer.Close()
+
+	cases := []struct {
+		name string
+		url  string
+	}{
+		{name: "connection refused", url: refusedURL},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			attempts := 0
+			call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				attempts++
+				return httpCall(c.url)(request, opts...)
+			}
+			_, err := fastRetryHelper().DoWithRetry(call, nil, nil, 2)
+			var exhaustedErr *RetryExhaustedError
+			if !errors.As(err, &exhaustedErr) {
+				t.Fatalf("expect RetryExhaustedError, got err:%v", err)
+			}
+			if attempts != 3 || exhaustedErr.Attempts != 3 {
+				t.Fatalf("expect 3 attempts, got %d, err:%v", attempts, err)
+			}
+			if !IsTransientError(exhaustedErr.LastErr) {
+				t.Fatalf("expect last err is transient, got %v", exhaustedErr.LastErr)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryDNSError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{name: "temporary", err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}, attempts: 3},
+		{name: "timeout", err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, attempts: 3},
+		{name: "host not found", err: &net.DNSError{Err: "no such host", IsNotFound: true}, attempts: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// The error is like the one of dialing, without looking up a real host
+			call := newFakeCall(fail(&net.OpError{Op: "dial", Net: "tcp", Err: c.err}))
+			_, err := fastRetryHelper().DoWithRetry(call.call, nil, nil, 2)
+			if err == nil {
+				t.Fatalf("expect err, got success")
+			}
+			if attempts := call.attempts(); attempts != c.attempts {
+				t.Fatalf("expect %d attempts, got %d, err:%v", c.attempts, attempts, err)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryNotRetryPermanentError(t *testing.T) {
+	server := newFaultServer(1, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	defer server.Close()
+
+	_, err := fastRetryHelper().DoWithRetry(httpCall(server.URL), nil, nil, 2)
+	if err == nil || errors.Is(err, ErrRetryExhausted) {
+		t.Fatalf("expect the original error, got err:%v", err)
+	}
+	if attempts := len(server.receivedRequestIds()); attempts != 1 {
+		t.Fatalf("expect 1 attempt, got %d", attempts)
+	}
+}
+
+func TestDoWithRetryCustomClassifier(t *testing.T) {
+	server := newFaultServer(1, serviceUnavailable)
+	defer server.Close()
+
+	helper := fastRetryHelper()
+	helper.RetryPolicy.RetryableError = func(err error) bool {
+		return !strings.Contains(err.Error(), "503")
+	}
+	_, err := helper.DoWithRetry(httpCall(server.URL), nil, nil, 2)
+	if err == nil {
+		t.Fatal("expect 503 is not retried by custom classifier")
+	}
+	if attempts := len(server.receivedRequestIds()); attempts != 1 {
+		t.Fatalf("expect 1 attempt, got %d", attempts)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{err: nil, transient: false},
+		{err: errors.New("dial tcp 127.0.0.1:80: connect: connection refused"), transient: true},
+		{err: errors.New("read tcp: connection reset by peer"), transient: true},
+		{err: errors.New("dial tcp: lookup example.invalid: no such host"), transient: false},
+		{err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, transient: true},
+		{err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, transient: true},
+		{err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, transient: false},
+		{err: fmt.Errorf("dial tcp: %w", &net.DNSError{Err: "no such host", IsNotFound: true}), transient: false},
+		{err: errors.New("Post \"http://127.0.0.1\": EOF"), transient: true},
+		{err: sdkStatusError(500), transient: true},
+		{err: sdkStatusError(503), transient: true},
+		{err: sdkStatusError(404), transient: false},
+		{err: errors.New("invalid request, msg:bad param"), transient: false},
+	}
+	for _, c := range cases {
+		if transient := IsTransientError(c.err); transient != c.transient {
+			t.Errorf("IsTransientError(%v) = %v, expect %v", c.err, transient, c.transient)
+		}
+	}
+}
+
+// TestIsRetryableErrorOfSDKErrors checks the classifier against the messages
+// returned by sdk-go core, whose transport is fasthttp, e.g. the connection
+// closed by server is reported by fasthttp instead of "connection reset"
+func TestIsRetryableErrorOfSDKErrors(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "timeout", err: sdkNetError("timeout"), retryable: true},
+		{name: "dial timeout", err: sdkNetError("dialing to the given TCP address timed out"), retryable: true},
+		{name: "connection refused", err: sdkNetError("dial tcp4 127.0.0.1:80: connect: connection refused"),
+			retryable: true},
+		{name: "connection closed by server", err: sdkNetError("the server closed connection before " +
+			"returning the first response byte. Make sure the server returns 'Connection: close' " +
+			"response header before closing the connection"), retryable: true},
+		{name: "broken pipe", err: sdkNetError("write tcp 127.0.0.1:52000->127.0.0.1:80: write: broken pipe"),
+			retryable: true},
+		{name: "no such host", err: sdkNetError("dial tcp4: lookup example.invalid: no such host")},
+		{name: "service unavailable", err: sdkStatusError(http.StatusServiceUnavailable), retryable: true},
+		{name: "bad gateway", err: sdkStatusError(http.StatusBadGateway), retryable: true},
+		{name: "bad request", err: sdkStatusError(http.StatusBadRequest)},
+		{name: "unauthorized", err: sdkStatusError(http.StatusUnauthorized)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if retryable := IsRetryableError(c.err); retryable != c.retryable {
+				t.Fatalf("expect retryable %v, got %v, err:%v", c.retryable, retryable, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+)
+
+// The sentinel errors of RequestHelper, the structured errors below
+// match them with errors.Is, and carry the details available by errors.As
+var (
+	// ErrServerOverload means the server still refuses the request after retrying
+	ErrServerOverload = errors.New("server overload")
+
+	// ErrRetryExhausted means the request still fails for network exception after retrying
+	ErrRetryExhausted = errors.New("still fail after retry")
+
+	// ErrImportFailure means the server refuses to create the import task
+	ErrImportFailure = errors.New("import return failure info")
+
+	// ErrWriteFailure means the server returns failure info of a write request
+	ErrWriteFailure = errors.New("write return failure info")
+
+	// ErrOperationLost means the server lost the operation of the import task,
+	// it is unknown whether the data has been imported
+	ErrOperationLost = errors.New("operation loss")
+
+	// ErrPollingTimeout means the import task is not finished
+	// within the polling timeout, it may finish later
+	ErrPollingTimeout = errors.New("polling import result timeout")
+
+	// ErrListOperationsFailure means the server returns failure info of a "ListOperations" request
+	ErrListOperationsFailure = errors.New("list operations return failure info")
+
+	// ErrInvalidOperationFilter means the filter of "ListOperations" is rejected before sending
+	ErrInvalidOperationFilter = errors.New("invalid operation filter")
+)
+
+// OverloadExhaustedError is returned when the server is still overloaded
+// after Attempts requests, Status is the one returned by the last request
+type OverloadExhaustedError struct {
+	Attempts int
+	Status   *Status
+}
+
+func (e *OverloadExhaustedError) Error() string {
+	return fmt.Sprintf("%s, attempts:%d status:%s", ErrServerOverload, e.Attempts, e.Status)
+}
+
+func (e *OverloadExhaustedError) Is(target error) bool {
+	return target == ErrServerOverload
+}
+
+// RetryExhaustedError is returned when all the Attempts of request fail,
+// LastErr is the error returned by the last attempt
+type RetryExhaustedError struct {
+	Attempts int
+	LastErr  error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("%s, attempts:%d msg:%s", ErrRetryExhausted, e.Attempts, e.LastErr)
+}
+
+func (e *RetryExhaustedError) Is(target error) bool {
+	return target == ErrRetryExhausted
+}
+
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.LastErr
+}
+
+// ImportFailureError is returned when the server refuses to create
+// the import task, Status tells the reason
+type ImportFailureError struct {
+	Status *Status
+}
+
+func (e *ImportFailureError) Error() string {
+	return fmt.Sprintf("%s, status:%s", ErrImportFailure, e.Status)
+}
+
+func (e *ImportFailureError) Is(target error) bool {
+	return target == ErrImportFailure
+}
+
+// WriteFailureError is returned when the server returns failure info
+// of a write request, Status tells the reason
+type WriteFailureError struct {
+	Status *Status
+}
+
+func (e *WriteFailureError) Error() string {
+	return fmt.Sprintf("%s, status:%s", ErrWriteFailure, e.Status)
+}
+
+func (e *WriteFailureError) Is(target error) bool {
+	return target == ErrWriteFailure
+}
+
+// OperationLostError is returned when the server lost the operation with Name.
+// Please send the Name to bytedance to confirm whether the data has been imported
+type OperationLostError struct {
+	Name string
+}
+
+func (e *OperationLostError) Error() string {
+	return fmt.Sprintf("%s, name:%s", ErrOperationLost, e.Name)
+}
+
+func (e *OperationLostError) Is(target error) bool {
+	return target == ErrOperationLost
+}
+
+// PollingTimeoutError is returned when the operation with Name is not done
+// after polling for Timeout, the result can be got by "GetOperation" later
+type PollingTimeoutError struct {
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *PollingTimeoutError) Error() string {
+	return fmt.Sprintf("%s, name:%s timeout:%s", ErrPollingTimeout, e.Name, e.Timeout)
+}
+
+func (e *PollingTimeoutError) Is(target error) bool {
+	return target == ErrPollingTimeout
+}
+
+// ListOperationsFailureError is returned when the server returns failure
+// info of a "ListOperations" request, Status tells the reason
+type ListOperationsFailureError struct {
+	Status *Status
+}
+
+func (e *ListOperationsFailureError) Error() string {
+	return fmt.Sprintf("%s, status:%s", ErrListOperationsFailure, e.Status)
+}
+
+func (e *ListOperationsFailureError) Is(target error) bool {
+	return target == ErrListOperationsFailure
+}
+
+// InvalidOperationFilterError is returned when the filter of "ListOperations"
+// doesn't follow the grammar of OperationFilter, Msg tells the reason
+type InvalidOperationFilterError struct {
+	Msg string
+}
+
+func newInvalidOperationFilterError(format string, args ...interface{}) *InvalidOperationFilterError {
+	return &InvalidOperationFilterError{Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *InvalidOperationFilterError) Error() string {
+	return fmt.Sprintf("%s, msg:%s", ErrInvalidOperationFilter, e.Msg)
+}
+
+func (e *InvalidOperationFilterError) Is(target error) bool {
+	return target == ErrInvalidOperationFilter
+}
+
+// CanceledError is returned by the "XxxContext" methods of RequestHelper
+// when the ctx is canceled or its deadline is exceeded before the request
+// finish, the Cause is the ctx.Err(), so errors.Is(err, context.Canceled)
+// and errors.Is(err, context.DeadlineExceeded) both work as expected.
+type CanceledError struct {
+	Cause error
+}
+
+func newCanceledError(cause error) *CanceledError {
+	return &CanceledError{Cause: cause}
+}
+
+func (e *CanceledError) Error() string {
+	return "request canceled: " + e.Cause.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Cause
+}
+
+func IsCanceledError(err error) bool {
+	var canceledErr *CanceledError
+	return errors.As(err, &canceledErr)
+}
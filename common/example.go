@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"time"
 
 	"github.com/byteplus-sdk/sdk-go/common"
@@ -40,32 +41,25 @@ func GetOperationExample(client common.Client, name string) {
 }
 
 func ListOperationsExample(client common.Client, filter string) []*Operation {
-	// The "pageToken" is empty when you get the first page
-	request := buildListOperationsRequest(filter, "")
-	opts := []option.Option{
-		option.WithTimeout(DefaultListOperationsTimeout),
+	requestHelper := &RequestHelper{Client: client}
+	config := &ListOperationsConfig{
+		Filter:      filter,
+		PageSize:    3,
+		PageTimeout: DefaultListOperationsTimeout,
 	}
-	response, err := client.ListOperations(request, opts...)
-	if err != nil {
-		logs.Error("list operations occur err, msg:%s", err.Error())
-		return nil
+	// The iterator puts the "nextPageToken" returned by each page
+	// into the request of next page, until the last page is listed
+	itr := NewOperationIterator(context.Background(), requestHelper, config)
+	var operations []*Operation
+	for itr.Next() {
+		operations = append(operations, itr.Operation())
 	}
-	if !IsSuccess(response.GetStatus()) {
-		logs.Error("list operations find failure info, msg:\n%s", response.GetStatus())
+	if err := itr.Err(); err != nil {
+		// The listing can be continued by a new iterator, whose
+		// "PageToken" is itr.NextPageToken(), after the error is solved
+		logs.Error("list operations occur err, msg:%s", err.Error())
 		return nil
 	}
 	logs.Info("list operations success")
-	return response.GetOperations()
-	// When you get the next Page, you need to put the "nextPageToken"
-	// returned by this Page into the request of next Page
-	// nextPageRequest := buildListOperationsRequest(filter, response.GetNextPageToken())
-	// request next page
-}
-
-func buildListOperationsRequest(filter, pageToken string) *ListOperationsRequest {
-	return &ListOperationsRequest{
-		Filter:    filter,
-		PageSize:  3,
-		PageToken: pageToken,
-	}
+	return operations
 }
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Future is the handle of a request submitted to ConcurrentHelper,
+// it is completed with the response or error once the request finishes
+type Future struct {
+	request  interface{}
+	done     chan struct{}
+	response proto.Message
+	err      error
+}
+
+func newFuture(request interface{}) *Future {
+	return &Future{
+		request: request,
+		done:    make(chan struct{}),
+	}
+}
+
+func (f *Future) complete(response proto.Message, err error) {
+	f.response = response
+	f.err = err
+	close(f.done)
+}
+
+// Request returns the submitted request
+func (f *Future) Request() interface{} {
+	return f.request
+}
+
+// Done returns a channel that is closed when the request finishes,
+// the result can be got by Wait without blocking after that
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the request finishes.
+// The response is the one returned by server, such as *WriteUsersResponse,
+// whose status should still be checked, for example, by IsSuccessResponse.
+// err is not nil if the request can't be sent successfully after retrying
+func (f *Future) Wait() (proto.Message, error) {
+	<-f.done
+	return f.response, f.err
+}
+
+// WaitContext is the same as Wait, but returns a *CanceledError
+// if ctx is done before the request finishes
+func (f *Future) WaitContext(ctx context.Context) (proto.Message, error) {
+	select {
+	case <-f.done:
+		return f.response, f.err
+	case <-ctx.Done():
+		return nil, newCanceledError(ctx.Err())
+	}
+}
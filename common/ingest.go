@@ -0,0 +1,299 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+)
+
+// The maximum count of row errors kept in IngestSummary,
+// the ones after it are only counted
+const maxIngestRowErrors = 1000
+
+// IngestConfig is the configuration of Ingest
+type IngestConfig struct {
+	// API is the name of the api writing the records, such as APIWriteProducts
+	API string
+
+	// BatchSize is the count of records sent by one request,
+	// default is MaxBatchSize, and larger value is ignored
+	BatchSize int
+
+	// MaxBatchSize is the maximum items the api can transfer
+	// at one request, default is MaxWriteItems
+	MaxBatchSize int
+
+	// Concurrency is the count of batches written at the same time, default is 1.
+	// The reading waits when all of them are busy, so at most Concurrency+1
+	// batches are kept in memory however large the file is
+	Concurrency int
+
+	// Convert turns the row to the record sent by Write, such as *Product
+	Convert func(row *Row) (interface{}, error)
+
+	// Write sends the batch of records, and hands the records failing
+	// permanently to onFailure, whose Index is the index in batch.Records.
+	// The error means the whole batch fails if onFailure is not called.
+	// It is called by multiple goroutines if Concurrency > 1
+	Write func(batch *IngestBatch, onFailure ItemFailureHandler) error
+
+	// Checkpoint records the progress, so that the run restarted with the
+	// same file and batch size skips the rows confirmed before, it is optional.
+	// A batch is confirmed once Write returns without the whole batch failing,
+	// the failed batch is sent again after restart with the same request id
+	Checkpoint *Checkpoint
+}
+
+// IngestBatch is a batch of records sent by IngestConfig.Write
+type IngestBatch struct {
+	Records []interface{}
+
+	// Progress is the progress of the batch in the checkpoint, its RequestId
+	// should be used by the request, see RequestOpts, and the Operation is
+	// set if the batch is imported before restart, which should be polled
+	// instead of importing again
+	Progress *CheckpointBatch
+
+	checkpoint *Checkpoint
+}
+
+// RequestOpts returns the opts with the request id of the batch, which is kept
+// after restart, so that the batch sent again is deduplicated by the server
+func (b *IngestBatch) RequestOpts(opts []option.Option) []option.Option {
+	return append(append([]option.Option(nil), opts...), option.WithRequestId(b.Progress.RequestId))
+}
+
+// SetOperation records the name of the import operation of the batch,
+// which is polled after restart if the batch is not confirmed. The empty
+// name clears it, so that the batch is imported again after restart
+func (b *IngestBatch) SetOperation(name string) error {
+	b.Progress.Operation = name
+	return b.checkpoint.Save(b.Progress)
+}
+
+// IngestRowError is the error of a row, which fails to be converted or written
+type IngestRowError struct {
+	// Row is the number of the row, 0 if unknown
+	Row     int64
+	Message string
+}
+
+// IngestSummary is the result of Ingest
+type IngestSummary struct {
+	// Rows is the count of rows read, including the invalid ones
+	Rows    int64
+	Written int64
+	Failed  int64
+
+	// Skipped is the count of rows confirmed before restart, see IngestConfig.Checkpoint
+	Skipped int64
+
+	// Errors are the errors of the failed rows,
+	// at most 1000 of them are kept
+	Errors []*IngestRowError
+}
+
+func (s *IngestSummary) addError(row int64, message string) {
+	s.Failed++
+	if len(s.Errors) < maxIngestRowErrors {
+		s.Errors = append(s.Errors, &IngestRowError{Row: row, Message: message})
+	}
+}
+
+func (s *IngestSummary) merge(other *IngestSummary) {
+	s.Rows += other.Rows
+	s.Written += other.Written
+	s.Failed += other.Failed
+	s.Skipped += other.Skipped
+	for _, rowErr := range other.Errors {
+		if len(s.Errors) >= maxIngestRowErrors {
+			break
+		}
+		s.Errors = append(s.Errors, rowErr)
+	}
+}
+
+// Log prints the summary and the errors of rows
+func (s *IngestSummary) Log(api string) {
+	logs.Info("[Ingest%s] finish, rows:%d written:%d failed:%d skipped:%d",
+		api, s.Rows, s.Written, s.Failed, s.Skipped)
+	for _, rowErr := range s.Errors {
+		logs.Error("[Ingest%s] row fail, row:%d msg:%s", api, rowErr.Row, rowErr.Message)
+	}
+	if omitted := s.Failed - int64(len(s.Errors)); omitted > 0 {
+		logs.Error("[Ingest%s] %d more rows fail", api, omitted)
+	}
+}
+
+// Ingest reads the rows from reader, converts them to records, and writes
+// the records in batches, the progress is logged after each batch.
+// The rows failing to be read, converted or written are recorded in the
+// returned summary, and the ingestion goes on with the next rows.
+// The error is returned if the reader fails, the summary is still returned
+func Ingest(reader RowReader, config *IngestConfig) (*IngestSummary, error) {
+	maxBatchSize := config.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = MaxWriteItems
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 || batchSize > maxBatchSize {
+		batchSize = maxBatchSize
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	summary := &IngestSummary{}
+	checkpoint := config.Checkpoint
+	if err := checkpoint.begin(batchSize); err != nil {
+		return summary, err
+	}
+	// The rows before offset are confirmed, they are skipped without being converted
+	offset := checkpoint.Offset()
+	if offset > 0 {
+		logs.Info("[Ingest%s] resume from checkpoint, offset:%d", config.API, offset)
+	}
+	// lock guards summary, which is updated by the writing goroutines
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, concurrency)
+	records := make([]interface{}, 0, batchSize)
+	rows := make([]int64, 0, batchSize)
+	// The range of row numbers of a batch starts after the last row of the previous
+	// one, including the invalid rows, so the batches are same after restart
+	lastRow, lastFlushedRow := offset, offset
+	flush := func() {
+		if len(records) == 0 {
+			return
+		}
+		batch := &IngestBatch{
+			Records:    records,
+			Progress:   checkpoint.Batch(lastFlushedRow+1, lastRow),
+			checkpoint: checkpoint,
+		}
+		lastFlushedRow = lastRow
+		if batch.Progress.Done {
+			lock.Lock()
+			summary.Skipped += int64(len(records))
+			lock.Unlock()
+		} else {
+			workers <- struct{}{}
+			wg.Add(1)
+			go func(batch *IngestBatch, rows []int64) {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				batchSummary := writeBatch(config, batch, rows)
+				lock.Lock()
+				summary.merge(batchSummary)
+				logs.Info("[Ingest%s] progress, rows:%d written:%d failed:%d",
+					config.API, summary.Rows, summary.Written, summary.Failed)
+				lock.Unlock()
+			}(batch, rows)
+		}
+		records = make([]interface{}, 0, batchSize)
+		rows = make([]int64, 0, batchSize)
+	}
+	addRowError := func(row int64, message string) {
+		lock.Lock()
+		summary.Rows++
+		summary.addError(row, message)
+		lock.Unlock()
+	}
+	var readErr error
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			if rowErr.Number <= offset {
+				lock.Lock()
+				summary.Rows++
+				lock.Unlock()
+				continue
+			}
+			lastRow = rowErr.Number
+			addRowError(rowErr.Number, rowErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		lock.Lock()
+		summary.Rows++
+		if row.Number <= offset {
+			summary.Skipped++
+			lock.Unlock()
+			continue
+		}
+		lock.Unlock()
+		lastRow = row.Number
+		record, err := config.Convert(row)
+		if err != nil {
+			lock.Lock()
+			summary.addError(row.Number, err.Error())
+			lock.Unlock()
+			continue
+		}
+		records = append(records, record)
+		rows = append(rows, row.Number)
+		if len(records) >= batchSize {
+			flush()
+		}
+	}
+	// The partial batch is not written if the reader fails with checkpoint,
+	// it would not be same as the one read after restart
+	if readErr == nil || checkpoint == nil {
+		flush()
+	}
+	wg.Wait()
+	return summary, readErr
+}
+
+// writeBatch writes the records, and returns the result of them,
+// the batch is confirmed in the checkpoint unless the whole batch fails
+func writeBatch(config *IngestConfig, batch *IngestBatch, rows []int64) *IngestSummary {
+	summary := &IngestSummary{}
+	if err := batch.checkpoint.Save(batch.Progress); err != nil {
+		for _, row := range rows {
+			summary.addError(row, fmt.Sprintf("save checkpoint fail, msg:%s", err.Error()))
+		}
+		return summary
+	}
+	onFailure := func(failures []*ItemError) {
+		for _, failure := range failures {
+			row := int64(0)
+			if failure.Index >= 0 {
+				row = rows[failure.Index]
+			}
+			message := failure.Message
+			if failure.Data != "" && failure.Index < 0 {
+				message = fmt.Sprintf("%s, data:%s", message, failure.Data)
+			}
+			summary.addError(row, message)
+		}
+	}
+	err := config.Write(batch, onFailure)
+	if err != nil && summary.Failed == 0 {
+		// The whole batch fails, none of the records is written
+		for _, row := range rows {
+			summary.addError(row, err.Error())
+		}
+		return summary
+	}
+	summary.Written += int64(len(batch.Records)) - summary.Failed
+	batch.Progress.Done = true
+	if err := batch.checkpoint.Save(batch.Progress); err != nil {
+		logs.Error("[Ingest%s] save checkpoint fail, first_row:%d last_row:%d msg:%s",
+			config.API, batch.Progress.FirstRow, batch.Progress.LastRow, err.Error())
+	}
+	return summary
+}
@@ -0,0 +1,267 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// sliceReader reads the rows of values in order, an error value is
+// returned as *RowError, and readErr is returned after the rows
+type sliceReader struct {
+	values  []interface{}
+	index   int
+	readErr error
+}
+
+func (r *sliceReader) Read() (*Row, error) {
+	if r.index >= len(r.values) {
+		if r.readErr != nil {
+			return nil, r.readErr
+		}
+		return nil, io.EOF
+	}
+	r.index++
+	number := int64(r.index)
+	if err, ok := r.values[r.index-1].(error); ok {
+		return nil, &RowError{Number: number, Err: err}
+	}
+	return &Row{Number: number, Fields: map[string]interface{}{"value": r.values[r.index-1]}}, nil
+}
+
+func (r *sliceReader) Close() error {
+	return nil
+}
+
+func newSliceReader(values ...interface{}) *sliceReader {
+	return &sliceReader{values: values}
+}
+
+// convertValue fails the rows whose value is "invalid"
+func convertValue(row *Row) (interface{}, error) {
+	if row.Fields["value"] == "invalid" {
+		return nil, fmt.Errorf("invalid value")
+	}
+	return row.Fields["value"], nil
+}
+
+// batchRecorder records the batches written, and fails the batches by fail
+type batchRecorder struct {
+	lock    sync.Mutex
+	batches []*IngestBatch
+	fail    func(batch *IngestBatch, onFailure ItemFailureHandler) error
+}
+
+func (r *batchRecorder) write(batch *IngestBatch, onFailure ItemFailureHandler) error {
+	r.lock.Lock()
+	r.batches = append(r.batches, batch)
+	r.lock.Unlock()
+	if r.fail != nil {
+		return r.fail(batch, onFailure)
+	}
+	return nil
+}
+
+// ranges returns the row ranges of the batches written
+func (r *batchRecorder) ranges() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var ranges []string
+	for _, batch := range r.batches {
+		ranges = append(ranges, batch.Progress.key())
+	}
+	return ranges
+}
+
+func TestIngest(t *testing.T) {
+	errRow := errors.New("broken row")
+	cases := []struct {
+		name   string
+		reader *sliceReader
+		fail   func(batch *IngestBatch, onFailure ItemFailureHandler) error
+		// The row ranges of the batches written
+		ranges  []string
+		expect  IngestSummary
+		errRows []int64
+	}{
+		{name: "batches", reader: newSliceReader("a", "b", "c", "d", "e"),
+			ranges: []string{"1-2", "3-4", "5-5"}, expect: IngestSummary{Rows: 5, Written: 5}},
+		{name: "invalid rows are counted in the range",
+			reader: newSliceReader("a", "invalid", errRow, "b", "c"),
+			ranges: []string{"1-4", "5-5"}, expect: IngestSummary{Rows: 5, Written: 3, Failed: 2},
+			errRows: []int64{2, 3}},
+		{name: "failed items", reader: newSliceReader("a", "b", "c"),
+			fail: func(batch *IngestBatch, onFailure ItemFailureHandler) error {
+				onFailure([]*ItemError{{Index: len(batch.Records) - 1, Message: "bad item"}})
+				return nil
+			},
+			ranges: []string{"1-2", "3-3"}, expect: IngestSummary{Rows: 3, Written: 1, Failed: 2},
+			errRows: []int64{2, 3}},
+		{name: "whole batch fails", reader: newSliceReader("a", "b", "c"),
+			fail: func(batch *IngestBatch, _ ItemFailureHandler) error {
+				if batch.Progress.FirstRow == 1 {
+					return errors.New("server error")
+				}
+				return nil
+			},
+			ranges: []string{"1-2", "3-3"}, expect: IngestSummary{Rows: 3, Written: 1, Failed: 2},
+			errRows: []int64{1, 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := &batchRecorder{fail: c.fail}
+			summary, err := Ingest(c.reader, &IngestConfig{
+				API:       APIWriteUsers,
+				BatchSize: 2,
+				Convert:   convertValue,
+				Write:     recorder.write,
+			})
+			if err != nil {
+				t.Fatalf("expect ingested, got err:%v", err)
+			}
+			if ranges := recorder.ranges(); !reflect.DeepEqual(ranges, c.ranges) {
+				t.Fatalf("expect batches %v, got %v", c.ranges, ranges)
+			}
+			if summary.Rows != c.expect.Rows || summary.Written != c.expect.Written ||
+				summary.Failed != c.expect.Failed {
+				t.Fatalf("expect %+v, got %+v", c.expect, summary)
+			}
+			var errRows []int64
+			for _, rowErr := range summary.Errors {
+				errRows = append(errRows, rowErr.Row)
+			}
+			if !reflect.DeepEqual(errRows, c.errRows) {
+				t.Fatalf("expect errors of rows %v, got %v", c.errRows, errRows)
+			}
+		})
+	}
+}
+
+func TestIngestResumeFromCheckpoint(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	ingest := func(recorder *batchRecorder) *IngestSummary {
+		t.Helper()
+		checkpoint := openTestCheckpoint(t, path)
+		defer checkpoint.Close()
+		summary, err := Ingest(newSliceReader("a", "b", "c", "d", "e", "f"), &IngestConfig{
+			API:        APIImportUsers,
+			BatchSize:  2,
+			Convert:    convertValue,
+			Write:      recorder.write,
+			Checkpoint: checkpoint,
+		})
+		if err != nil {
+			t.Fatalf("expect ingested, got err:%v", err)
+		}
+		return summary
+	}
+	// The second batch is imported, but fails to be polled,
+	// and the third batch fails to be sent
+	first := &batchRecorder{fail: func(batch *IngestBatch, _ ItemFailureHandler) error {
+		switch batch.Progress.FirstRow {
+		case 3:
+			if err := batch.SetOperation("operations/2"); err != nil {
+				return err
+			}
+			return errors.New("polling timeout")
+		case 5:
+			return errors.New("server error")
+		}
+		return nil
+	}}
+	if summary := ingest(first); summary.Written != 2 || summary.Failed != 4 {
+		t.Fatalf("expect 2 written and 4 failed, got %+v", summary)
+	}
+
+	second := &batchRecorder{}
+	summary := ingest(second)
+	if summary.Skipped != 2 || summary.Written != 4 || summary.Failed != 0 {
+		t.Fatalf("expect 2 skipped and 4 written, got %+v", summary)
+	}
+	if ranges := second.ranges(); !reflect.DeepEqual(ranges, []string{"3-4", "5-6"}) {
+		t.Fatalf("expect the unconfirmed batches written again, got %v", ranges)
+	}
+	for i, batch := range second.batches {
+		sent := first.batches[i+1]
+		if batch.Progress.RequestId != sent.Progress.RequestId {
+			t.Fatalf("expect the request id of batch %s kept, got %s", batch.Progress.key(), batch.Progress.RequestId)
+		}
+	}
+	if operation := second.batches[0].Progress.Operation; operation != "operations/2" {
+		t.Fatalf("expect the operation imported before, got %q", operation)
+	}
+
+	// All the batches are confirmed
+	third := &batchRecorder{}
+	if summary := ingest(third); summary.Skipped != 6 || len(third.batches) != 0 {
+		t.Fatalf("expect all rows skipped, got %+v batches:%v", summary, third.ranges())
+	}
+}
+
+func TestIngestClearOperation(t *testing.T) {
+	path := t.TempDir() + "/users.checkpoint"
+	ingest := func(recorder *batchRecorder) {
+		t.Helper()
+		checkpoint := openTestCheckpoint(t, path)
+		defer checkpoint.Close()
+		_, err := Ingest(newSliceReader("a", "b"), &IngestConfig{
+			API:        APIImportUsers,
+			BatchSize:  2,
+			Convert:    convertValue,
+			Write:      recorder.write,
+			Checkpoint: checkpoint,
+		})
+		if err != nil {
+			t.Fatalf("expect ingested, got err:%v", err)
+		}
+	}
+	// The operation is found failed by polling, so it is cleared
+	first := &batchRecorder{fail: func(batch *IngestBatch, _ ItemFailureHandler) error {
+		if err := batch.SetOperation("operations/1"); err != nil {
+			return err
+		}
+		if err := batch.SetOperation(""); err != nil {
+			return err
+		}
+		return &ImportFailureError{}
+	}}
+	ingest(first)
+
+	second := &batchRecorder{}
+	ingest(second)
+	if len(second.batches) != 1 || second.batches[0].Progress.Operation != "" {
+		t.Fatalf("expect the batch imported again without operation, got %v", second.batches)
+	}
+	if second.batches[0].Progress.RequestId != first.batches[0].Progress.RequestId {
+		t.Fatalf("expect the request id of the batch kept")
+	}
+}
+
+func TestIngestReadErrorWithCheckpoint(t *testing.T) {
+	checkpoint := openTestCheckpoint(t, t.TempDir()+"/users.checkpoint")
+	defer checkpoint.Close()
+	readErr := errors.New("disk error")
+	reader := newSliceReader("a", "b", "c")
+	reader.readErr = readErr
+	recorder := &batchRecorder{}
+	summary, err := Ingest(reader, &IngestConfig{
+		API:        APIImportUsers,
+		BatchSize:  2,
+		Convert:    convertValue,
+		Write:      recorder.write,
+		Checkpoint: checkpoint,
+	})
+	if !errors.Is(err, readErr) {
+		t.Fatalf("expect read error, got err:%v", err)
+	}
+	// The partial batch would differ from the one read after restart
+	if ranges := recorder.ranges(); !reflect.DeepEqual(ranges, []string{"1-2"}) {
+		t.Fatalf("expect only the full batch written, got %v", ranges)
+	}
+	if summary.Rows != 3 || summary.Written != 2 {
+		t.Fatalf("expect 3 rows read and 2 written, got %+v", summary)
+	}
+}
@@ -0,0 +1,331 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ItemError is the error of a record which fails in a write request
+type ItemError struct {
+	// Index is the index of the record in the records of the write,
+	// it is -1 if the record can't be found by the Data returned by server
+	Index int
+
+	// Record is the original record, nil if Index is -1
+	Record interface{}
+
+	Message string
+
+	// Data is the failed record returned by server, usually in json
+	Data string
+
+	// Retryable tells whether the record failed for server side reason,
+	// it may still be permanently failed after resubmitted several times
+	Retryable bool
+}
+
+// WriteCall sends the records by a fresh write request,
+// which is built by the records, such as WriteUsersRequest
+type WriteCall func(records []interface{}, opts ...option.Option) (proto.Message, error)
+
+// ItemFailureHandler receives the records which fail permanently
+type ItemFailureHandler func(failures []*ItemError)
+
+// GetItemErrors maps the errors in the write response, which are returned
+// by "GetErrors()", to the records sent by the request.
+// The Retryable of returned ItemError is not set
+func GetItemErrors(response interface{}, records []interface{}) []*ItemError {
+	dataErrors := getDataErrors(response)
+	if len(dataErrors) == 0 {
+		return nil
+	}
+	matcher := newRecordMatcher(records)
+	itemErrors := make([]*ItemError, 0, len(dataErrors))
+	for _, dataError := range dataErrors {
+		itemError := &ItemError{Index: -1}
+		if e, ok := dataError.(interface{ GetMessage() string }); ok {
+			itemError.Message = e.GetMessage()
+		}
+		if e, ok := dataError.(interface{ GetData() string }); ok {
+			itemError.Data = e.GetData()
+		}
+		itemError.Index = matcher.match(itemError.Data)
+		if itemError.Index >= 0 {
+			itemError.Record = records[itemError.Index]
+		}
+		itemErrors = append(itemErrors, itemError)
+	}
+	return itemErrors
+}
+
+// DoWriteWithResubmit
+// Send the records by call, and resubmit the records which fail for server
+// side reason with a fresh request, so that the records sent successfully
+// and the ones with invalid data are not sent again.
+// The resubmission is repeated at most retryTimes, and each request is also
+// retried for network exception at most retryTimes with the same request id.
+// The records failing permanently, including the ones still fail after
+// resubmitted, are handed to onFailure, they are logged if it is nil.
+//
+// @return error  the first request fails, or the records fail with request level errors
+func (h *RequestHelper) DoWriteWithResubmit(call WriteCall, records []interface{},
+	opts []option.Option, retryTimes int, onFailure ItemFailureHandler) error {
+	return h.DoWriteWithResubmitContext(context.Background(), call, records, opts, retryTimes, onFailure)
+}
+
+// DoWriteWithResubmitContext
+// Same as DoWriteWithResubmit, but stops retrying and resubmitting
+// as soon as ctx is done, a *CanceledError is returned in this case,
+// and the records not sent successfully are handed to onFailure.
+func (h *RequestHelper) DoWriteWithResubmitContext(ctx context.Context, call WriteCall, records []interface{},
+	opts []option.Option, retryTimes int, onFailure ItemFailureHandler) error {
+	if onFailure == nil {
+		onFailure = logItemFailures
+	}
+	retryTimes = h.RetryPolicy.retryTimes(retryTimes)
+	contextCall := func(_ context.Context, request interface{}, opts ...option.Option) (proto.Message, error) {
+		return call(request.([]interface{}), opts...)
+	}
+	pending := records
+	// The index of each pending record in records
+	indexes := make([]int, len(records))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	var waitTime time.Duration
+	for i := 0; ; i++ {
+		requestOpts := opts
+		if i > 0 {
+			// The records should be sent as a new request, the server
+			// treats the request with same request id as duplicate
+			requestOpts = append(append([]option.Option(nil), opts...), option.WithRequestId(uuid.NewString()))
+		}
+		response, err := h.doWithRetry(ctx, contextCall, pending, requestOpts, retryTimes)
+		if err != nil {
+			if i > 0 {
+				onFailure(failAll(pending, indexes, err.Error(), IsRetryableError(err)))
+			}
+			return err
+		}
+		itemErrors := GetItemErrors(response, pending)
+		if len(itemErrors) == 0 {
+			status := getResponseStatus(response)
+			if status == nil || IsUploadSuccess(status) {
+				return nil
+			}
+			if i > 0 {
+				onFailure(failAll(pending, indexes, status.GetMessage(), false))
+			}
+			return &WriteFailureError{Status: status}
+		}
+		var retryable, permanent []*ItemError
+		for _, itemError := range itemErrors {
+			if itemError.Index >= 0 {
+				itemError.Index = indexes[itemError.Index]
+				itemError.Retryable = h.RetryPolicy.isRetryableItemError(itemError.Message)
+			}
+			if itemError.Retryable && i < retryTimes {
+				retryable = append(retryable, itemError)
+				continue
+			}
+			permanent = append(permanent, itemError)
+		}
+		if len(permanent) > 0 {
+			onFailure(permanent)
+		}
+		if len(retryable) == 0 {
+			return nil
+		}
+		logs.Warn("[ResubmitItems] %d items fail, will resubmit, msg:%s",
+			len(retryable), retryable[0].Message)
+		pending = make([]interface{}, len(retryable))
+		indexes = make([]int, len(retryable))
+		for j, itemError := range retryable {
+			pending[j] = itemError.Record
+			indexes[j] = itemError.Index
+		}
+		waitTime = h.RetryPolicy.backoff(i, waitTime)
+		if err := h.sleep(ctx, waitTime); err != nil {
+			onFailure(failAll(pending, indexes, err.Error(), true))
+			return err
+		}
+	}
+}
+
+// getDataErrors calls "GetErrors()" of the response,
+// whose result is a slice of the error type of each vertical
+func getDataErrors(response interface{}) []interface{} {
+	if response == nil {
+		return nil
+	}
+	method := reflect.ValueOf(response).MethodByName("GetErrors")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil
+	}
+	errorsValue := method.Call(nil)[0]
+	if errorsValue.Kind() != reflect.Slice {
+		return nil
+	}
+	dataErrors := make([]interface{}, errorsValue.Len())
+	for i := range dataErrors {
+		dataErrors[i] = errorsValue.Index(i).Interface()
+	}
+	return dataErrors
+}
+
+func failAll(records []interface{}, indexes []int, message string, retryable bool) []*ItemError {
+	failures := make([]*ItemError, len(records))
+	for i, record := range records {
+		failures[i] = &ItemError{
+			Index:     indexes[i],
+			Record:    record,
+			Message:   message,
+			Retryable: retryable,
+		}
+	}
+	return failures
+}
+
+func logItemFailures(failures []*ItemError) {
+	for _, failure := range failures {
+		logs.Error("[ResubmitItems] item fail, index:%d msg:%s data:%s",
+			failure.Index, failure.Message, failure.Data)
+	}
+}
+
+func getResponseStatus(response interface{}) *Status {
+	if rsp, ok := response.(interface{ GetStatus() *Status }); ok {
+		return rsp.GetStatus()
+	}
+	return nil
+}
+
+// recordMatcher finds the record by the data returned by server,
+// the json of them may be different in the naming style of fields,
+// the format of numbers and whether the zero values are omitted,
+// so they are compared in canonical form
+type recordMatcher struct {
+	records []interface{}
+	indexes map[string][]int
+}
+
+func newRecordMatcher(records []interface{}) *recordMatcher {
+	return &recordMatcher{records: records}
+}
+
+// match returns the index of the record, each record is matched
+// at most once, -1 is returned if no record is matched
+func (m *recordMatcher) match(data string) int {
+	key, ok := canonicalJSON([]byte(data))
+	if !ok {
+		return -1
+	}
+	if m.indexes == nil {
+		m.indexes = make(map[string][]int, len(m.records))
+		for i, record := range m.records {
+			if recordKey, ok := canonicalRecord(record); ok {
+				m.indexes[recordKey] = append(m.indexes[recordKey], i)
+			}
+		}
+	}
+	indexes := m.indexes[key]
+	if len(indexes) == 0 {
+		return -1
+	}
+	m.indexes[key] = indexes[1:]
+	return indexes[0]
+}
+
+func canonicalRecord(record interface{}) (string, bool) {
+	var bytes []byte
+	var err error
+	switch r := record.(type) {
+	case proto.Message:
+		bytes, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(r)
+	case string:
+		bytes = []byte(r)
+	default:
+		bytes, err = json.Marshal(r)
+	}
+	if err != nil {
+		return "", false
+	}
+	return canonicalJSON(bytes)
+}
+
+func canonicalJSON(bytes []byte) (string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+	canonical, err := json.Marshal(canonicalValue(value))
+	if err != nil {
+		return "", false
+	}
+	return string(canonical), true
+}
+
+// canonicalValue turns the names of fields to lower case without "_",
+// the scalar values to string, and drops the zero values
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		canonical := make(map[string]interface{}, len(v))
+		for key, fieldValue := range v {
+			if canonicalField := canonicalValue(fieldValue); canonicalField != nil {
+				canonical[strings.ToLower(strings.ReplaceAll(key, "_", ""))] = canonicalField
+			}
+		}
+		if len(canonical) == 0 {
+			return nil
+		}
+		return canonical
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		canonical := make([]interface{}, len(v))
+		for i, elem := range v {
+			canonical[i] = canonicalValue(elem)
+		}
+		return canonical
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			if i == 0 {
+				return nil
+			}
+			return strconv.FormatInt(i, 10)
+		}
+		if f, err := v.Float64(); err == nil {
+			if f == 0 {
+				return nil
+			}
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return v.String()
+	case string:
+		if v == "" {
+			return nil
+		}
+		return v
+	case bool:
+		if !v {
+			return nil
+		}
+		return "true"
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func user(id string) *retail.User {
+	return &retail.User{UserId: id, Age: "18"}
+}
+
+func users(ids ...string) []interface{} {
+	records := make([]interface{}, len(ids))
+	for i, id := range ids {
+		records[i] = user(id)
+	}
+	return records
+}
+
+// userError returns the error of the user returned by server, whose data is in json
+func userError(id string, message string) *retail.DataError {
+	data, _ := protojson.Marshal(user(id))
+	return &retail.DataError{Message: message, Data: string(data)}
+}
+
+func writeResponse(code int32, dataErrors ...*retail.DataError) *retail.WriteUsersResponse {
+	return &retail.WriteUsersResponse{Status: &Status{Code: code}, Errors: dataErrors}
+}
+
+func TestGetItemErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		records []interface{}
+		data    []string
+		// The index of the record matched by each data
+		expect []int
+	}{
+		{name: "order and naming of fields", records: users("1", "2"),
+			data: []string{`{"age": "18", "userId": "2"}`, `{"user_id": "1", "age": "18"}`}, expect: []int{1, 0}},
+		{name: "duplicate records are matched in turn", records: users("1", "2", "1"),
+			data:   []string{`{"user_id": "1", "age": "18"}`, `{"user_id": "1", "age": "18"}`, `{"user_id": "1", "age": "18"}`},
+			expect: []int{0, 2, -1}},
+		{name: "format of numbers", records: []interface{}{
+			map[string]interface{}{"id": 1, "price": 1.5},
+			map[string]interface{}{"id": 2, "price": 2},
+		}, data: []string{`{"id": 2.0, "price": 2e0}`, `{"id": 1, "price": 15e-1}`}, expect: []int{1, 0}},
+		{name: "zero values are omitted", records: []interface{}{
+			map[string]interface{}{"id": "1", "score": 0, "tags": []string{}, "vip": false},
+		}, data: []string{`{"id": "1"}`}, expect: []int{0}},
+		{name: "records in json", records: []interface{}{`{"id": "1"}`, `{"id": "2"}`},
+			data: []string{`{"id":"2"}`}, expect: []int{1}},
+		{name: "unknown record", records: users("1"),
+			data: []string{`{"user_id": "9", "age": "18"}`, `not json`, ``}, expect: []int{-1, -1, -1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response := writeResponse(0)
+			for _, data := range c.data {
+				response.Errors = append(response.Errors, &retail.DataError{Message: "invalid", Data: data})
+			}
+			itemErrors := GetItemErrors(response, c.records)
+			indexes := make([]int, len(itemErrors))
+			for i, itemError := range itemErrors {
+				indexes[i] = itemError.Index
+				if itemError.Index >= 0 && !reflect.DeepEqual(itemError.Record, c.records[itemError.Index]) {
+					t.Fatalf("expect the record of index %d, got %v", itemError.Index, itemError.Record)
+				}
+				if itemError.Data != c.data[i] || itemError.Message != "invalid" {
+					t.Fatalf("expect the data and message returned, got %+v", itemError)
+				}
+			}
+			if !reflect.DeepEqual(indexes, c.expect) {
+				t.Fatalf("expect indexes %v, got %v", c.expect, indexes)
+			}
+		})
+	}
+	if itemErrors := GetItemErrors(&Status{}, users("1")); itemErrors != nil {
+		t.Fatalf("expect no error of the response without GetErrors, got %v", itemErrors)
+	}
+}
+
+// fakeWrite sends the users by respond, and records the
+// request id and the user ids of each attempt
+type fakeWrite struct {
+	lock       sync.Mutex
+	respond    func(attempt int, ids []string) (proto.Message, error)
+	requestIds []string
+	sent       [][]string
+}
+
+func (w *fakeWrite) call(records []interface{}, opts ...option.Option) (proto.Message, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.(*retail.User).GetUserId()
+	}
+	attempt := len(w.sent)
+	w.sent = append(w.sent, ids)
+	w.requestIds = append(w.requestIds, getRequestId(opts))
+	return w.respond(attempt, ids)
+}
+
+// respondBy returns the responses of the attempts in order
+func respondBy(responses ...func(ids []string) (proto.Message, error)) func(int, []string) (proto.Message, error) {
+	return func(attempt int, ids []string) (proto.Message, error) {
+		if attempt >= len(responses) {
+			attempt = len(responses) - 1
+		}
+		return responses[attempt](ids)
+	}
+}
+
+// failUsers fails the users sent with the messages, the others succeed
+func failUsers(messages map[string]string) func(ids []string) (proto.Message, error) {
+	return func(ids []string) (proto.Message, error) {
+		response := writeResponse(0)
+		for _, id := range ids {
+			if message, ok := messages[id]; ok {
+				response.Errors = append(response.Errors, userError(id, message))
+			}
+		}
+		return response, nil
+	}
+}
+
+func respond(response proto.Message, err error) func(ids []string) (proto.Message, error) {
+	return func([]string) (proto.Message, error) {
+		return response, err
+	}
+}
+
+func TestDoWriteWithResubmit(t *testing.T) {
+	success := respond(writeResponse(0), nil)
+	cases := []struct {
+		name    string
+		respond func(attempt int, ids []string) (proto.Message, error)
+		// The user ids sent by each attempt
+		sent [][]string
+		// The attempts which reuse the request id of the attempt before
+		sameRequestIds []int
+		// The "index:retryable" of the records failing permanently
+		failures []string
+		errIs    error
+	}{
+		{name: "success", respond: respondBy(success), sent: [][]string{{"1", "2"}}},
+		{name: "retryable and permanent failures",
+			respond: respondBy(failUsers(map[string]string{"1": "save timeout", "2": "invalid age"}), success),
+			sent:    [][]string{{"1", "2"}, {"1"}}, failures: []string{"1:false"}},
+		{name: "index of the record resubmitted",
+			respond: respondBy(failUsers(map[string]string{"2": "server is busy"}),
+				failUsers(map[string]string{"2": "invalid gender"})),
+			sent: [][]string{{"1", "2"}, {"2"}}, failures: []string{"1:false"}},
+		{name: "field named like retryable phrase is permanent",
+			respond: respondBy(failUsers(map[string]string{"1": "field internal_id invalid"})),
+			sent:    [][]string{{"1", "2"}}, failures: []string{"0:false"}},
+		{name: "retry budget exhausted",
+			respond: respondBy(failUsers(map[string]string{"1": "server overload"})),
+			sent:    [][]string{{"1", "2"}, {"1"}, {"1"}}, failures: []string{"0:true"}},
+		{name: "network retry keeps the request id",
+			respond: respondBy(respond(nil, errTimeout), failUsers(map[string]string{"2": "timeout"}), success),
+			sent:    [][]string{{"1", "2"}, {"1", "2"}, {"2"}}, sameRequestIds: []int{1}},
+		{name: "unknown item error is permanent",
+			respond: respondBy(respond(writeResponse(0, &retail.DataError{Message: "timeout", Data: "{}"}), nil)),
+			sent:    [][]string{{"1", "2"}}, failures: []string{"-1:false"}},
+		{name: "first request fails", respond: respondBy(respond(nil, errBadRequest)),
+			sent: [][]string{{"1", "2"}}, errIs: errBadRequest},
+		{name: "first request fails by status", respond: respondBy(respond(writeResponse(400), nil)),
+			sent: [][]string{{"1", "2"}}, errIs: ErrWriteFailure},
+		{name: "resubmission fails by status",
+			respond: respondBy(failUsers(map[string]string{"1": "timeout"}), respond(writeResponse(500), nil)),
+			sent:    [][]string{{"1", "2"}, {"1"}}, failures: []string{"0:false"}, errIs: ErrWriteFailure},
+		{name: "resubmission fails by error",
+			respond: respondBy(failUsers(map[string]string{"2": "timeout"}), respond(nil, errBadRequest)),
+			sent:    [][]string{{"1", "2"}, {"2"}}, failures: []string{"1:false"}, errIs: errBadRequest},
+		{name: "resubmission exhausts network retries",
+			respond: respondBy(failUsers(map[string]string{"2": "timeout"}), respond(nil, errConnReset)),
+			sent:    [][]string{{"1", "2"}, {"2"}, {"2"}, {"2"}}, sameRequestIds: []int{2, 3},
+			failures: []string{"1:true"}, errIs: ErrRetryExhausted},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clock := newFakeClock()
+			helper := &RequestHelper{
+				RetryPolicy: &RetryPolicy{Backoff: &ConstantBackoff{Interval: time.Second}},
+				Clock:       clock,
+				Sleeper:     clock,
+			}
+			write := &fakeWrite{respond: c.respond}
+			var failures []string
+			onFailure := func(itemErrors []*ItemError) {
+				for _, itemError := range itemErrors {
+					failures = append(failures, fmt.Sprintf("%d:%v", itemError.Index, itemError.Retryable))
+				}
+			}
+			err := helper.DoWriteWithResubmit(write.call, users("1", "2"), nil, 2, onFailure)
+			if c.errIs == nil && err != nil {
+				t.Fatalf("expect success, got err:%v", err)
+			}
+			if c.errIs != nil && !errors.Is(err, c.errIs) {
+				t.Fatalf("expect err:%v, got err:%v", c.errIs, err)
+			}
+			if !reflect.DeepEqual(write.sent, c.sent) {
+				t.Fatalf("expect sent %v, got %v", c.sent, write.sent)
+			}
+			if !reflect.DeepEqual(failures, c.failures) {
+				t.Fatalf("expect failures %v, got %v", c.failures, failures)
+			}
+			// Each resubmission is a fresh request, while the
+			// retries of network exception reuse the request id
+			sameRequestIds := make(map[int]bool)
+			for _, attempt := range c.sameRequestIds {
+				sameRequestIds[attempt] = true
+			}
+			for i := 1; i < len(write.requestIds); i++ {
+				same := write.requestIds[i] == write.requestIds[i-1]
+				if write.requestIds[i] == "" || same != sameRequestIds[i] {
+					t.Fatalf("expect attempt %d reuses request id %v, got %v", i, sameRequestIds[i], write.requestIds)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRetryableItemError(t *testing.T) {
+	cases := []struct {
+		message   string
+		retryable bool
+	}{
+		{message: "save timeout", retryable: true},
+		{message: "request timed out", retryable: true},
+		{message: "Too Many Requests", retryable: true},
+		{message: "server overloaded", retryable: true},
+		{message: "internal server error", retryable: true},
+		{message: "service unavailable", retryable: true},
+		{message: "server is busy, please try again", retryable: true},
+		{message: "write fail, code:503", retryable: true},
+		{message: "status: 429", retryable: true},
+		{message: "field internal_id invalid"},
+		{message: "timeout_ms should be positive"},
+		{message: "too many tags"},
+		{message: "retry_count is invalid"},
+		{message: "invalid data, code:400"},
+		{message: ""},
+	}
+	for _, c := range cases {
+		if retryable := IsRetryableItemError(c.message); retryable != c.retryable {
+			t.Errorf("IsRetryableItemError(%q) = %v, expect %v", c.message, retryable, c.retryable)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"gopkg.in/yaml.v3"
+)
+
+// The types of FieldMapping, which coerce the value of column before it is set
+const (
+	// MappingTypeString keeps the value as string
+	MappingTypeString = "string"
+
+	MappingTypeInt = "int"
+
+	MappingTypeFloat = "float"
+
+	// MappingTypeBool accepts true/false, 1/0, yes/no, y/n in any case
+	MappingTypeBool = "bool"
+
+	// MappingTypeTimestamp parses the time by the Layout of the mapping,
+	// and sets the unix seconds, a number is treated as unix seconds
+	MappingTypeTimestamp = "timestamp"
+
+	// MappingTypeTimestampMs is same as MappingTypeTimestamp, but sets the unix milliseconds
+	MappingTypeTimestampMs = "timestamp_ms"
+
+	// MappingTypeJSON parses the value as JSON, it is used for a list,
+	// or an object of the map field, such as "extra"
+	MappingTypeJSON = "json"
+)
+
+// The layouts tried to parse the time if the Layout of mapping is empty
+var defaultTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// FieldMapping maps a column of the source to a field of the message
+type FieldMapping struct {
+	// Column is the name of the column in the source
+	Column string `json:"column" yaml:"column"`
+
+	// Field is the path of the field, see SetProtoField, such as
+	// "price.current_price". The index "*" of a repeated message field
+	// spreads the values split by Separator to the elements in order,
+	// e.g. "categories.*.category_nodes.0.id_or_name"
+	Field string `json:"field" yaml:"field"`
+
+	// Type coerces the value before it is set, such as MappingTypeTimestamp,
+	// the value is converted to the type of field if it is empty
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Layout is the layout of time.Parse for MappingTypeTimestamp, RFC3339,
+	// "2006-01-02 15:04:05" and "2006-01-02" are tried if it is empty
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
+
+	// Separator splits the value into a list for a repeated field,
+	// or the index "*" of Field, default is ","
+	Separator string `json:"separator,omitempty" yaml:"separator,omitempty"`
+
+	// Default is used when the column is missing or empty
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Required fails the row when the value is empty and there is no Default
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// MappingSpec maps the columns of flat data, such as the rows of a CSV
+// exported from warehouse, to the fields of a nested message
+type MappingSpec struct {
+	// Message is the full name of the message, such as
+	// "bytedance.byteplus.retailv2.Product", it is optional
+	// if the message is decided by the caller
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+
+	Fields []*FieldMapping `json:"fields" yaml:"fields"`
+}
+
+// LoadMappingSpec reads the spec in YAML if the extension of path is
+// ".yaml" or ".yml", otherwise in JSON
+func LoadMappingSpec(path string) (*MappingSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &MappingSpec{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, spec)
+	default:
+		err = json.Unmarshal(content, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse mapping spec fail, path:%s msg:%s", path, err.Error())
+	}
+	return spec, nil
+}
+
+// NewMessage creates an empty message of spec.Message,
+// the package of the message should be imported
+func (s *MappingSpec) NewMessage() (proto.Message, error) {
+	if s.Message == "" {
+		return nil, fmt.Errorf("message of mapping spec is empty")
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(s.Message))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message:%s", s.Message)
+	}
+	return messageType.New().Interface(), nil
+}
+
+// Validate checks the spec against the message, such as whether the fields
+// exist and the types are known, so that the mistakes are found before
+// the data is read. The message should match spec.Message if it is set
+func (s *MappingSpec) Validate(message proto.Message) error {
+	descriptor := message.ProtoReflect().Descriptor()
+	if s.Message != "" && protoreflect.FullName(s.Message) != descriptor.FullName() {
+		return fmt.Errorf("mapping spec is for %s, not %s", s.Message, descriptor.FullName())
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("mapping spec has no field")
+	}
+	for _, mapping := range s.Fields {
+		if mapping.Column == "" {
+			return fmt.Errorf("column of field %s is empty", mapping.Field)
+		}
+		switch mapping.Type {
+		case "", MappingTypeString, MappingTypeInt, MappingTypeFloat, MappingTypeBool,
+			MappingTypeTimestamp, MappingTypeTimestampMs, MappingTypeJSON:
+		default:
+			return fmt.Errorf("unknown type %s of column %s", mapping.Type, mapping.Column)
+		}
+		if strings.Count(mapping.Field, "*") > 1 {
+			return fmt.Errorf("field %s has more than one \"*\"", mapping.Field)
+		}
+		path := strings.Split(strings.Replace(mapping.Field, "*", "0", 1), ".")
+		if err := validateFieldPath(descriptor, path, mapping.Type == MappingTypeJSON); err != nil {
+			return fmt.Errorf("invalid field of column %s, %s", mapping.Column, err.Error())
+		}
+	}
+	return nil
+}
+
+func validateFieldPath(message protoreflect.MessageDescriptor, path []string, isJSON bool) error {
+	fd := findField(message, path[0])
+	if fd == nil {
+		return fmt.Errorf("unknown field %s of %s", path[0], message.FullName())
+	}
+	rest := path[1:]
+	switch {
+	case fd.IsMap():
+		// The object of JSON is set to the map by its keys
+		if len(rest) == 1 || (len(rest) == 0 && isJSON) {
+			return nil
+		}
+		return fmt.Errorf("map field %s should be followed by one key", fd.Name())
+	case fd.IsList() && fd.Message() != nil:
+		if len(rest) < 2 {
+			return fmt.Errorf("repeated field %s should be followed by index and field", fd.Name())
+		}
+		if _, err := strconv.Atoi(rest[0]); err != nil {
+			return fmt.Errorf("invalid index %s of field %s", rest[0], fd.Name())
+		}
+		return validateFieldPath(fd.Message(), rest[1:], isJSON)
+	case fd.Message() != nil:
+		if len(rest) == 0 {
+			return fmt.Errorf("message field %s should be followed by sub field", fd.Name())
+		}
+		return validateFieldPath(fd.Message(), rest, isJSON)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("field %s can't have sub field", fd.Name())
+	}
+	return nil
+}
+
+// Apply sets the fields of message by the columns of row
+func (s *MappingSpec) Apply(row *Row, message proto.Message) error {
+	for _, mapping := range s.Fields {
+		if err := mapping.apply(row, message); err != nil {
+			return fmt.Errorf("column %s: %s", mapping.Column, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *FieldMapping) apply(row *Row, message proto.Message) error {
+	value, ok := row.Fields[m.Column]
+	if !ok || isEmptyValue(value) {
+		if m.Default == "" {
+			if m.Required {
+				return fmt.Errorf("value is required")
+			}
+			return nil
+		}
+		value = m.Default
+	}
+	if strings.Contains(m.Field, "*") {
+		values, err := splitList(m.split(value))
+		if err != nil {
+			return err
+		}
+		for i, elem := range values {
+			if err := m.set(message, strings.Replace(m.Field, "*", strconv.Itoa(i), 1), elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return m.set(message, m.Field, m.split(value))
+}
+
+// split splits the string value by Separator, the value is returned
+// as it is if it isn't a string or the Separator is default
+func (m *FieldMapping) split(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok || m.Separator == "" || m.Type == MappingTypeJSON {
+		return value
+	}
+	return strings.Split(text, m.Separator)
+}
+
+func (m *FieldMapping) set(message proto.Message, path string, value interface{}) error {
+	if list, ok := value.([]string); ok {
+		values := make([]interface{}, 0, len(list))
+		for _, elem := range list {
+			if elem = strings.TrimSpace(elem); elem == "" {
+				continue
+			}
+			coerced, err := m.coerce(elem)
+			if err != nil {
+				return err
+			}
+			values = append(values, coerced)
+		}
+		return SetProtoField(message, path, values)
+	}
+	coerced, err := m.coerce(value)
+	if err != nil {
+		return err
+	}
+	if object, ok := coerced.(map[string]interface{}); ok {
+		// The object of JSON is set to the map field by its keys
+		for key, elem := range object {
+			if err := SetProtoField(message, path+"."+key, jsonScalar(elem)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return SetProtoField(message, path, coerced)
+}
+
+// coerce converts the value by the Type
+func (m *FieldMapping) coerce(value interface{}) (interface{}, error) {
+	if m.Type == "" {
+		return value, nil
+	}
+	text, err := scalarText(value)
+	if err != nil {
+		return nil, err
+	}
+	switch m.Type {
+	case MappingTypeString:
+		return text, nil
+	case MappingTypeInt:
+		i, err := parseInt(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return i, nil
+	case MappingTypeFloat:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", text)
+		}
+		return f, nil
+	case MappingTypeBool:
+		switch strings.ToLower(text) {
+		case "true", "1", "yes", "y", "t":
+			return true, nil
+		case "false", "0", "no", "n", "f":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bool %q", text)
+	case MappingTypeTimestamp, MappingTypeTimestampMs:
+		t, err := m.parseTime(text)
+		if err != nil {
+			return nil, err
+		}
+		if m.Type == MappingTypeTimestampMs {
+			return t.UnixNano() / int64(time.Millisecond), nil
+		}
+		return t.Unix(), nil
+	case MappingTypeJSON:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid json, msg:%s", err.Error())
+		}
+		if list, ok := parsed.([]interface{}); ok {
+			for i, elem := range list {
+				list[i] = jsonScalar(elem)
+			}
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", m.Type)
+}
+
+func (m *FieldMapping) parseTime(text string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	layouts := defaultTimeLayouts
+	if m.Layout != "" {
+		layouts = []string{m.Layout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", text)
+}
+
+// jsonScalar turns the nested value of JSON to string, so that
+// it can be set to a string field, such as the value of "extra"
+func jsonScalar(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		bytes, _ := json.Marshal(value)
+		return string(bytes)
+	case nil:
+		return ""
+	}
+	return value
+}
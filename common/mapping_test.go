@@ -0,0 +1,179 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMappingSpecValidate(t *testing.T) {
+	productName := string((&retail.Product{}).ProtoReflect().Descriptor().FullName())
+	cases := []struct {
+		name    string
+		spec    *MappingSpec
+		invalid bool
+	}{
+		{name: "valid", spec: &MappingSpec{Message: productName, Fields: []*FieldMapping{
+			{Column: "id", Field: "product_id"},
+			{Column: "price", Field: "price.current_price", Type: MappingTypeFloat},
+			{Column: "color", Field: "extra.color"},
+			{Column: "extra", Field: "extra", Type: MappingTypeJSON},
+			{Column: "categories", Field: "categories.*.category_nodes.0.id_or_name"},
+			{Column: "depth", Field: "categories.0.category_depth", Type: MappingTypeInt},
+			{Column: "tags", Field: "tags", Separator: "|"},
+		}}},
+		{name: "message is optional", spec: &MappingSpec{Fields: []*FieldMapping{{Column: "id", Field: "productId"}}}},
+		{name: "other message", spec: &MappingSpec{Message: "bytedance.byteplus.retail.User",
+			Fields: []*FieldMapping{{Column: "id", Field: "product_id"}}}, invalid: true},
+		{name: "no field", spec: &MappingSpec{}, invalid: true},
+		{name: "empty column", spec: &MappingSpec{Fields: []*FieldMapping{{Field: "product_id"}}}, invalid: true},
+		{name: "unknown type", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "id", Field: "product_id", Type: "long"}}}, invalid: true},
+		{name: "unknown field", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "id", Field: "product_name"}}}, invalid: true},
+		{name: "map without key", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "extra", Field: "extra"}}}, invalid: true},
+		{name: "message without sub field", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "price", Field: "price"}}}, invalid: true},
+		{name: "repeated message without index", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "depth", Field: "categories.category_depth"}}}, invalid: true},
+		{name: "more than one star", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "nodes", Field: "categories.*.category_nodes.*.id_or_name"}}}, invalid: true},
+		{name: "scalar with sub field", spec: &MappingSpec{Fields: []*FieldMapping{
+			{Column: "id", Field: "product_id.value"}}}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.spec.Validate(&retail.Product{})
+			if c.invalid && err == nil {
+				t.Fatalf("expect invalid spec")
+			}
+			if !c.invalid && err != nil {
+				t.Fatalf("expect valid spec, got err:%v", err)
+			}
+		})
+	}
+}
+
+func TestMappingSpecApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		mapping *FieldMapping
+		fields  map[string]interface{}
+		// expect is the user after the mapping is applied, it is ignored if invalid
+		expect  *retail.User
+		invalid bool
+	}{
+		{name: "string", mapping: &FieldMapping{Column: "id", Field: "user_id"},
+			fields: map[string]interface{}{"id": "1"}, expect: &retail.User{UserId: "1"}},
+		{name: "missing column", mapping: &FieldMapping{Column: "id", Field: "user_id"},
+			fields: map[string]interface{}{}, expect: &retail.User{}},
+		{name: "default", mapping: &FieldMapping{Column: "gender", Field: "gender", Default: "unknown"},
+			fields: map[string]interface{}{"gender": " "}, expect: &retail.User{Gender: "unknown"}},
+		{name: "required", mapping: &FieldMapping{Column: "id", Field: "user_id", Required: true},
+			fields: map[string]interface{}{}, invalid: true},
+		{name: "int to string field", mapping: &FieldMapping{Column: "age", Field: "age", Type: MappingTypeInt},
+			fields: map[string]interface{}{"age": "18.0"}, expect: &retail.User{Age: "18"}},
+		{name: "invalid int", mapping: &FieldMapping{Column: "age", Field: "age", Type: MappingTypeInt},
+			fields: map[string]interface{}{"age": "eighteen"}, invalid: true},
+		{name: "bool", mapping: &FieldMapping{Column: "vip", Field: "extra.vip", Type: MappingTypeBool},
+			fields: map[string]interface{}{"vip": "Y"}, expect: &retail.User{Extra: map[string]string{"vip": "true"}}},
+		{name: "invalid bool", mapping: &FieldMapping{Column: "vip", Field: "extra.vip", Type: MappingTypeBool},
+			fields: map[string]interface{}{"vip": "maybe"}, invalid: true},
+		{name: "timestamp of date",
+			mapping: &FieldMapping{Column: "registered", Field: "registration_timestamp", Type: MappingTypeTimestamp},
+			fields:  map[string]interface{}{"registered": "2021-06-15"},
+			expect:  &retail.User{RegistrationTimestamp: 1623715200}},
+		{name: "timestamp_ms by layout",
+			mapping: &FieldMapping{Column: "registered", Field: "registration_timestamp",
+				Type: MappingTypeTimestampMs, Layout: "2006/01/02 15:04"},
+			fields: map[string]interface{}{"registered": "2021/06/15 00:01"},
+			expect: &retail.User{RegistrationTimestamp: 1623715260000}},
+		{name: "timestamp of unix seconds",
+			mapping: &FieldMapping{Column: "registered", Field: "registration_timestamp", Type: MappingTypeTimestamp},
+			fields:  map[string]interface{}{"registered": json.Number("1623715200")},
+			expect:  &retail.User{RegistrationTimestamp: 1623715200}},
+		{name: "invalid timestamp",
+			mapping: &FieldMapping{Column: "registered", Field: "registration_timestamp", Type: MappingTypeTimestamp},
+			fields:  map[string]interface{}{"registered": "15/06/2021"}, invalid: true},
+		{name: "separator", mapping: &FieldMapping{Column: "tags", Field: "tags", Separator: "|"},
+			fields: map[string]interface{}{"tags": "a| b||c,d"}, expect: &retail.User{Tags: []string{"a", "b", "c,d"}}},
+		{name: "json list", mapping: &FieldMapping{Column: "tags", Field: "tags", Type: MappingTypeJSON},
+			fields: map[string]interface{}{"tags": `["a", 1]`}, expect: &retail.User{Tags: []string{"a", "1"}}},
+		{name: "json object to map", mapping: &FieldMapping{Column: "extra", Field: "extra", Type: MappingTypeJSON},
+			fields: map[string]interface{}{"extra": `{"color": "red", "size": {"cm": 2}}`},
+			expect: &retail.User{Extra: map[string]string{"color": "red", "size": `{"cm":2}`}}},
+		{name: "invalid json", mapping: &FieldMapping{Column: "extra", Field: "extra", Type: MappingTypeJSON},
+			fields: map[string]interface{}{"extra": `{"color"`}, invalid: true},
+		{name: "invalid value of field", mapping: &FieldMapping{Column: "registered", Field: "registration_timestamp"},
+			fields: map[string]interface{}{"registered": "yesterday"}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spec := &MappingSpec{Fields: []*FieldMapping{c.mapping}}
+			user := &retail.User{}
+			err := spec.Apply(&Row{Number: 1, Fields: c.fields}, user)
+			if c.invalid {
+				if err == nil {
+					t.Fatalf("expect error, got %v", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %v, got err:%v", c.expect, err)
+			}
+			if !proto.Equal(user, c.expect) {
+				t.Fatalf("expect %v, got %v", c.expect, user)
+			}
+		})
+	}
+}
+
+func TestMappingSpecApplySpreadStar(t *testing.T) {
+	spec := &MappingSpec{Fields: []*FieldMapping{
+		{Column: "categories", Field: "categories.*.category_nodes.0.id_or_name"},
+		{Column: "depths", Field: "categories.*.category_depth", Separator: "|", Type: MappingTypeInt},
+	}}
+	if err := spec.Validate(&retail.Product{}); err != nil {
+		t.Fatalf("expect valid spec, got err:%v", err)
+	}
+	product := &retail.Product{}
+	row := &Row{Number: 1, Fields: map[string]interface{}{"categories": "shoes, sports", "depths": "1|2"}}
+	if err := spec.Apply(row, product); err != nil {
+		t.Fatalf("expect applied, got err:%v", err)
+	}
+	expect := &retail.Product{Categories: []*retail.Product_Category{
+		{CategoryDepth: 1, CategoryNodes: []*retail.Product_Category_CategoryNode{{IdOrName: "shoes"}}},
+		{CategoryDepth: 2, CategoryNodes: []*retail.Product_Category_CategoryNode{{IdOrName: "sports"}}},
+	}}
+	if !proto.Equal(product, expect) {
+		t.Fatalf("expect %v, got %v", expect, product)
+	}
+}
+
+func TestLoadMappingSpec(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"spec.yaml": "message: bytedance.byteplus.retail.User\nfields:\n  - column: id\n    field: user_id\n    required: true\n",
+		"spec.json": `{"message": "bytedance.byteplus.retail.User", "fields": [{"column": "id", "field": "user_id", "required": true}]}`,
+	}
+	for name, content := range files {
+		path := dir + "/" + name
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("expect spec written, got err:%v", err)
+		}
+		spec, err := LoadMappingSpec(path)
+		if err != nil {
+			t.Fatalf("expect %s loaded, got err:%v", name, err)
+		}
+		if len(spec.Fields) != 1 || spec.Fields[0].Field != "user_id" || !spec.Fields[0].Required {
+			t.Fatalf("expect the field of user_id, got %v of %s", spec.Fields, name)
+		}
+	}
+	if _, err := LoadMappingSpec(dir + "/missing.yaml"); err == nil {
+		t.Fatalf("expect error of missing spec")
+	}
+}
@@ -0,0 +1,421 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FilterOperator compares a field of operation with the value in OperationFilter
+type FilterOperator string
+
+const (
+	FilterEqual          FilterOperator = "="
+	FilterGreater        FilterOperator = ">"
+	FilterGreaterOrEqual FilterOperator = ">="
+	FilterLess           FilterOperator = "<"
+	FilterLessOrEqual    FilterOperator = "<="
+)
+
+// OperationWorksOn is the api of import operation, used by the "worksOn" of filter
+type OperationWorksOn string
+
+const (
+	WorksOnImportUsers      OperationWorksOn = APIImportUsers
+	WorksOnImportProducts   OperationWorksOn = APIImportProducts
+	WorksOnImportUserEvents OperationWorksOn = APIImportUserEvents
+)
+
+// The fields and the keyword joining the comparisons of the filter
+const (
+	filterFieldDate    = "date"
+	filterFieldWorksOn = "worksOn"
+	filterFieldDone    = "done"
+
+	filterAnd = "and"
+	// filterOr is not supported by the api, it is only recognized to be rejected clearly
+	filterOr = "or"
+
+	filterDateLayout = "2006-01-02"
+)
+
+var (
+	filterDateOperators = []FilterOperator{
+		FilterEqual, FilterGreater, FilterGreaterOrEqual, FilterLess, FilterLessOrEqual,
+	}
+
+	filterWorksOnValues = []OperationWorksOn{
+		WorksOnImportUsers, WorksOnImportProducts, WorksOnImportUserEvents,
+	}
+)
+
+// OperationFilter is the filter of "ListOperations", which is a comparison of a field,
+// such as "date>=2021-06-15", "worksOn=ImportUsers" and "done=true", or the comparisons
+// joined by "and", as the examples of the api. The grammar is
+//
+//	filter     = comparison { "and" comparison }
+//	comparison = "date" ( "=" | ">" | ">=" | "<" | "<=" ) yyyy-mm-dd
+//	           | "worksOn" "=" ( "ImportUsers" | "ImportProducts" | "ImportUserEvents" )
+//	           | "done" "=" ( "true" | "false" )
+//
+// "and" is case insensitive. "or" and the parentheses are not documented by
+// the api, so they are rejected. The filter is built by the functions below, e.g.
+//
+//	filter, err := AllOf(DateSince(date), WorksOn(WorksOnImportUsers), Done(true)).Build()
+//
+// or parsed from a hand-written one by ParseOperationFilter. A nil
+// OperationFilter matches all the operations, and is rendered to ""
+type OperationFilter struct {
+	// The comparison, such as "done=true"
+	field    string
+	operator FilterOperator
+	value    string
+
+	// The comparisons joined by "and", nil for a comparison
+	operands []*OperationFilter
+}
+
+// DateFilter compares the date of operation with date, which is formatted in its own location
+func DateFilter(operator FilterOperator, date time.Time) *OperationFilter {
+	return &OperationFilter{field: filterFieldDate, operator: operator, value: date.Format(filterDateLayout)}
+}
+
+// DateSince selects the operations of date or after it
+func DateSince(date time.Time) *OperationFilter {
+	return DateFilter(FilterGreaterOrEqual, date)
+}
+
+// DateUntil selects the operations of date or before it
+func DateUntil(date time.Time) *OperationFilter {
+	return DateFilter(FilterLessOrEqual, date)
+}
+
+// DateRange selects the operations from the date "from" to the date "to", both are included
+func DateRange(from time.Time, to time.Time) *OperationFilter {
+	return AllOf(DateSince(from), DateUntil(to))
+}
+
+// WorksOn selects the operations of the import api
+func WorksOn(worksOn OperationWorksOn) *OperationFilter {
+	return &OperationFilter{field: filterFieldWorksOn, operator: FilterEqual, value: string(worksOn)}
+}
+
+// Done selects the operations done or not
+func Done(done bool) *OperationFilter {
+	return &OperationFilter{field: filterFieldDone, operator: FilterEqual, value: fmt.Sprint(done)}
+}
+
+// AllOf selects the operations matching all the filters, the nil filters are ignored.
+// The comparisons of the filters are joined by "and" flatly, so that AllOf(a, AllOf(b, c))
+// is "a and b and c"
+func AllOf(filters ...*OperationFilter) *OperationFilter {
+	operands := make([]*OperationFilter, 0, len(filters))
+	for _, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		if filter.isConjunction() {
+			operands = append(operands, filter.operands...)
+			continue
+		}
+		operands = append(operands, filter)
+	}
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return &OperationFilter{operands: operands}
+}
+
+// And is the same as AllOf(f, filters...)
+func (f *OperationFilter) And(filters ...*OperationFilter) *OperationFilter {
+	return AllOf(append([]*OperationFilter{f}, filters...)...)
+}
+
+// isConjunction tells whether the filter is the comparisons joined by "and"
+func (f *OperationFilter) isConjunction() bool {
+	return f.field == ""
+}
+
+// String renders the filter without validating it
+func (f *OperationFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	if !f.isConjunction() {
+		return f.field + string(f.operator) + f.value
+	}
+	comparisons := make([]string, len(f.operands))
+	for i, operand := range f.operands {
+		comparisons[i] = operand.String()
+	}
+	return strings.Join(comparisons, " "+filterAnd+" ")
+}
+
+// Build validates the filter and renders it, the error is an *InvalidOperationFilterError
+func (f *OperationFilter) Build() (string, error) {
+	if err := f.Validate(); err != nil {
+		return "", err
+	}
+	return f.String(), nil
+}
+
+// Validate checks the fields, operators and values of the comparisons by the grammar,
+// and rejects the "and" which never matches, such as an empty date range or
+// "done=true and done=false". The error is an *InvalidOperationFilterError
+func (f *OperationFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	if !f.isConjunction() {
+		return f.validateComparison()
+	}
+	if len(f.operands) == 0 {
+		return newInvalidOperationFilterError("no comparison joined by %s", filterAnd)
+	}
+	for _, operand := range f.operands {
+		if err := operand.Validate(); err != nil {
+			return err
+		}
+	}
+	return f.validateConjunction()
+}
+
+func (f *OperationFilter) validateComparison() error {
+	switch f.field {
+	case filterFieldDate:
+		if !containsOperator(filterDateOperators, f.operator) {
+			return newInvalidOperationFilterError("unsupported operator of date:%s", f.operator)
+		}
+		if _, err := time.Parse(filterDateLayout, f.value); err != nil {
+			return newInvalidOperationFilterError("invalid date:%s, it should be like 2006-01-02", f.value)
+		}
+	case filterFieldWorksOn:
+		if f.operator != FilterEqual {
+			return newInvalidOperationFilterError("unsupported operator of worksOn:%s", f.operator)
+		}
+		for _, worksOn := range filterWorksOnValues {
+			if f.value == string(worksOn) {
+				return nil
+			}
+		}
+		return newInvalidOperationFilterError("invalid worksOn:%s, it should be one of %v", f.value, filterWorksOnValues)
+	case filterFieldDone:
+		if f.operator != FilterEqual {
+			return newInvalidOperationFilterError("unsupported operator of done:%s", f.operator)
+		}
+		if f.value != "true" && f.value != "false" {
+			return newInvalidOperationFilterError("invalid done:%s, it should be true or false", f.value)
+		}
+	default:
+		return newInvalidOperationFilterError("unknown field:%s", f.field)
+	}
+	return nil
+}
+
+// validateConjunction checks the comparisons joined by "and", the
+// date range is narrowed by each of them, and it must not be empty
+func (f *OperationFilter) validateConjunction() error {
+	var since, until *time.Time
+	equals := make(map[string]*OperationFilter)
+	for _, operand := range f.operands {
+		if operand.field != filterFieldDate {
+			if other, ok := equals[operand.field]; ok && other.value != operand.value {
+				return newInvalidOperationFilterError("%s conflicts with %s", operand, other)
+			}
+			equals[operand.field] = operand
+			continue
+		}
+		date, _ := time.Parse(filterDateLayout, operand.value)
+		switch operand.operator {
+		case FilterEqual:
+			since, until = laterDate(since, date), earlierDate(until, date)
+		case FilterGreater:
+			since = laterDate(since, date.AddDate(0, 0, 1))
+		case FilterGreaterOrEqual:
+			since = laterDate(since, date)
+		case FilterLess:
+			until = earlierDate(until, date.AddDate(0, 0, -1))
+		case FilterLessOrEqual:
+			until = earlierDate(until, date)
+		}
+	}
+	if since != nil && until != nil && since.After(*until) {
+		return newInvalidOperationFilterError("empty date range:%s", f)
+	}
+	return nil
+}
+
+func laterDate(bound *time.Time, date time.Time) *time.Time {
+	if bound != nil && bound.After(date) {
+		return bound
+	}
+	return &date
+}
+
+func earlierDate(bound *time.Time, date time.Time) *time.Time {
+	if bound != nil && bound.Before(date) {
+		return bound
+	}
+	return &date
+}
+
+func containsOperator(operators []FilterOperator, operator FilterOperator) bool {
+	for _, op := range operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseOperationFilter parses and validates a hand-written filter, such as
+// "date>=2021-06-15 and worksOn=ImportUsers and done=true". The spaces around
+// the operators are allowed, while "or" and the parentheses are rejected. An empty
+// filter is parsed to nil, which matches all the operations. The error is an
+// *InvalidOperationFilterError
+func ParseOperationFilter(filter string) (*OperationFilter, error) {
+	tokens := tokenizeFilter(filter)
+	if len(tokens) == 1 {
+		// Only the end
+		return nil, nil
+	}
+	parser := &filterParser{tokens: tokens}
+	parsed, err := parser.parseConjunction()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != filterTokenEnd {
+		return nil, unexpectedFilterToken(token)
+	}
+	if err := parsed.Validate(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenWord filterTokenKind = iota
+	filterTokenOperator
+	filterTokenParen
+	filterTokenEnd
+)
+
+type filterToken struct {
+	kind   filterTokenKind
+	text   string
+	offset int
+}
+
+func (t filterToken) String() string {
+	if t.kind == filterTokenEnd {
+		return "end"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isFilterOperatorChar(c byte) bool {
+	return c == '=' || c == '>' || c == '<' || c == '!'
+}
+
+func isFilterDelimiter(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')' || isFilterOperatorChar(c)
+}
+
+// tokenizeFilter splits the filter into the words, the operators and the
+// parentheses, which are rejected by the parser, the last token is always the end
+func tokenizeFilter(filter string) []filterToken {
+	var tokens []filterToken
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{kind: filterTokenParen, text: filter[i : i+1], offset: i})
+			i++
+		case isFilterOperatorChar(c):
+			start := i
+			for i < len(filter) && isFilterOperatorChar(filter[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOperator, text: filter[start:i], offset: start})
+		default:
+			start := i
+			for i < len(filter) && !isFilterDelimiter(filter[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenWord, text: filter[start:i], offset: start})
+		}
+	}
+	return append(tokens, filterToken{kind: filterTokenEnd, offset: len(filter)})
+}
+
+// filterParser parses the tokens following the grammar of OperationFilter
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.pos]
+	if token.kind != filterTokenEnd {
+		p.pos++
+	}
+	return token
+}
+
+// isKeyword tells whether the token is the keyword, which is case insensitive
+func isKeyword(token filterToken, keyword string) bool {
+	return token.kind == filterTokenWord && strings.EqualFold(token.text, keyword)
+}
+
+// unexpectedFilterToken returns the error of the token, "or" and the parentheses
+// get a clear error, since they may be expected to work as in other filters
+func unexpectedFilterToken(token filterToken) error {
+	if token.kind == filterTokenParen || isKeyword(token, filterOr) {
+		return newInvalidOperationFilterError("unsupported %s at %d, the comparisons can only be joined by %q",
+			token, token.offset, filterAnd)
+	}
+	return newInvalidOperationFilterError("unexpected %s at %d", token, token.offset)
+}
+
+func (p *filterParser) parseConjunction() (*OperationFilter, error) {
+	comparison, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	comparisons := []*OperationFilter{comparison}
+	for isKeyword(p.peek(), filterAnd) {
+		p.next()
+		if comparison, err = p.parseComparison(); err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return AllOf(comparisons...), nil
+}
+
+func (p *filterParser) parseComparison() (*OperationFilter, error) {
+	token := p.next()
+	if token.kind == filterTokenParen || isKeyword(token, filterOr) {
+		return nil, unexpectedFilterToken(token)
+	}
+	if token.kind != filterTokenWord || isKeyword(token, filterAnd) {
+		return nil, newInvalidOperationFilterError("expect comparison at %d, got %s", token.offset, token)
+	}
+	operator := p.next()
+	if operator.kind != filterTokenOperator {
+		return nil, newInvalidOperationFilterError("expect operator at %d, got %s", operator.offset, operator)
+	}
+	value := p.next()
+	if value.kind != filterTokenWord {
+		return nil, newInvalidOperationFilterError("expect value at %d, got %s", value.offset, value)
+	}
+	return &OperationFilter{field: token.text, operator: FilterOperator(operator.text), value: value.text}, nil
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func filterDate(value string) time.Time {
+	date, _ := time.Parse(filterDateLayout, value)
+	return date
+}
+
+func TestOperationFilterBuild(t *testing.T) {
+	june15, june20 := filterDate("2021-06-15"), filterDate("2021-06-20")
+	cases := []struct {
+		name   string
+		filter *OperationFilter
+		// expect is the rendered filter, it is ignored if the filter is invalid
+		expect  string
+		invalid bool
+	}{
+		{name: "nil matches all", filter: nil, expect: ""},
+		{name: "date since", filter: DateSince(june15), expect: "date>=2021-06-15"},
+		{name: "date operator", filter: DateFilter(FilterLess, june20), expect: "date<2021-06-20"},
+		{name: "date range", filter: DateRange(june15, june20), expect: "date>=2021-06-15 and date<=2021-06-20"},
+		{name: "date range of one day", filter: DateRange(june15, june15), expect: "date>=2021-06-15 and date<=2021-06-15"},
+		{name: "example of retail",
+			filter: AllOf(DateSince(june15), WorksOn(WorksOnImportUsers), Done(true)),
+			expect: "date>=2021-06-15 and worksOn=ImportUsers and done=true"},
+		{name: "nested and is flattened",
+			filter: DateRange(june15, june20).And(Done(false)),
+			expect: "date>=2021-06-15 and date<=2021-06-20 and done=false"},
+		{name: "nested all of is flattened",
+			filter: AllOf(WorksOn(WorksOnImportUserEvents), AllOf(Done(false), DateUntil(june20))),
+			expect: "worksOn=ImportUserEvents and done=false and date<=2021-06-20"},
+		{name: "nil operands are ignored", filter: AllOf(nil, Done(true), nil), expect: "done=true"},
+		{name: "same comparison twice is allowed",
+			filter: Done(true).And(Done(true)), expect: "done=true and done=true"},
+		{name: "empty date range", filter: DateRange(june20, june15), invalid: true},
+		{name: "empty by strict operators",
+			filter:  AllOf(DateFilter(FilterGreater, june15), DateFilter(FilterLess, filterDate("2021-06-16"))),
+			invalid: true},
+		{name: "date equal out of range",
+			filter: AllOf(DateFilter(FilterEqual, june20), DateUntil(june15)), invalid: true},
+		{name: "conflicting done", filter: AllOf(Done(true), Done(false)), invalid: true},
+		{name: "conflicting worksOn",
+			filter: AllOf(WorksOn(WorksOnImportUsers), WorksOn(WorksOnImportProducts)), invalid: true},
+		{name: "unknown worksOn", filter: WorksOn("ImportContents"), invalid: true},
+		{name: "unsupported date operator", filter: DateFilter("!=", june15), invalid: true},
+		{name: "no operand", filter: AllOf(), invalid: true},
+		{name: "invalid operand in and",
+			filter: AllOf(Done(true), WorksOn("WriteUsers")), invalid: true},
+		{name: "conflict in nested all of",
+			filter: AllOf(Done(true), AllOf(WorksOn(WorksOnImportUsers), Done(false))), invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := c.filter.Build()
+			if c.invalid {
+				if !errors.Is(err, ErrInvalidOperationFilter) {
+					t.Fatalf("expect invalid filter, got %q err:%v", filter, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %q, got err:%v", c.expect, err)
+			}
+			if filter != c.expect {
+				t.Fatalf("expect %q, got %q", c.expect, filter)
+			}
+		})
+	}
+}
+
+func TestParseOperationFilter(t *testing.T) {
+	cases := []struct {
+		filter string
+		// expect is the filter rendered after parsing, it is ignored if the filter is invalid
+		expect  string
+		invalid bool
+		// unsupported means the error tells that only "and" is supported
+		unsupported bool
+	}{
+		{filter: "", expect: ""},
+		{filter: "  ", expect: ""},
+		{filter: "date>=2021-06-15 and worksOn=ImportUsers and done=true",
+			expect: "date>=2021-06-15 and worksOn=ImportUsers and done=true"},
+		{filter: "date >= 2021-06-15  AND done = false", expect: "date>=2021-06-15 and done=false"},
+		{filter: "date=2021-06-15", expect: "date=2021-06-15"},
+		{filter: "date>2021-06-15 and date<2021-06-20", expect: "date>2021-06-15 and date<2021-06-20"},
+		{filter: "done=true And worksOn=ImportUserEvents and date<=2021-06-20",
+			expect: "done=true and worksOn=ImportUserEvents and date<=2021-06-20"},
+
+		// The grammar
+		{filter: "done", invalid: true},
+		{filter: "done=", invalid: true},
+		{filter: "=true", invalid: true},
+		{filter: "done=true and", invalid: true},
+		{filter: "and done=true", invalid: true},
+		{filter: "done=true done=false", invalid: true},
+		{filter: "done==true", invalid: true},
+		{filter: "done=(true)", invalid: true},
+
+		// Only "and" is documented by the api
+		{filter: "done=true or worksOn=ImportProducts", invalid: true, unsupported: true},
+		{filter: "done=true Or done=false", invalid: true, unsupported: true},
+		{filter: "or done=true", invalid: true, unsupported: true},
+		{filter: "done=true and or worksOn=ImportUsers", invalid: true, unsupported: true},
+		{filter: "(done=true)", invalid: true, unsupported: true},
+		{filter: "(done=true", invalid: true, unsupported: true},
+		{filter: "done=true)", invalid: true, unsupported: true},
+		{filter: "()", invalid: true, unsupported: true},
+		{filter: "(done=true or worksOn=ImportProducts) and date<=2021-06-20", invalid: true, unsupported: true},
+		{filter: "done=true and (worksOn=ImportUserEvents and date<=2021-06-20)", invalid: true, unsupported: true},
+
+		// The fields, operators and values
+		{filter: "name=operations/1", invalid: true},
+		{filter: "Date>=2021-06-15", invalid: true},
+		{filter: "date!=2021-06-15", invalid: true},
+		{filter: "date>=2021/06/15", invalid: true},
+		{filter: "date>=2021-02-30", invalid: true},
+		{filter: "worksOn=importUsers", invalid: true},
+		{filter: "worksOn>=ImportUsers", invalid: true},
+		{filter: "done=yes", invalid: true},
+		{filter: "done<true", invalid: true},
+
+		// The conjunctions never match
+		{filter: "date>=2021-06-20 and date<=2021-06-15", invalid: true},
+		{filter: "done=true and done=false", invalid: true},
+		{filter: "date>2021-06-15 and done=true and date<2021-06-16", invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.filter, func(t *testing.T) {
+			parsed, err := ParseOperationFilter(c.filter)
+			if c.invalid {
+				var filterErr *InvalidOperationFilterError
+				if !errors.As(err, &filterErr) {
+					t.Fatalf("expect InvalidOperationFilterError, got %q err:%v", parsed, err)
+				}
+				if unsupported := strings.Contains(filterErr.Msg, `only be joined by "and"`); unsupported != c.unsupported {
+					t.Fatalf("expect unsupported %v, got err:%v", c.unsupported, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %q, got err:%v", c.expect, err)
+			}
+			if rendered := parsed.String(); rendered != c.expect {
+				t.Fatalf("expect %q, got %q", c.expect, rendered)
+			}
+			// The rendered filter is parsed to the same one
+			reparsed, err := ParseOperationFilter(parsed.String())
+			if err != nil || reparsed.String() != c.expect {
+				t.Fatalf("expect %q after parsing again, got %q err:%v", c.expect, reparsed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// The count of operations in a page, if it is not set
+	DefaultListOperationsPageSize = 100
+
+	DefaultListOperationsRetryTimes = 2
+)
+
+// ListOperationsConfig is the configuration of OperationIterator,
+// the zero value of each field means using the default value
+type ListOperationsConfig struct {
+	// Filter selects the operations, such as "date>=2021-06-15 and done=true"
+	Filter string
+
+	// PageSize is the count of operations in a page, default is 100
+	PageSize int
+
+	// PageToken is the "nextPageToken" of a page listed before, the listing
+	// starts from the page after it, default is starting from the first page
+	PageToken string
+
+	// MaxResults is the max count of operations returned by the iterator, 0 means no limit
+	MaxResults int
+
+	// PageTimeout is the timeout of each "ListOperations" request, default is 800ms
+	PageTimeout time.Duration
+
+	// RetryTimes is the retry times of each "ListOperations" request, default is 2.
+	// The MaxAttempts of the RetryPolicy of RequestHelper takes precedence over it
+	RetryTimes int
+}
+
+// OperationIterator walks all the operations selected by the filter, the
+// pages are requested one by one by the "DoWithRetryAlthoughOverload" of
+// RequestHelper, following the "nextPageToken" of each page, e.g.
+//
+//	itr := NewOperationIterator(ctx, requestHelper, &ListOperationsConfig{Filter: filter})
+//	for itr.Next() {
+//		operation := itr.Operation()
+//	}
+//	if err := itr.Err(); err != nil {
+//		// Continue from itr.NextPageToken() later
+//	}
+//
+// It isn't safe to be used by multiple goroutines
+type OperationIterator struct {
+	ctx           context.Context
+	requestHelper *RequestHelper
+	config        ListOperationsConfig
+
+	page      []*Operation
+	index     int
+	current   *Operation
+	returned  int
+	pageToken string
+	lastPage  bool
+	err       error
+}
+
+// NewOperationIterator creates the OperationIterator listing the operations by
+// requestHelper, no request is sent until Next is called. The listing stops
+// with the error of Err once ctx is done
+func NewOperationIterator(ctx context.Context, requestHelper *RequestHelper,
+	config *ListOperationsConfig) *OperationIterator {
+	itr := &OperationIterator{
+		ctx:           ctx,
+		requestHelper: requestHelper.ForAPI(APIListOperations),
+	}
+	if config != nil {
+		itr.config = *config
+	}
+	if itr.config.PageSize <= 0 {
+		itr.config.PageSize = DefaultListOperationsPageSize
+	}
+	if itr.config.PageTimeout <= 0 {
+		itr.config.PageTimeout = DefaultListOperationsTimeout
+	}
+	if itr.config.RetryTimes <= 0 {
+		itr.config.RetryTimes = DefaultListOperationsRetryTimes
+	}
+	itr.pageToken = itr.config.PageToken
+	return itr
+}
+
+// Next moves to the next operation, the next page is requested when the operations
+// of current page are used up. It returns false when all the operations are listed,
+// the MaxResults is reached, or an error occurs, which can be got by Err
+func (itr *OperationIterator) Next() bool {
+	itr.current = nil
+	if itr.err != nil {
+		return false
+	}
+	if itr.config.MaxResults > 0 && itr.returned >= itr.config.MaxResults {
+		return false
+	}
+	// A page may be empty although it isn't the last one
+	for itr.index >= len(itr.page) {
+		if itr.lastPage {
+			return false
+		}
+		if err := itr.fetchPage(); err != nil {
+			itr.err = err
+			return false
+		}
+	}
+	itr.current = itr.page[itr.index]
+	itr.index++
+	itr.returned++
+	return true
+}
+
+// Operation returns the current operation, it is nil if Next isn't called or returns false
+func (itr *OperationIterator) Operation() *Operation {
+	return itr.current
+}
+
+// Err returns the error stopping the listing, it is nil if all the operations are listed
+func (itr *OperationIterator) Err() error {
+	return itr.err
+}
+
+// NextPageToken returns the "nextPageToken" of the last page requested, which is
+// empty if it is the last page. If the listing is stopped by an error, a new
+// iterator with it as PageToken continues from the page failed to be requested
+func (itr *OperationIterator) NextPageToken() string {
+	return itr.pageToken
+}
+
+func (itr *OperationIterator) fetchPage() error {
+	pageSize := itr.config.PageSize
+	if remain := itr.config.MaxResults - itr.returned; itr.config.MaxResults > 0 && remain < pageSize {
+		pageSize = remain
+	}
+	request := &ListOperationsRequest{
+		Filter:    itr.config.Filter,
+		PageSize:  int32(pageSize),
+		PageToken: itr.pageToken,
+	}
+	client := itr.requestHelper.Client
+	call := func(_ context.Context, request interface{}, opts ...option.Option) (proto.Message, error) {
+		return client.ListOperations(request.(*ListOperationsRequest), opts...)
+	}
+	opts := []option.Option{
+		option.WithTimeout(itr.config.PageTimeout),
+	}
+	rspItr, err := itr.requestHelper.DoWithRetryAlthoughOverloadContext(itr.ctx, call,
+		request, opts, itr.config.RetryTimes)
+	if err != nil {
+		logs.Error("[ListOperations] list operations occur err, msg:%s", err.Error())
+		return err
+	}
+	response := rspItr.(*ListOperationsResponse)
+	if !IsSuccess(response.GetStatus()) {
+		logs.Error("[ListOperations] list operations find failure info, msg:\n%s", response.GetStatus())
+		return &ListOperationsFailureError{Status: response.GetStatus()}
+	}
+	nextPageToken := response.GetNextPageToken()
+	if nextPageToken != "" && nextPageToken == itr.pageToken {
+		// The same page would be requested endlessly
+		return fmt.Errorf("list operations return the same page token:%s", nextPageToken)
+	}
+	itr.page = response.GetOperations()
+	itr.index = 0
+	itr.pageToken = nextPageToken
+	itr.lastPage = nextPageToken == ""
+	return nil
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+)
+
+// listNames lists all the operations by itr, and returns their names
+func listNames(itr *OperationIterator) []string {
+	var names []string
+	for itr.Next() {
+		names = append(names, itr.Operation().GetName())
+	}
+	return names
+}
+
+func TestOperationIterator(t *testing.T) {
+	cases := []struct {
+		name   string
+		pages  []pageResult
+		config *ListOperationsConfig
+		expect []string
+		// The "pageToken/pageSize" of the requests
+		requests      []string
+		nextPageToken string
+		// errContains is the part of the error message expected, empty means no error
+		errContains string
+	}{
+		{name: "follow next page token", config: &ListOperationsConfig{PageSize: 2},
+			pages:    []pageResult{page("t1", "a", "b"), page("t2", "c"), page("", "d")},
+			expect:   []string{"a", "b", "c", "d"},
+			requests: []string{"/2", "t1/2", "t2/2"}},
+		{name: "default page size", pages: []pageResult{page("", "a")},
+			expect: []string{"a"}, requests: []string{"/100"}},
+		{name: "empty middle pages", config: &ListOperationsConfig{PageSize: 2},
+			pages:    []pageResult{page("t1", "a"), page("t2"), page("t3"), page("", "b")},
+			expect:   []string{"a", "b"},
+			requests: []string{"/2", "t1/2", "t2/2", "t3/2"}},
+		{name: "no operation", pages: []pageResult{page("")}, requests: []string{"/100"}},
+		{name: "start from page token", config: &ListOperationsConfig{PageSize: 2, PageToken: "t5"},
+			pages: []pageResult{page("", "f")}, expect: []string{"f"}, requests: []string{"t5/2"}},
+		{name: "max results shrinks the last page", config: &ListOperationsConfig{PageSize: 2, MaxResults: 3},
+			// The operations more than requested are not returned
+			pages:    []pageResult{page("t1", "a", "b"), page("t2", "c", "d"), page("", "e")},
+			expect:   []string{"a", "b", "c"},
+			requests: []string{"/2", "t1/1"}, nextPageToken: "t2"},
+		{name: "max results less than page size", config: &ListOperationsConfig{PageSize: 10, MaxResults: 2},
+			pages:  []pageResult{page("t1", "a", "b")},
+			expect: []string{"a", "b"}, requests: []string{"/2"}, nextPageToken: "t1"},
+		{name: "same page token", config: &ListOperationsConfig{PageSize: 1},
+			pages:    []pageResult{page("t1", "a"), page("t1", "b")},
+			expect:   []string{"a"},
+			requests: []string{"/1", "t1/1"}, nextPageToken: "t1", errContains: "same page token"},
+		{name: "failure status", pages: []pageResult{{response: &ListOperationsResponse{Status: &Status{Code: 400}}}},
+			requests: []string{"/100"}, errContains: ErrListOperationsFailure.Error()},
+		{name: "request error", pages: []pageResult{page("t1", "a"), {err: errBadRequest}},
+			expect: []string{"a"}, requests: []string{"/100", "t1/100"}, nextPageToken: "t1",
+			errContains: errBadRequest.Error()},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &fakeClient{pages: c.pages}
+			clock := newFakeClock()
+			helper := &RequestHelper{Client: client, Clock: clock, Sleeper: clock}
+			itr := NewOperationIterator(context.Background(), helper, c.config)
+			if names := listNames(itr); !reflect.DeepEqual(names, c.expect) {
+				t.Fatalf("expect %v, got %v", c.expect, names)
+			}
+			if requests := client.listOperationsRequests(); !reflect.DeepEqual(requests, c.requests) {
+				t.Fatalf("expect requests %v, got %v", c.requests, requests)
+			}
+			if token := itr.NextPageToken(); token != c.nextPageToken {
+				t.Fatalf("expect next page token %q, got %q", c.nextPageToken, token)
+			}
+			err := itr.Err()
+			if c.errContains == "" && err != nil {
+				t.Fatalf("expect no error, got err:%v", err)
+			}
+			if c.errContains != "" && (err == nil || !strings.Contains(err.Error(), c.errContains)) {
+				t.Fatalf("expect error containing %q, got err:%v", c.errContains, err)
+			}
+			// The iterator stays stopped
+			if itr.Next() || itr.Operation() != nil {
+				t.Fatalf("expect no more operation, got %v", itr.Operation())
+			}
+		})
+	}
+}
+
+func TestOperationIteratorResumeAfterError(t *testing.T) {
+	client := &fakeClient{pages: []pageResult{
+		page("t1", "a", "b"), {err: errBadRequest}, page("t2", "c"), page("", "d"),
+	}}
+	clock := newFakeClock()
+	helper := &RequestHelper{Client: client, Clock: clock, Sleeper: clock}
+	config := &ListOperationsConfig{PageSize: 2, MaxResults: 3}
+	itr := NewOperationIterator(context.Background(), helper, config)
+	names := listNames(itr)
+	if !errors.Is(itr.Err(), errBadRequest) {
+		t.Fatalf("expect request error, got err:%v", itr.Err())
+	}
+	// Continue from the page failed to be requested, the
+	// MaxResults of the new iterator counts from zero
+	config.PageToken, config.MaxResults = itr.NextPageToken(), 0
+	itr = NewOperationIterator(context.Background(), helper, config)
+	names = append(names, listNames(itr)...)
+	if err := itr.Err(); err != nil {
+		t.Fatalf("expect all listed, got err:%v", err)
+	}
+	if expect := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect %v, got %v", expect, names)
+	}
+	expectRequests := []string{"/2", "t1/1", "t1/2", "t2/2"}
+	if requests := client.listOperationsRequests(); !reflect.DeepEqual(requests, expectRequests) {
+		t.Fatalf("expect requests %v, got %v", expectRequests, requests)
+	}
+}
@@ -0,0 +1,409 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// The max count of operations polled in one round
+	defaultTrackerBatchSize = 100
+
+	// The count of "GetOperation" requests sent at the same time
+	defaultTrackerConcurrency = 4
+
+	defaultTrackerEventBuffer = 100
+)
+
+// ErrTrackerClosed is returned when tracking an operation by
+// an OperationTracker, which has been closed or is shutting down
+var ErrTrackerClosed = errors.New("operation tracker is closed")
+
+// OperationEventType tells how the tracking of an operation ends
+type OperationEventType int
+
+const (
+	// OperationDone means the operation is done, the result is in the Response of event
+	OperationDone OperationEventType = iota
+
+	// OperationLost means the server lost the operation, the Err of event is
+	// an *OperationLostError. Please send the name to bytedance to confirm
+	// whether the data has been imported
+	OperationLost
+
+	// OperationTimeout means the operation is not done within the timeout, the Err
+	// of event is a *PollingTimeoutError, the result can be got by "GetOperation" later
+	OperationTimeout
+
+	// OperationFailed means the operation can't be polled any more, such as the
+	// response of "GetOperation" can't be decoded. The transient errors of
+	// "GetOperation", such as connection refused, don't fail the operation
+	OperationFailed
+)
+
+func (t OperationEventType) String() string {
+	switch t {
+	case OperationDone:
+		return "done"
+	case OperationLost:
+		return "lost"
+	case OperationTimeout:
+		return "timeout"
+	case OperationFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("OperationEventType(%d)", int(t))
+}
+
+// OperationEvent is emitted when the tracking of an operation ends
+type OperationEvent struct {
+	Name string
+	Type OperationEventType
+
+	// Response is the result of the done operation, such as *ImportUsersResponse
+	Response proto.Message
+
+	// Err tells why the operation is not done, it is nil for OperationDone
+	Err error
+}
+
+// OperationTrackerConfig is the configuration of OperationTracker,
+// the zero value of each field means using the default value
+type OperationTrackerConfig struct {
+	// PollingInterval is the interval between the rounds of polling,
+	// default is the PollingInterval of the RetryPolicy of RequestHelper
+	PollingInterval time.Duration
+
+	// Timeout is the max time of tracking an operation, default
+	// is the PollingTimeout of the RetryPolicy of RequestHelper
+	Timeout time.Duration
+
+	// BatchSize is the max count of operations polled in one round, default is 100.
+	// The operations polled least recently are polled first, so all the
+	// operations are polled in turn when there are more than BatchSize ones
+	BatchSize int
+
+	// Concurrency is the count of "GetOperation" requests sent at the same time, default is 4
+	Concurrency int
+
+	// OnEvent receives the events in the goroutine of tracker,
+	// the events are sent to the channel of Events if it is nil
+	OnEvent func(event *OperationEvent)
+
+	// EventBuffer is the capacity of the channel of Events, default is 100
+	EventBuffer int
+}
+
+type trackedOperation struct {
+	name        string
+	newResponse func() proto.Message
+	deadline    time.Time
+}
+
+// OperationTracker tracks many import operations, such as the ones of
+// "ImportUsers", "ImportProducts" and "ImportUserEvents" of retail, instead
+// of polling each of them in its own goroutine by DoImport. The operations
+// are polled in shared batches on one schedule by the "GetOperation" of
+// RequestHelper, and an OperationEvent is emitted when an operation is done,
+// lost or timeout. The "GetOperation" requests are limited by the RateLimiter
+// of APIGetOperation in RequestHelper if it is set
+type OperationTracker struct {
+	requestHelper *RequestHelper
+	interval      time.Duration
+	timeout       time.Duration
+	batchSize     int
+	concurrency   int
+	onEvent       func(event *OperationEvent)
+	events        chan *OperationEvent
+
+	lock sync.Mutex
+	// queue keeps the operations in the order of polling
+	queue   []*trackedOperation
+	tracked map[string]bool
+	closing bool
+
+	// ctx is canceled when the shutdown deadline is exceeded, which stops polling
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewOperationTracker creates the OperationTracker polling the
+// operations by requestHelper, it starts polling in background
+func NewOperationTracker(requestHelper *RequestHelper, config *OperationTrackerConfig) *OperationTracker {
+	if config == nil {
+		config = &OperationTrackerConfig{}
+	}
+	interval := config.PollingInterval
+	if interval <= 0 {
+		interval = requestHelper.RetryPolicy.pollingInterval()
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = requestHelper.RetryPolicy.pollingTimeout()
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultTrackerBatchSize
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultTrackerConcurrency
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &OperationTracker{
+		requestHelper: requestHelper,
+		interval:      interval,
+		timeout:       timeout,
+		batchSize:     batchSize,
+		concurrency:   concurrency,
+		onEvent:       config.OnEvent,
+		tracked:       make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+	if t.onEvent == nil {
+		eventBuffer := config.EventBuffer
+		if eventBuffer <= 0 {
+			eventBuffer = defaultTrackerEventBuffer
+		}
+		t.events = make(chan *OperationEvent, eventBuffer)
+	}
+	core.AsyncExecute(t.run)
+	return t
+}
+
+// Track starts tracking the operation with the name, which is returned by
+// "ImportXXX", e.g. by RequestHelper.SubmitImportContext. The result of the done
+// operation is decoded to the message created by newResponse, such as
+// *ImportUsersResponse of retail, or to the type of its type url registered
+// in protobuf if newResponse is nil. Tracking an operation which is being
+// tracked does nothing
+func (t *OperationTracker) Track(name string, newResponse func() proto.Message) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closing {
+		return ErrTrackerClosed
+	}
+	if t.tracked[name] {
+		return nil
+	}
+	t.tracked[name] = true
+	t.queue = append(t.queue, &trackedOperation{
+		name:        name,
+		newResponse: newResponse,
+		deadline:    t.requestHelper.now().Add(t.timeout),
+	})
+	return nil
+}
+
+// Events returns the channel of the events, which is closed after the tracker
+// stops. It is nil if the OnEvent of config is set. The channel should be
+// received in time, otherwise the polling is blocked when it is full
+func (t *OperationTracker) Events() <-chan *OperationEvent {
+	return t.events
+}
+
+// Pending returns the count of the operations being tracked
+func (t *OperationTracker) Pending() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.queue)
+}
+
+// Shutdown stops accepting new operations, and waits until all the operations
+// being tracked end. If ctx is done before that, the polling is stopped,
+// and the names of the operations not ended are returned with ctx.Err()
+func (t *OperationTracker) Shutdown(ctx context.Context) ([]string, error) {
+	t.lock.Lock()
+	t.closing = true
+	t.lock.Unlock()
+	var err error
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+		t.cancel()
+		<-t.stopped
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	names := make([]string, len(t.queue))
+	for i, op := range t.queue {
+		names[i] = op.name
+	}
+	return names, err
+}
+
+// Close stops accepting new operations, and waits until all the operations being tracked end
+func (t *OperationTracker) Close() {
+	_, _ = t.Shutdown(context.Background())
+}
+
+func (t *OperationTracker) run() {
+	defer func() {
+		t.cancel()
+		if t.events != nil {
+			close(t.events)
+		}
+		close(t.stopped)
+	}()
+	for {
+		if t.finished() {
+			return
+		}
+		// Pause some time to prevent server overload
+		if err := t.requestHelper.sleep(t.ctx, t.interval); err != nil {
+			return
+		}
+		t.pollRound()
+	}
+}
+
+// finished tells whether the tracker is shutting down, and no operation is tracked
+func (t *OperationTracker) finished() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.closing && len(t.queue) == 0
+}
+
+// nextBatch takes the operations polled least recently, which are
+// moved to the end of queue, so that the next round polls the others
+func (t *OperationTracker) nextBatch() []*trackedOperation {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	size := t.batchSize
+	if size > len(t.queue) {
+		size = len(t.queue)
+	}
+	batch := append([]*trackedOperation(nil), t.queue[:size]...)
+	t.queue = append(t.queue[size:], batch...)
+	return batch
+}
+
+func (t *OperationTracker) remove(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.tracked, name)
+	for i, op := range t.queue {
+		if op.name == name {
+			t.queue = append(t.queue[:i], t.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *OperationTracker) pollRound() {
+	batch := t.nextBatch()
+	if len(batch) == 0 {
+		return
+	}
+	events := make([]*OperationEvent, len(batch))
+	semaphore := make(chan struct{}, t.concurrency)
+	var wg sync.WaitGroup
+	for i, op := range batch {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int, op *trackedOperation) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			events[i] = t.poll(op)
+		}(i, op)
+	}
+	wg.Wait()
+	if t.ctx.Err() != nil {
+		// The operations are abandoned by shutdown
+		return
+	}
+	now := t.requestHelper.now()
+	for i, op := range batch {
+		event := events[i]
+		if event == nil && !now.Before(op.deadline) {
+			logs.Error("[OperationTracker] timeout after %s, name:%s", t.timeout, op.name)
+			event = &OperationEvent{
+				Name: op.name,
+				Type: OperationTimeout,
+				Err:  &PollingTimeoutError{Name: op.name, Timeout: t.timeout},
+			}
+		}
+		if event == nil {
+			continue
+		}
+		t.remove(op.name)
+		t.emit(event)
+	}
+}
+
+// poll gets the operation, nil is returned if it is not ended
+func (t *OperationTracker) poll(op *trackedOperation) *OperationEvent {
+	if err := t.requestHelper.RateLimiters.Wait(t.ctx, APIGetOperation); err != nil {
+		return nil
+	}
+	opRsp, err := t.requestHelper.getPollingOperation(t.ctx, op.name)
+	if err != nil {
+		if IsTransientError(err) {
+			// Such as connection refused, the operation may be got later
+			logs.Warn("[OperationTracker] get operation fail, poll again, name:%s msg:%s", op.name, err.Error())
+			return nil
+		}
+		return &OperationEvent{Name: op.name, Type: OperationFailed, Err: err}
+	}
+	if opRsp == nil {
+		// The "GetOperation" is timeout, poll it again in the next round
+		return nil
+	}
+	if IsLossOperation(opRsp.GetStatus()) {
+		logs.Error("[OperationTracker] operation loss, rsp:\n%s", opRsp)
+		return &OperationEvent{Name: op.name, Type: OperationLost, Err: &OperationLostError{Name: op.name}}
+	}
+	operation := opRsp.GetOperation()
+	if !operation.GetDone() {
+		return nil
+	}
+	response, err := decodeOperationResponse(operation.GetResponse(), op.newResponse)
+	if err != nil {
+		logs.Error("[OperationTracker] parse response fail, name:%s msg:%s", op.name, err.Error())
+		return &OperationEvent{Name: op.name, Type: OperationFailed, Err: err}
+	}
+	return &OperationEvent{Name: op.name, Type: OperationDone, Response: response}
+}
+
+func (t *OperationTracker) emit(event *OperationEvent) {
+	if t.onEvent != nil {
+		t.onEvent(event)
+		return
+	}
+	select {
+	case t.events <- event:
+	case <-t.ctx.Done():
+	}
+}
+
+// decodeOperationResponse decodes the result of a done operation to the message
+// created by newResponse. If newResponse is nil, it is decoded to the type of its
+// type url, which should be registered in protobuf by importing its package
+func decodeOperationResponse(responseAny *anypb.Any, newResponse func() proto.Message) (proto.Message, error) {
+	if newResponse == nil {
+		response, err := responseAny.UnmarshalNew()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected operation response type:%s, msg:%s", responseAny.GetTypeUrl(), err.Error())
+		}
+		return response, nil
+	}
+	response := newResponse()
+	if err := proto.Unmarshal(responseAny.GetValue(), response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,321 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// trackerClient returns the scripted "GetOperation" results of each operation
+// one by one, the last one is repeated when the script is used up. The
+// operations without script are not done. The names polled are recorded in order
+type trackerClient struct {
+	fakeClient
+	lock    sync.Mutex
+	results map[string][]operationResult
+	polled  []string
+}
+
+func (c *trackerClient) GetOperation(request *GetOperationRequest, _ ...option.Option) (*OperationResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	name := request.GetName()
+	calls := 0
+	for _, polled := range c.polled {
+		if polled == name {
+			calls++
+		}
+	}
+	c.polled = append(c.polled, name)
+	results, ok := c.results[name]
+	if !ok {
+		return operationResponse(0, false, nil).response, nil
+	}
+	if calls >= len(results) {
+		calls = len(results) - 1
+	}
+	return results[calls].response, results[calls].err
+}
+
+func (c *trackerClient) polledNames() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.polled...)
+}
+
+// gateSleeper blocks the sleeping until gate is closed, so that
+// the operations can be tracked before the first round of polling
+type gateSleeper struct {
+	*fakeClock
+	gate chan struct{}
+}
+
+func (s *gateSleeper) Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-s.gate:
+	case <-ctx.Done():
+		return newCanceledError(ctx.Err())
+	}
+	return s.fakeClock.Sleep(ctx, d)
+}
+
+// startTestTracker creates the tracker polling by client on the fake clock,
+// which tracks the names before polling starts
+func startTestTracker(t *testing.T, client common.Client, config *OperationTrackerConfig, names ...string) *OperationTracker {
+	t.Helper()
+	sleeper := &gateSleeper{fakeClock: newFakeClock(), gate: make(chan struct{})}
+	helper := &RequestHelper{Client: client, Clock: sleeper.fakeClock, Sleeper: sleeper}
+	if config.PollingInterval == 0 {
+		config.PollingInterval = time.Second
+	}
+	tracker := NewOperationTracker(helper, config)
+	for _, name := range names {
+		if err := tracker.Track(name, nil); err != nil {
+			t.Fatalf("expect %s tracked, got err:%v", name, err)
+		}
+	}
+	close(sleeper.gate)
+	return tracker
+}
+
+func receiveEvents(t *testing.T, tracker *OperationTracker, count int) []*OperationEvent {
+	t.Helper()
+	events := make([]*OperationEvent, 0, count)
+	for len(events) < count {
+		select {
+		case event := <-tracker.Events():
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expect %d events, got %d", count, len(events))
+		}
+	}
+	return events
+}
+
+func TestOperationTrackerPoll(t *testing.T) {
+	result := &Status{Code: 0, Message: "imported"}
+	done := operationResponse(0, true, result)
+	cases := []struct {
+		name    string
+		results []operationResult
+		expect  OperationEventType
+		polls   int
+	}{
+		{name: "done", results: []operationResult{done}, expect: OperationDone, polls: 1},
+		{name: "not done", results: []operationResult{operationResponse(0, false, nil), done},
+			expect: OperationDone, polls: 2},
+		{name: "timeout of get operation", results: []operationResult{{err: errTimeout}, done},
+			expect: OperationDone, polls: 2},
+		{name: "transient errors", results: []operationResult{
+			{err: fmt.Errorf("dial tcp 127.0.0.1:80: %w", syscall.ECONNREFUSED)}, {err: errConnReset}, done},
+			expect: OperationDone, polls: 3},
+		{name: "bad request", results: []operationResult{{err: errBadRequest}}, expect: OperationFailed, polls: 1},
+		{name: "lost", results: []operationResult{operationResponse(core.StatusCodeOperationLoss, false, nil)},
+			expect: OperationLost, polls: 1},
+		// Polled at 1s, 2s, ..., 10s, the deadline is exceeded at the last one
+		{name: "timeout", results: []operationResult{operationResponse(0, false, nil)},
+			expect: OperationTimeout, polls: 10},
+		{name: "transient errors until timeout", results: []operationResult{{err: errConnReset}},
+			expect: OperationTimeout, polls: 10},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &trackerClient{results: map[string][]operationResult{"operations/1": c.results}}
+			tracker := startTestTracker(t, client, &OperationTrackerConfig{Timeout: 10 * time.Second}, "operations/1")
+			defer tracker.Close()
+			event := receiveEvents(t, tracker, 1)[0]
+			if event.Name != "operations/1" || event.Type != c.expect {
+				t.Fatalf("expect %s of operations/1, got %s of %s err:%v", c.expect, event.Type, event.Name, event.Err)
+			}
+			if polls := len(client.polledNames()); polls != c.polls {
+				t.Fatalf("expect %d polls, got %d", c.polls, polls)
+			}
+			switch c.expect {
+			case OperationDone:
+				if event.Err != nil || !proto.Equal(event.Response, result) {
+					t.Fatalf("expect response %v, got %v err:%v", result, event.Response, event.Err)
+				}
+			case OperationLost:
+				var lostErr *OperationLostError
+				if !errors.As(event.Err, &lostErr) {
+					t.Fatalf("expect OperationLostError, got err:%v", event.Err)
+				}
+			case OperationTimeout:
+				var timeoutErr *PollingTimeoutError
+				if !errors.As(event.Err, &timeoutErr) || timeoutErr.Timeout != 10*time.Second {
+					t.Fatalf("expect PollingTimeoutError after 10s, got err:%v", event.Err)
+				}
+			}
+			if tracker.Pending() != 0 {
+				t.Fatalf("expect no pending operation, got %d", tracker.Pending())
+			}
+		})
+	}
+}
+
+func TestOperationTrackerDecodeResponse(t *testing.T) {
+	value, _ := proto.Marshal(&retail.ImportUsersResponse{Status: &Status{Code: 0, Message: "imported"}})
+	done := func(typeUrl string) []operationResult {
+		op := &Operation{Name: "operations/1", Done: true, Response: &anypb.Any{TypeUrl: typeUrl, Value: value}}
+		return []operationResult{{response: &OperationResponse{Status: &Status{}, Operation: op}}}
+	}
+	newResponse := func() proto.Message { return &retail.ImportUsersResponse{} }
+	cases := []struct {
+		name        string
+		typeUrl     string
+		newResponse func() proto.Message
+		// errContains is the part of the error message expected, empty means done
+		errContains string
+	}{
+		{name: "registered type", typeUrl: "type.googleapis.com/bytedance.byteplus.retail.ImportUsersResponse"},
+		// The type url is not used if the type of response is given
+		{name: "given type", typeUrl: "type.googleapis.com/bytedance.byteplus.ImportUsersResponse",
+			newResponse: newResponse},
+		{name: "unknown type", typeUrl: "type.googleapis.com/bytedance.byteplus.ImportUsersResponse",
+			errContains: "unexpected operation response type"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &trackerClient{results: map[string][]operationResult{"operations/1": done(c.typeUrl)}}
+			sleeper := &gateSleeper{fakeClock: newFakeClock(), gate: make(chan struct{})}
+			helper := &RequestHelper{Client: client, Clock: sleeper.fakeClock, Sleeper: sleeper}
+			tracker := NewOperationTracker(helper, &OperationTrackerConfig{PollingInterval: time.Second, Timeout: time.Hour})
+			defer tracker.Close()
+			if err := tracker.Track("operations/1", c.newResponse); err != nil {
+				t.Fatalf("expect tracked, got err:%v", err)
+			}
+			close(sleeper.gate)
+			event := receiveEvents(t, tracker, 1)[0]
+			if c.errContains != "" {
+				if event.Type != OperationFailed || event.Err == nil || !strings.Contains(event.Err.Error(), c.errContains) {
+					t.Fatalf("expect failed with %q, got %s err:%v", c.errContains, event.Type, event.Err)
+				}
+				return
+			}
+			response, ok := event.Response.(*retail.ImportUsersResponse)
+			if event.Type != OperationDone || !ok || response.GetStatus().GetMessage() != "imported" {
+				t.Fatalf("expect ImportUsersResponse, got %s %T err:%v", event.Type, event.Response, event.Err)
+			}
+		})
+	}
+}
+
+func TestOperationTrackerBatching(t *testing.T) {
+	// Each operation is done when it is polled the second time
+	client := &trackerClient{results: map[string][]operationResult{}}
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, name := range names {
+		client.results[name] = []operationResult{operationResponse(0, false, nil), operationResponse(0, true, &Status{})}
+	}
+	config := &OperationTrackerConfig{BatchSize: 2, Concurrency: 1, Timeout: time.Hour}
+	tracker := startTestTracker(t, client, config, names...)
+	var doneNames []string
+	for _, event := range receiveEvents(t, tracker, len(names)) {
+		if event.Type != OperationDone {
+			t.Fatalf("expect %s done, got %s err:%v", event.Name, event.Type, event.Err)
+		}
+		doneNames = append(doneNames, event.Name)
+	}
+	// The operations polled least recently are polled first
+	expectPolled := []string{"a", "b", "c", "d", "e", "a", "b", "c", "d", "e"}
+	if polled := client.polledNames(); !reflect.DeepEqual(polled, expectPolled) {
+		t.Fatalf("expect polled %v, got %v", expectPolled, polled)
+	}
+	if !reflect.DeepEqual(doneNames, names) {
+		t.Fatalf("expect done %v, got %v", names, doneNames)
+	}
+	pending, err := tracker.Shutdown(context.Background())
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("expect all ended, got pending:%v err:%v", pending, err)
+	}
+	if _, ok := <-tracker.Events(); ok {
+		t.Fatalf("expect events closed after shutdown")
+	}
+}
+
+func TestOperationTrackerShutdown(t *testing.T) {
+	client := &trackerClient{}
+	tracker := startTestTracker(t, client, &OperationTrackerConfig{Timeout: time.Hour}, "a", "b")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pending, err := tracker.Shutdown(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context canceled, got err:%v", err)
+	}
+	if !reflect.DeepEqual(pending, []string{"a", "b"}) && !reflect.DeepEqual(pending, []string{"b", "a"}) {
+		t.Fatalf("expect a and b pending, got %v", pending)
+	}
+	// The abandoned operations are not emitted
+	if event, ok := <-tracker.Events(); ok {
+		t.Fatalf("expect events closed, got %s of %s", event.Type, event.Name)
+	}
+	polls := len(client.polledNames())
+	if err := tracker.Track("c", nil); err != ErrTrackerClosed {
+		t.Fatalf("expect ErrTrackerClosed, got err:%v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if after := len(client.polledNames()); after != polls {
+		t.Fatalf("expect polling stopped, got %d polls after %d", after, polls)
+	}
+}
+
+func TestOperationTrackerShutdownWaitsPending(t *testing.T) {
+	client := &trackerClient{results: map[string][]operationResult{
+		"a": {operationResponse(0, false, nil), operationResponse(0, false, nil), operationResponse(0, true, &Status{})},
+	}}
+	tracker := startTestTracker(t, client, &OperationTrackerConfig{Timeout: time.Hour}, "a")
+	result := make(chan []string, 1)
+	go func() {
+		pending, _ := tracker.Shutdown(context.Background())
+		result <- pending
+	}()
+	event := receiveEvents(t, tracker, 1)[0]
+	if event.Type != OperationDone {
+		t.Fatalf("expect a done, got %s err:%v", event.Type, event.Err)
+	}
+	if pending := <-result; len(pending) != 0 {
+		t.Fatalf("expect no pending operation, got %v", pending)
+	}
+	if polls := len(client.polledNames()); polls != 3 {
+		t.Fatalf("expect 3 polls, got %d", polls)
+	}
+}
+
+func TestOperationTrackerOnEvent(t *testing.T) {
+	client := &trackerClient{results: map[string][]operationResult{
+		"a": {operationResponse(0, true, &Status{})},
+		"b": {{err: errBadRequest}},
+	}}
+	var lock sync.Mutex
+	types := map[string]OperationEventType{}
+	config := &OperationTrackerConfig{Timeout: time.Hour, OnEvent: func(event *OperationEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		types[event.Name] = event.Type
+	}}
+	tracker := startTestTracker(t, client, config, "a", "b")
+	if tracker.Events() != nil {
+		t.Fatalf("expect no events channel with OnEvent")
+	}
+	tracker.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	expect := map[string]OperationEventType{"a": OperationDone, "b": OperationFailed}
+	if !reflect.DeepEqual(types, expect) {
+		t.Fatalf("expect %v, got %v", expect, types)
+	}
+}
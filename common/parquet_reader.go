@@ -0,0 +1,189 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	// The count of rows read from the file at one time, the memory
+	// used by the reader is bounded by it instead of the file size
+	defaultParquetReadRows = 1000
+
+	// The count of goroutines reading the columns
+	parquetReadParallel = 4
+)
+
+// parquetNode is a node of the schema tree of Parquet file
+type parquetNode struct {
+	name     string
+	element  *parquet.SchemaElement
+	children []*parquetNode
+}
+
+type parquetRowReader struct {
+	file    source.ParquetFile
+	reader  *reader.ParquetReader
+	root    *parquetNode
+	columns []string
+
+	readRows  int
+	total     int64
+	read      int64
+	buffer    []interface{}
+	bufferPos int
+}
+
+// NewParquetRowReader reads the Parquet file, the row groups are read
+// lazily, readRows rows at a time, so that a file with hundreds of millions
+// of rows can be read with bounded memory, 1000 is used if readRows <= 0.
+// The nested groups are read as map[string]interface{}, and the lists are
+// read as []interface{}, they are handled by FillMessage for the proto messages
+func NewParquetRowReader(path string, readRows int) (RowReader, error) {
+	if readRows <= 0 {
+		readRows = defaultParquetReadRows
+	}
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	parquetReader, err := reader.NewParquetReader(file, nil, parquetReadParallel)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read parquet footer fail, path:%s msg:%s", path, err.Error())
+	}
+	root := newParquetSchemaTree(parquetReader.SchemaHandler)
+	columns := make([]string, len(root.children))
+	for i, child := range root.children {
+		columns[i] = child.name
+	}
+	return &parquetRowReader{
+		file:     file,
+		reader:   parquetReader,
+		root:     root,
+		columns:  columns,
+		readRows: readRows,
+		total:    parquetReader.GetNumRows(),
+	}, nil
+}
+
+// newParquetSchemaTree builds the tree of schema elements, which are
+// stored in depth-first order with the count of children
+func newParquetSchemaTree(handler *schema.SchemaHandler) *parquetNode {
+	pos := 0
+	var build func() *parquetNode
+	build = func() *parquetNode {
+		element := handler.SchemaElements[pos]
+		node := &parquetNode{name: handler.GetExName(pos), element: element}
+		pos++
+		for i := int32(0); i < element.GetNumChildren(); i++ {
+			node.children = append(node.children, build())
+		}
+		return node
+	}
+	return build()
+}
+
+func (r *parquetRowReader) Read() (*Row, error) {
+	if r.bufferPos >= len(r.buffer) {
+		if r.read >= r.total {
+			return nil, io.EOF
+		}
+		count := int64(r.readRows)
+		if remain := r.total - r.read; remain < count {
+			count = remain
+		}
+		rows, err := r.reader.ReadByNumber(int(count))
+		if err != nil {
+			return nil, fmt.Errorf("read parquet rows fail, msg:%s", err.Error())
+		}
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		r.buffer = rows
+		r.bufferPos = 0
+	}
+	value := r.buffer[r.bufferPos]
+	// Release the row, so that it can be collected once it is written
+	r.buffer[r.bufferPos] = nil
+	r.bufferPos++
+	r.read++
+	fields, _ := r.root.convert(reflect.ValueOf(value)).(map[string]interface{})
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	return &Row{Number: r.read, Columns: r.columns, Fields: fields}, nil
+}
+
+func (r *parquetRowReader) Close() error {
+	r.reader.ReadStop()
+	return r.file.Close()
+}
+
+// convert turns the value read by parquet-go, whose type is created by
+// the schema, to the plain values keyed by the names in the file, nil
+// is returned for a null value
+func (n *parquetNode) convert(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return n.convert(v.Elem())
+	case reflect.Slice:
+		elemNode := n
+		if n.isList() {
+			elemNode = n.children[0].children[0]
+		}
+		values := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if value := elemNode.convert(v.Index(i)); value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	case reflect.Map:
+		valueNode := n
+		if n.isMap() {
+			valueNode = n.children[0].children[1]
+		}
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if value := valueNode.convert(iter.Value()); value != nil {
+				values[fmt.Sprint(iter.Key().Interface())] = value
+			}
+		}
+		return values
+	case reflect.Struct:
+		values := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField() && i < len(n.children); i++ {
+			if value := n.children[i].convert(v.Field(i)); value != nil {
+				values[n.children[i].name] = value
+			}
+		}
+		return values
+	}
+	return v.Interface()
+}
+
+// isList tells whether the node is a LIST group, whose values are read as a slice of the elements
+func (n *parquetNode) isList() bool {
+	return n.element.IsSetConvertedType() &&
+		n.element.GetConvertedType() == parquet.ConvertedType_LIST &&
+		len(n.children) == 1 && len(n.children[0].children) == 1
+}
+
+// isMap tells whether the node is a MAP group, whose values are read as a map
+func (n *parquetNode) isMap() bool {
+	return n.element.IsSetConvertedType() &&
+		n.element.GetConvertedType() == parquet.ConvertedType_MAP &&
+		len(n.children) == 1 && len(n.children[0].children) == 2
+}
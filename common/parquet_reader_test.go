@@ -0,0 +1,241 @@
+package common
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+	"google.golang.org/protobuf/proto"
+)
+
+type parquetPrice struct {
+	CurrentPrice float64  `parquet:"name=current_price, type=DOUBLE"`
+	OriginPrice  *float64 `parquet:"name=origin_price, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+type parquetCategoryNode struct {
+	IdOrName string `parquet:"name=id_or_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetCategory struct {
+	CategoryDepth int32                  `parquet:"name=category_depth, type=INT32"`
+	CategoryNodes []*parquetCategoryNode `parquet:"name=category_nodes, type=LIST"`
+}
+
+// parquetProduct is written as the Parquet file of products, with flat columns,
+// an optional nested group, the LIST of values and groups, and a MAP
+type parquetProduct struct {
+	ProductId       string             `parquet:"name=product_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Title           *string            `parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Stock           int64              `parquet:"name=stock, type=INT64"`
+	IsRecommendable bool               `parquet:"name=is_recommendable, type=BOOLEAN"`
+	Price           *parquetPrice      `parquet:"name=price, repetitiontype=OPTIONAL"`
+	Tags            []string           `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Categories      []*parquetCategory `parquet:"name=categories, type=LIST"`
+	Extra           map[string]string  `parquet:"name=extra, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+var parquetColumns = []string{"product_id", "title", "stock", "is_recommendable", "price", "tags", "categories", "extra"}
+
+// writeParquet writes the products to the Parquet file, each row group
+// has rowGroupRows products, all of them are in one row group if it is 0
+func writeParquet(t *testing.T, path string, rowGroupRows int, products ...*parquetProduct) {
+	t.Helper()
+	file, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		t.Fatalf("expect parquet file created, got err:%v", err)
+	}
+	defer file.Close()
+	parquetWriter, err := writer.NewParquetWriter(file, new(parquetProduct), 1)
+	if err != nil {
+		t.Fatalf("expect parquet writer created, got err:%v", err)
+	}
+	for i, product := range products {
+		if err := parquetWriter.Write(product); err != nil {
+			t.Fatalf("expect product written, got err:%v", err)
+		}
+		if rowGroupRows > 0 && (i+1)%rowGroupRows == 0 {
+			if err := parquetWriter.Flush(true); err != nil {
+				t.Fatalf("expect row group flushed, got err:%v", err)
+			}
+		}
+	}
+	if err := parquetWriter.WriteStop(); err != nil {
+		t.Fatalf("expect parquet file finished, got err:%v", err)
+	}
+}
+
+func TestParquetRowReader(t *testing.T) {
+	title, originPrice := "shoe", 2.5
+	products := []*parquetProduct{
+		{ProductId: "1", Title: &title, Stock: 10, IsRecommendable: true,
+			Price: &parquetPrice{CurrentPrice: 1.5, OriginPrice: &originPrice},
+			Tags:  []string{"new", "sale"},
+			Categories: []*parquetCategory{
+				{CategoryDepth: 1, CategoryNodes: []*parquetCategoryNode{{IdOrName: "shoes"}}},
+				{CategoryDepth: 2, CategoryNodes: []*parquetCategoryNode{{IdOrName: "shoes"}, {IdOrName: "sports"}}},
+			},
+			Extra: map[string]string{"color": "red", "size": "42"}},
+		// The null values are omitted, and the empty lists and maps are kept
+		{ProductId: "2", Price: &parquetPrice{CurrentPrice: 3}},
+		{ProductId: "3"},
+	}
+	expect := []map[string]interface{}{
+		{
+			"product_id": "1", "title": "shoe", "stock": int64(10), "is_recommendable": true,
+			"price": map[string]interface{}{"current_price": 1.5, "origin_price": 2.5},
+			"tags":  []interface{}{"new", "sale"},
+			"categories": []interface{}{
+				map[string]interface{}{"category_depth": int32(1), "category_nodes": []interface{}{
+					map[string]interface{}{"id_or_name": "shoes"},
+				}},
+				map[string]interface{}{"category_depth": int32(2), "category_nodes": []interface{}{
+					map[string]interface{}{"id_or_name": "shoes"}, map[string]interface{}{"id_or_name": "sports"},
+				}},
+			},
+			"extra": map[string]interface{}{"color": "red", "size": "42"},
+		},
+		{
+			"product_id": "2", "stock": int64(0), "is_recommendable": false,
+			"price": map[string]interface{}{"current_price": float64(3)},
+			"tags":  []interface{}{}, "categories": []interface{}{}, "extra": map[string]interface{}{},
+		},
+		{
+			"product_id": "3", "stock": int64(0), "is_recommendable": false,
+			"tags": []interface{}{}, "categories": []interface{}{}, "extra": map[string]interface{}{},
+		},
+	}
+	path := t.TempDir() + "/products.parquet"
+	writeParquet(t, path, 0, products...)
+	reader, err := OpenRowReader(path, "")
+	if err != nil {
+		t.Fatalf("expect reader opened, got err:%v", err)
+	}
+	defer reader.Close()
+	for i, fields := range expect {
+		row, err := reader.Read()
+		if err != nil {
+			t.Fatalf("expect row %d, got err:%v", i+1, err)
+		}
+		if row.Number != int64(i+1) || !reflect.DeepEqual(row.Columns, parquetColumns) || row.Raw != nil {
+			t.Fatalf("expect row %d with the columns of the file, got %d %v", i+1, row.Number, row.Columns)
+		}
+		if !reflect.DeepEqual(row.Fields, fields) {
+			t.Fatalf("expect fields of row %d:\n%#v\ngot:\n%#v", i+1, fields, row.Fields)
+		}
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Fatalf("expect EOF, got err:%v", err)
+	}
+}
+
+func TestParquetRowReaderFillMessage(t *testing.T) {
+	title := "shoe"
+	path := t.TempDir() + "/products.parquet"
+	writeParquet(t, path, 0, &parquetProduct{ProductId: "1", Title: &title, IsRecommendable: true,
+		Price: &parquetPrice{CurrentPrice: 1.5},
+		Tags:  []string{"new", "sale"},
+		Categories: []*parquetCategory{
+			{CategoryDepth: 1, CategoryNodes: []*parquetCategoryNode{{IdOrName: "shoes"}}},
+		},
+		Extra: map[string]string{"color": "red"}})
+	reader, err := NewParquetRowReader(path, 0)
+	if err != nil {
+		t.Fatalf("expect reader opened, got err:%v", err)
+	}
+	defer reader.Close()
+	row, err := reader.Read()
+	if err != nil {
+		t.Fatalf("expect row read, got err:%v", err)
+	}
+	// The stock column is not a field of product
+	delete(row.Fields, "stock")
+	row.Columns = append(row.Columns[:2], row.Columns[3:]...)
+	product := &retail.Product{}
+	if err := FillMessage(product, row); err != nil {
+		t.Fatalf("expect product filled, got err:%v", err)
+	}
+	expect := &retail.Product{ProductId: "1", Title: "shoe", IsRecommendable: true,
+		Price: &retail.Product_Price{CurrentPrice: 1.5},
+		Tags:  []string{"new", "sale"},
+		Categories: []*retail.Product_Category{
+			{CategoryDepth: 1, CategoryNodes: []*retail.Product_Category_CategoryNode{{IdOrName: "shoes"}}},
+		},
+		Extra: map[string]string{"color": "red"}}
+	if !proto.Equal(product, expect) {
+		t.Fatalf("expect %v, got %v", expect, product)
+	}
+}
+
+func TestParquetRowReaderPages(t *testing.T) {
+	const total = 25
+	products := make([]*parquetProduct, total)
+	for i := range products {
+		products[i] = &parquetProduct{ProductId: string(rune('a' + i)), Stock: int64(i),
+			Tags: []string{string(rune('a' + i))}}
+	}
+	cases := []struct {
+		name         string
+		readRows     int
+		rowGroupRows int
+	}{
+		{name: "pages in one row group", readRows: 4},
+		{name: "read rows divides total", readRows: 5},
+		{name: "one row at a time", readRows: 1},
+		{name: "default read rows", readRows: 0},
+		{name: "pages across row groups", readRows: 3, rowGroupRows: 7},
+		{name: "page larger than row group", readRows: 10, rowGroupRows: 4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := t.TempDir() + "/products.parquet"
+			writeParquet(t, path, c.rowGroupRows, products...)
+			reader, err := NewParquetRowReader(path, c.readRows)
+			if err != nil {
+				t.Fatalf("expect reader opened, got err:%v", err)
+			}
+			defer reader.Close()
+			expectRowGroups := 1
+			if c.rowGroupRows > 0 {
+				expectRowGroups = (total + c.rowGroupRows - 1) / c.rowGroupRows
+			}
+			if rowGroups := len(reader.(*parquetRowReader).reader.Footer.GetRowGroups()); rowGroups != expectRowGroups {
+				t.Fatalf("expect %d row groups, got %d", expectRowGroups, rowGroups)
+			}
+			for i := 0; i < total; i++ {
+				row, err := reader.Read()
+				if err != nil {
+					t.Fatalf("expect row %d, got err:%v", i+1, err)
+				}
+				id := string(rune('a' + i))
+				if row.Number != int64(i+1) || row.Fields["product_id"] != id || row.Fields["stock"] != int64(i) ||
+					!reflect.DeepEqual(row.Fields["tags"], []interface{}{id}) {
+					t.Fatalf("expect row %d of product %s, got %d %v", i+1, id, row.Number, row.Fields)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := reader.Read(); err != io.EOF {
+					t.Fatalf("expect EOF after the last row, got err:%v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParquetRowReaderInvalidFile(t *testing.T) {
+	path := t.TempDir() + "/products.parquet"
+	if err := os.WriteFile(path, []byte("product_id\n1\n"), 0644); err != nil {
+		t.Fatalf("expect file written, got err:%v", err)
+	}
+	if _, err := NewParquetRowReader(path, 0); err == nil || !strings.Contains(err.Error(), "read parquet footer fail") {
+		t.Fatalf("expect footer error, got err:%v", err)
+	}
+	if _, err := NewParquetRowReader(path+".missing", 0); !os.IsNotExist(err) {
+		t.Fatalf("expect file not exist, got err:%v", err)
+	}
+}
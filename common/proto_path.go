@@ -0,0 +1,277 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The separator of the values of a repeated field in a string,
+// such as the "tags" column of CSV
+const defaultListSeparator = ","
+
+// SetProtoField sets the field of message by the path, which is the names of
+// fields separated by ".", such as "price.current_price" of Product.
+// The element of a repeated message field is selected by the index,
+// such as "categories.0.category_depth", which is appended if the index
+// equals the length, and the value of a map field is selected by the key,
+// such as "extra.color". The name can be the proto name or the json name.
+// The value is converted to the type of the field, it can be a string,
+// a json.Number, a bool, a float64, or a slice of them for a repeated field,
+// a string of a repeated field is split by ",". An empty string is ignored.
+// The value of a message or map field can be a map[string]interface{} keyed
+// by the names of its fields or its keys, and the value of a repeated message
+// field can be a []interface{} of them, such as the nested groups of Parquet
+func SetProtoField(message proto.Message, path string, value interface{}) error {
+	if path == "" {
+		return fmt.Errorf("empty field path")
+	}
+	return setField(message.ProtoReflect(), strings.Split(path, "."), value)
+}
+
+func setField(m protoreflect.Message, path []string, value interface{}) error {
+	fd := findField(m.Descriptor(), path[0])
+	if fd == nil {
+		return fmt.Errorf("unknown field %s of %s", path[0], m.Descriptor().FullName())
+	}
+	// The parent messages of an empty value aren't created either
+	if isEmptyValue(value) {
+		return nil
+	}
+	rest := path[1:]
+	switch {
+	case fd.IsMap():
+		if object, ok := value.(map[string]interface{}); ok && len(rest) == 0 {
+			for key, elem := range object {
+				if err := setField(m, []string{path[0], key}, elem); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(rest) != 1 {
+			return fmt.Errorf("map field %s should be followed by one key", fd.Name())
+		}
+		mapValue, err := convertScalar(fd.MapValue(), value)
+		if err != nil {
+			return fmt.Errorf("field %s.%s: %s", fd.Name(), rest[0], err.Error())
+		}
+		m.Mutable(fd).Map().Set(protoreflect.ValueOfString(rest[0]).MapKey(), mapValue)
+		return nil
+	case fd.IsList() && fd.Message() != nil:
+		if values, ok := value.([]interface{}); ok && len(rest) == 0 {
+			list := m.Mutable(fd).List()
+			for _, elem := range values {
+				element := list.NewElement()
+				if err := setMessage(element.Message(), elem); err != nil {
+					return fmt.Errorf("field %s: %s", fd.Name(), err.Error())
+				}
+				list.Append(element)
+			}
+			return nil
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("repeated field %s should be followed by index and field", fd.Name())
+		}
+		index, err := strconv.Atoi(rest[0])
+		if err != nil || index < 0 {
+			return fmt.Errorf("invalid index %s of field %s", rest[0], fd.Name())
+		}
+		list := m.Mutable(fd).List()
+		for list.Len() <= index {
+			list.Append(list.NewElement())
+		}
+		return setField(list.Get(index).Message(), rest[1:], value)
+	case fd.IsList():
+		if len(rest) != 0 {
+			return fmt.Errorf("repeated field %s can't have sub field", fd.Name())
+		}
+		values, err := splitList(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", fd.Name(), err.Error())
+		}
+		list := m.Mutable(fd).List()
+		for _, elem := range values {
+			v, err := convertScalar(fd, elem)
+			if err != nil {
+				return fmt.Errorf("field %s: %s", fd.Name(), err.Error())
+			}
+			list.Append(v)
+		}
+		return nil
+	case fd.Message() != nil:
+		if _, ok := value.(map[string]interface{}); ok && len(rest) == 0 {
+			return setMessage(m.Mutable(fd).Message(), value)
+		}
+		if len(rest) == 0 {
+			return fmt.Errorf("message field %s should be followed by sub field", fd.Name())
+		}
+		return setField(m.Mutable(fd).Message(), rest, value)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("field %s can't have sub field", fd.Name())
+	}
+	v, err := convertScalar(fd, value)
+	if err != nil {
+		return fmt.Errorf("field %s: %s", fd.Name(), err.Error())
+	}
+	m.Set(fd, v)
+	return nil
+}
+
+// setMessage sets the fields of message by the object keyed by the names of fields
+func setMessage(m protoreflect.Message, value interface{}) error {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s should be an object, not %v", m.Descriptor().FullName(), value)
+	}
+	for name, elem := range object {
+		if err := setField(m, []string{name}, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findField(message protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := message.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+func isEmptyValue(value interface{}) bool {
+	s, ok := value.(string)
+	return value == nil || (ok && strings.TrimSpace(s) == "")
+}
+
+func splitList(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return v, nil
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, elem := range v {
+			values[i] = elem
+		}
+		return values, nil
+	case string:
+		var values []interface{}
+		for _, elem := range strings.Split(v, defaultListSeparator) {
+			if elem = strings.TrimSpace(elem); elem != "" {
+				values = append(values, elem)
+			}
+		}
+		return values, nil
+	}
+	return []interface{}{value}, nil
+}
+
+// convertScalar converts the value to the type of the field
+func convertScalar(fd protoreflect.FieldDescriptor, value interface{}) (protoreflect.Value, error) {
+	text, err := scalarText(value)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(text)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid bool %q", text)
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := parseInt(text, 32)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt32(int32(i)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := parseInt(text, 64)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfInt64(i), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := strconv.ParseUint(text, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint32 %q", text)
+		}
+		return protoreflect.ValueOfUint32(uint32(i)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		i, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint64 %q", text)
+		}
+		return protoreflect.ValueOfUint64(i), nil
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid float %q", text)
+		}
+		return protoreflect.ValueOfFloat32(float32(f)), nil
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid double %q", text)
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case protoreflect.EnumKind:
+		if enumValue := fd.Enum().Values().ByName(protoreflect.Name(text)); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		i, err := parseInt(text, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid enum %q", text)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
+
+func scalarText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// parseInt parses the integer, which may be written as a float, such as "1.0"
+func parseInt(text string, bitSize int) (int64, error) {
+	i, err := strconv.ParseInt(text, 10, bitSize)
+	if err == nil {
+		return i, nil
+	}
+	if f, floatErr := strconv.ParseFloat(text, 64); floatErr == nil && f == float64(int64(f)) {
+		if i, err = strconv.ParseInt(strconv.FormatInt(int64(f), 10), 10, bitSize); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid int%d %q", bitSize, text)
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestSetProtoField(t *testing.T) {
+	cases := []struct {
+		name  string
+		path  string
+		value interface{}
+		// expect is the product after the field is set, it is ignored if invalid
+		expect  *retail.Product
+		invalid bool
+	}{
+		{name: "string", path: "product_id", value: " 1 ", expect: &retail.Product{ProductId: "1"}},
+		{name: "json name", path: "productId", value: "1", expect: &retail.Product{ProductId: "1"}},
+		{name: "empty string is ignored", path: "product_id", value: "  ", expect: &retail.Product{}},
+		{name: "nil is ignored", path: "price.current_price", value: nil, expect: &retail.Product{}},
+		{name: "empty value appends no element", path: "categories.0.category_depth", value: "",
+			expect: &retail.Product{}},
+		{name: "bool", path: "is_recommendable", value: "true",
+			expect: &retail.Product{IsRecommendable: true}},
+		{name: "double of json number", path: "quality_score", value: json.Number("3.5"),
+			expect: &retail.Product{QualityScore: 3.5}},
+		{name: "nested float", path: "price.current_price", value: 9.5,
+			expect: &retail.Product{Price: &retail.Product_Price{CurrentPrice: 9.5}}},
+		{name: "int written as float", path: "categories.0.category_depth", value: "2.0",
+			expect: &retail.Product{Categories: []*retail.Product_Category{{CategoryDepth: 2}}}},
+		{name: "index appends elements", path: "categories.1.category_depth", value: json.Number("2"),
+			expect: &retail.Product{Categories: []*retail.Product_Category{{}, {CategoryDepth: 2}}}},
+		{name: "repeated string split by comma", path: "tags", value: "a, b,,c",
+			expect: &retail.Product{Tags: []string{"a", "b", "c"}}},
+		{name: "repeated string of slice", path: "tags", value: []interface{}{"a", "b"},
+			expect: &retail.Product{Tags: []string{"a", "b"}}},
+		{name: "map value by key", path: "extra.color", value: "red",
+			expect: &retail.Product{Extra: map[string]string{"color": "red"}}},
+		{name: "map of object", path: "extra", value: map[string]interface{}{"color": "red", "size": json.Number("2")},
+			expect: &retail.Product{Extra: map[string]string{"color": "red", "size": "2"}}},
+		{name: "message of object", path: "price",
+			value:  map[string]interface{}{"current_price": json.Number("1.5"), "originPrice": "2"},
+			expect: &retail.Product{Price: &retail.Product_Price{CurrentPrice: 1.5, OriginPrice: 2}}},
+		{name: "repeated message of objects", path: "categories",
+			value: []interface{}{
+				map[string]interface{}{"category_depth": json.Number("1")},
+				map[string]interface{}{"category_depth": json.Number("2")},
+			},
+			expect: &retail.Product{Categories: []*retail.Product_Category{{CategoryDepth: 1}, {CategoryDepth: 2}}}},
+
+		{name: "empty path", path: "", value: "1", invalid: true},
+		{name: "unknown field", path: "product_name", value: "1", invalid: true},
+		{name: "invalid bool", path: "is_recommendable", value: "maybe", invalid: true},
+		{name: "invalid int", path: "categories.0.category_depth", value: "1.5", invalid: true},
+		{name: "int32 overflow", path: "categories.0.category_depth", value: "3000000000", invalid: true},
+		{name: "scalar with sub field", path: "product_id.id", value: "1", invalid: true},
+		{name: "message without sub field", path: "price", value: "1", invalid: true},
+		{name: "map without key", path: "extra", value: "red", invalid: true},
+		{name: "map with nested key", path: "extra.color.name", value: "red", invalid: true},
+		{name: "repeated message without index", path: "categories", value: "1", invalid: true},
+		{name: "negative index", path: "categories.-1.category_depth", value: "1", invalid: true},
+		{name: "repeated scalar with sub field", path: "tags.0", value: "a", invalid: true},
+		{name: "object of unknown field", path: "price", value: map[string]interface{}{"discount": "1"},
+			invalid: true},
+		{name: "unsupported value", path: "product_id", value: []int{1}, invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			product := &retail.Product{}
+			err := SetProtoField(product, c.path, c.value)
+			if c.invalid {
+				if err == nil {
+					t.Fatalf("expect error, got %v", product)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %v, got err:%v", c.expect, err)
+			}
+			if !proto.Equal(product, c.expect) {
+				t.Fatalf("expect %v, got %v", c.expect, product)
+			}
+		})
+	}
+}
+
+func TestSetProtoFieldEnum(t *testing.T) {
+	cases := []struct {
+		value   interface{}
+		expect  descriptorpb.FieldDescriptorProto_Type
+		invalid bool
+	}{
+		{value: "TYPE_STRING", expect: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+		{value: "9", expect: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+		{value: json.Number("3"), expect: descriptorpb.FieldDescriptorProto_TYPE_INT64},
+		{value: "type_string", invalid: true},
+		{value: "STRING", invalid: true},
+	}
+	for _, c := range cases {
+		field := &descriptorpb.FieldDescriptorProto{}
+		err := SetProtoField(field, "type", c.value)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("expect error of enum %v, got %v", c.value, field.GetType())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expect %v, got err:%v", c.expect, err)
+		}
+		if field.GetType() != c.expect {
+			t.Fatalf("expect %v of %v, got %v", c.expect, c.value, field.GetType())
+		}
+	}
+}
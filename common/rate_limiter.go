@@ -0,0 +1,260 @@
+package common
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+)
+
+// The names of apis, used to select the RateLimiter in RateLimiterGroup
+const (
+	APIWriteUsers           = "WriteUsers"
+	APIWriteProducts        = "WriteProducts"
+	APIWriteUserEvents      = "WriteUserEvents"
+	APIWriteContents        = "WriteContents"
+	APIImportUsers          = "ImportUsers"
+	APIImportProducts       = "ImportProducts"
+	APIImportUserEvents     = "ImportUserEvents"
+	APIWriteData            = "WriteData"
+	APIDone                 = "Done"
+	APIPredict              = "Predict"
+	APIAckServerImpressions = "AckServerImpressions"
+	APICallback             = "Callback"
+	APIGetOperation         = "GetOperation"
+	APIListOperations       = "ListOperations"
+)
+
+const (
+	// The rate is multiplied by it when server is overload
+	defaultRateDecreaseFactor = 0.5
+
+	// The rate can't be decreased again in this interval, so that the
+	// overload responses of the requests sent at the same time only
+	// decrease the rate once
+	rateDecreaseInterval = time.Second
+)
+
+// RateLimiterConfig is the configuration of RateLimiter,
+// the zero value of each field except QPS means using the default value
+type RateLimiterConfig struct {
+	// The maximum count of requests sent per second, it must be positive,
+	// otherwise the requests are not limited
+	QPS float64
+
+	// The count of requests can be sent at the same moment, default is 1
+	Burst int
+
+	// The rate never decreases below MinQPS, default is 1/10 of QPS
+	MinQPS float64
+
+	// The rate is multiplied by DecreaseFactor when server is overload,
+	// default is 0.5
+	DecreaseFactor float64
+
+	// The rate increases by IncreaseStep after each not overload response,
+	// until it reaches QPS again, default is 1/100 of QPS
+	IncreaseStep float64
+
+	// Clock decides when the tokens are refilled, and Sleeper waits for
+	// the tokens, SystemClock is used if they are nil
+	Clock   Clock
+	Sleeper Sleeper
+}
+
+// RateLimiter is a token bucket which limits the rate of sending requests.
+// The rate is adjusted by AIMD, additive increase after success and
+// multiplicative decrease after server overload, so that the client slows
+// down before burning the retries against the quota, and recovers afterwards
+type RateLimiter struct {
+	lock           sync.Mutex
+	maxRate        float64
+	minRate        float64
+	rate           float64
+	burst          float64
+	decreaseFactor float64
+	increaseStep   float64
+	tokens         float64
+	lastRefill     time.Time
+	lastDecrease   time.Time
+	clock          Clock
+	sleeper        Sleeper
+}
+
+// NewRateLimiter creates the RateLimiter by config, nil is returned
+// if config is nil or its QPS isn't positive, which never blocks
+func NewRateLimiter(config *RateLimiterConfig) *RateLimiter {
+	if config == nil || config.QPS <= 0 || math.IsInf(config.QPS, 0) || math.IsNaN(config.QPS) {
+		return nil
+	}
+	clock := config.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	sleeper := config.Sleeper
+	if sleeper == nil {
+		sleeper = SystemClock
+	}
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = 1
+	}
+	minRate := config.MinQPS
+	if minRate <= 0 || minRate > config.QPS {
+		minRate = config.QPS / 10
+	}
+	decreaseFactor := config.DecreaseFactor
+	if decreaseFactor <= 0 || decreaseFactor >= 1 {
+		decreaseFactor = defaultRateDecreaseFactor
+	}
+	increaseStep := config.IncreaseStep
+	if increaseStep <= 0 {
+		increaseStep = config.QPS / 100
+	}
+	return &RateLimiter{
+		maxRate:        config.QPS,
+		minRate:        minRate,
+		rate:           config.QPS,
+		burst:          burst,
+		decreaseFactor: decreaseFactor,
+		increaseStep:   increaseStep,
+		tokens:         burst,
+		lastRefill:     clock.Now(),
+		clock:          clock,
+		sleeper:        sleeper,
+	}
+}
+
+// Wait blocks until a request is allowed to be sent,
+// it returns a *CanceledError immediately once ctx is done.
+// A nil RateLimiter never blocks
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.lock.Lock()
+		l.refill(l.clock.Now())
+		if l.tokens >= 1 {
+			l.tokens--
+			l.lock.Unlock()
+			return nil
+		}
+		waitTime := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.lock.Unlock()
+		if err := l.sleeper.Sleep(ctx, waitTime); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens = math.Min(l.burst, l.tokens+elapsed*l.rate)
+	l.lastRefill = now
+}
+
+// OnOverload decreases the rate multiplicatively,
+// and drops the saved tokens to stop the burst
+func (l *RateLimiter) OnOverload() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	if now.Sub(l.lastDecrease) < rateDecreaseInterval {
+		return
+	}
+	l.refill(now)
+	l.rate = math.Max(l.minRate, l.rate*l.decreaseFactor)
+	l.tokens = math.Min(l.tokens, 0)
+	l.lastDecrease = now
+}
+
+// OnSuccess increases the rate additively, until it reaches the configured QPS
+func (l *RateLimiter) OnSuccess() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill(l.clock.Now())
+	l.rate = math.Min(l.maxRate, l.rate+l.increaseStep)
+}
+
+// Rate returns the current count of requests allowed per second
+func (l *RateLimiter) Rate() float64 {
+	if l == nil {
+		return math.Inf(1)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rate
+}
+
+// RateLimiterGroup holds a RateLimiter for each api, it can be shared by
+// several RequestHelper and ConcurrentHelper to limit the total rate.
+// The apis without RateLimiter are not limited
+type RateLimiterGroup struct {
+	limiters map[string]*RateLimiter
+}
+
+// NewRateLimiterGroup creates a RateLimiter for each api in configs,
+// the keys are the api names, such as APIWriteUsers
+func NewRateLimiterGroup(configs map[string]*RateLimiterConfig) *RateLimiterGroup {
+	limiters := make(map[string]*RateLimiter, len(configs))
+	for api, config := range configs {
+		if limiter := NewRateLimiter(config); limiter != nil {
+			limiters[api] = limiter
+		}
+	}
+	return &RateLimiterGroup{limiters: limiters}
+}
+
+// Get returns the RateLimiter of the api, nil is returned if it isn't limited
+func (g *RateLimiterGroup) Get(api string) *RateLimiter {
+	if g == nil {
+		return nil
+	}
+	return g.limiters[api]
+}
+
+// Wait blocks until a request of the api is allowed to be sent,
+// it returns a *CanceledError immediately once ctx is done
+func (g *RateLimiterGroup) Wait(ctx context.Context, api string) error {
+	return g.Get(api).Wait(ctx)
+}
+
+// feedback adjusts the rate of the api by the status of response
+func (g *RateLimiterGroup) feedback(api string, response interface{}) {
+	limiter := g.Get(api)
+	if limiter == nil {
+		return
+	}
+	rsp, ok := response.(interface{ GetStatus() *Status })
+	if ok && rsp.GetStatus() != nil && IsServerOverload(rsp.GetStatus()) {
+		limiter.OnOverload()
+		return
+	}
+	limiter.OnSuccess()
+}
+
+type apiContextKey struct{}
+
+// WithAPI returns a copy of ctx carrying the api name, the requests sent by
+// the "XxxContext" methods of RequestHelper with it are limited by the
+// RateLimiter of the api
+func WithAPI(ctx context.Context, api string) context.Context {
+	return context.WithValue(ctx, apiContextKey{}, api)
+}
+
+func apiFromContext(ctx context.Context) string {
+	api, _ := ctx.Value(apiContextKey{}).(string)
+	return api
+}
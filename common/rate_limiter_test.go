@@ -0,0 +1,118 @@
+package common
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+)
+
+func newFakeRateLimiter(clock *fakeClock, config RateLimiterConfig) *RateLimiter {
+	config.Clock = clock
+	config.Sleeper = clock
+	return NewRateLimiter(&config)
+}
+
+func TestNewRateLimiterInvalidQPS(t *testing.T) {
+	for _, qps := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		limiter := NewRateLimiter(&RateLimiterConfig{QPS: qps})
+		if limiter != nil {
+			t.Fatalf("expect no limiter for qps %v, got rate %v", qps, limiter.Rate())
+		}
+		// A nil limiter never blocks
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("expect not blocked, got err:%v", err)
+		}
+	}
+	if limiter := NewRateLimiter(nil); limiter != nil {
+		t.Fatalf("expect no limiter for nil config")
+	}
+	group := NewRateLimiterGroup(map[string]*RateLimiterConfig{APIWriteUsers: {QPS: 0}, APIDone: nil})
+	if group.Get(APIWriteUsers) != nil || group.Get(APIDone) != nil {
+		t.Fatalf("expect the apis without positive qps not limited")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newFakeRateLimiter(clock, RateLimiterConfig{QPS: 10, Burst: 2})
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("expect allowed, got err:%v", err)
+		}
+	}
+	// The burst is used up by the first 2, then a token is refilled every 100ms
+	sleeps := clock.sleepTimes()
+	if len(sleeps) != 2 || sleeps[0] != 100*time.Millisecond || sleeps[1] != 100*time.Millisecond {
+		t.Fatalf("expect to wait 100ms twice, got %v", sleeps)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !IsCanceledError(err) {
+		t.Fatalf("expect CanceledError, got err:%v", err)
+	}
+}
+
+func TestRateLimiterAIMD(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newFakeRateLimiter(clock, RateLimiterConfig{QPS: 100, MinQPS: 20, IncreaseStep: 10})
+	expectRate := func(expect float64) {
+		t.Helper()
+		if rate := limiter.Rate(); math.Abs(rate-expect) > 1e-9 {
+			t.Fatalf("expect rate %v, got %v", expect, rate)
+		}
+	}
+	limiter.OnOverload()
+	expectRate(50)
+	// The overloads in the same interval only decrease once
+	limiter.OnOverload()
+	expectRate(50)
+	_ = clock.Sleep(context.Background(), rateDecreaseInterval)
+	limiter.OnOverload()
+	expectRate(25)
+	_ = clock.Sleep(context.Background(), rateDecreaseInterval)
+	limiter.OnOverload()
+	expectRate(20)
+	for i := 0; i < 5; i++ {
+		limiter.OnSuccess()
+	}
+	expectRate(70)
+	for i := 0; i < 5; i++ {
+		limiter.OnSuccess()
+	}
+	expectRate(100)
+}
+
+func TestRateLimiterOverloadDropTokens(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newFakeRateLimiter(clock, RateLimiterConfig{QPS: 10, Burst: 5})
+	limiter.OnOverload()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("expect allowed, got err:%v", err)
+	}
+	// The saved tokens are dropped, and a token is refilled in 1/5s by the decreased rate
+	if sleeps := clock.sleepTimes(); len(sleeps) != 1 || sleeps[0] != 200*time.Millisecond {
+		t.Fatalf("expect to wait 200ms, got %v", sleeps)
+	}
+}
+
+func TestRateLimiterGroupFeedback(t *testing.T) {
+	clock := newFakeClock()
+	group := NewRateLimiterGroup(map[string]*RateLimiterConfig{
+		APIWriteUsers: {QPS: 100, Clock: clock, Sleeper: clock},
+	})
+	limiter := group.Get(APIWriteUsers)
+	group.feedback(APIWriteUsers, &OperationResponse{Status: &Status{Code: core.StatusCodeTooManyRequest}})
+	if rate := limiter.Rate(); rate != 50 {
+		t.Fatalf("expect rate decreased to 50 by overload, got %v", rate)
+	}
+	group.feedback(APIWriteUsers, &OperationResponse{Status: &Status{}})
+	if rate := limiter.Rate(); rate != 51 {
+		t.Fatalf("expect rate increased to 51 by success, got %v", rate)
+	}
+	// The apis without limiter are ignored
+	group.feedback(APIDone, &OperationResponse{Status: &Status{}})
+}
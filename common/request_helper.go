@@ -1,7 +1,7 @@
 package common
 
 import (
-	"errors"
+	"context"
 	"github.com/byteplus-sdk/sdk-go/common"
 	. "github.com/byteplus-sdk/sdk-go/common/protocol"
 	"github.com/byteplus-sdk/sdk-go/core"
@@ -10,45 +10,111 @@ import (
 	"github.com/google/uuid"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
-	"math"
-	"math/rand"
 	"reflect"
 	"time"
 )
 
-const (
-	// The maximum time for polling the execution results of the import task
-	pollingTimeout = 10 * time.Second
-
-	// The time interval between requests during polling
-	pollingInterval = 100 * time.Millisecond
-
-	// The interval base of retry for server overload
-	overloadRetryInterval = 200 * time.Millisecond
+type Call func(request interface{}, opts ...option.Option) (proto.Message, error)
 
-	getOperationTimeout = 500 * time.Millisecond
-)
+// ContextCall is the context-aware version of Call.
+// The ctx is the one passed to the "XxxContext" methods of RequestHelper,
+// a call that supports cancellation should give up once ctx is done.
+type ContextCall func(ctx context.Context, request interface{}, opts ...option.Option) (proto.Message, error)
 
-type Call func(request interface{}, opts ...option.Option) (proto.Message, error)
+// WithContext adapts a Call to ContextCall, the ctx is ignored by the call
+// itself, but RequestHelper still stops retrying once ctx is done
+func (call Call) WithContext() ContextCall {
+	return func(_ context.Context, request interface{}, opts ...option.Option) (proto.Message, error) {
+		return call(request, opts...)
+	}
+}
 
 type RequestHelper struct {
 	Client common.Client
+
+	// RetryPolicy controls retrying and polling, DefaultRetryPolicy is used if it is nil
+	RetryPolicy *RetryPolicy
+
+	// RateLimiters limits the rate of sending requests of each api,
+	// the api is the one carried by ctx through WithAPI, or set by ForAPI.
+	// The requests are not limited if it is nil
+	RateLimiters *RateLimiterGroup
+
+	// Clock decides the polling deadline, and Sleeper waits between the
+	// retries and the polls, SystemClock is used if they are nil.
+	// A fake one makes the retrying and polling deterministic in tests
+	Clock   Clock
+	Sleeper Sleeper
+
+	api string
+}
+
+// ForAPI returns a copy of RequestHelper, whose requests are limited
+// by the RateLimiter of the api, unless another api is carried by ctx
+func (h *RequestHelper) ForAPI(api string) *RequestHelper {
+	helper := *h
+	helper.api = api
+	return &helper
+}
+
+func (h *RequestHelper) now() time.Time {
+	if h.Clock == nil {
+		return SystemClock.Now()
+	}
+	return h.Clock.Now()
+}
+
+func (h *RequestHelper) sleep(ctx context.Context, d time.Duration) error {
+	if h.Sleeper == nil {
+		return SystemClock.Sleep(ctx, d)
+	}
+	return h.Sleeper.Sleep(ctx, d)
 }
 
 func (h *RequestHelper) DoImport(call Call, request interface{},
 	response proto.Message, opts []option.Option, retryTimes int) error {
+	return h.DoImportContext(context.Background(), call.WithContext(), request, response, opts, retryTimes)
+}
+
+// DoImportContext
+// Same as DoImport, but stops retrying, waiting and polling import result
+// as soon as ctx is canceled or its deadline is exceeded,
+// a *CanceledError is returned in this case.
+func (h *RequestHelper) DoImportContext(ctx context.Context, call ContextCall, request interface{},
+	response proto.Message, opts []option.Option, retryTimes int) error {
+	name, err := h.SubmitImportContext(ctx, call, request, opts, retryTimes)
+	if err != nil {
+		return err
+	}
+	return h.PollImportContext(ctx, name, response)
+}
+
+// SubmitImportContext
+// The first half of DoImportContext, which sends the import request,
+// and returns the name of the operation without polling it, so that
+// the name can be recorded, such as in Checkpoint, and polled by
+// PollImportContext later, even after the process restarts
+func (h *RequestHelper) SubmitImportContext(ctx context.Context, call ContextCall, request interface{},
+	opts []option.Option, retryTimes int) (string, error) {
 	// To ensure that the request is successfully received by the server,
 	// it should be retried after network or overload exception occurs.
-	opRspItr, err := h.DoWithRetryAlthoughOverload(call, request, opts, retryTimes)
+	opRspItr, err := h.DoWithRetryAlthoughOverloadContext(ctx, call, request, opts, retryTimes)
 	if err != nil {
-		return err
+		return "", err
 	}
 	opRsp := opRspItr.(*OperationResponse)
 	if !IsUploadSuccess(opRsp.GetStatus()) {
 		logs.Error("[PollingImportResponse] server return error info, rsp:\n%s", opRsp)
-		return errors.New("import return failure info")
+		return "", &ImportFailureError{Status: opRsp.GetStatus()}
 	}
-	return h.pollingResponse(opRsp.GetOperation().GetName(), response)
+	return opRsp.GetOperation().GetName(), nil
+}
+
+// PollImportContext
+// The second half of DoImportContext, which polls the operation
+// until it is done, and parses the result of import to response
+func (h *RequestHelper) PollImportContext(ctx context.Context, name string, response proto.Message) error {
+	return h.pollingResponse(ctx, name, response)
 }
 
 // DoWithRetryAlthoughOverload
@@ -63,30 +129,59 @@ func (h *RequestHelper) DoImport(call Call, request interface{},
 // @return error   return by task or server still overload after retry
 func (h *RequestHelper) DoWithRetryAlthoughOverload(call Call, request interface{},
 	opts []option.Option, retryTimes int) (proto.Message, error) {
-	if retryTimes < 0 {
-		retryTimes = 0
-	}
+	return h.DoWithRetryAlthoughOverloadContext(context.Background(), call.WithContext(), request, opts, retryTimes)
+}
+
+// DoWithRetryAlthoughOverloadContext
+// Same as DoWithRetryAlthoughOverload, but the wait before requesting again
+// is interrupted as soon as ctx is done, and a *CanceledError is returned.
+func (h *RequestHelper) DoWithRetryAlthoughOverloadContext(ctx context.Context, call ContextCall,
+	request interface{}, opts []option.Option, retryTimes int) (proto.Message, error) {
+	retryTimes = h.RetryPolicy.retryTimes(retryTimes)
 	tryTimes := retryTimes + 1
+	var waitTime time.Duration
+	var lastStatus *Status
 	for i := 0; i < tryTimes; i++ {
-		response, err := h.DoWithRetry(call, request, opts, retryTimes-i)
+		response, err := h.doWithRetry(ctx, call, request, opts, retryTimes-i)
 		if err != nil {
 			return nil, err
 		}
-		if IsServerOverload(getStatus(response)) {
+		lastStatus = getStatus(response)
+		if h.RetryPolicy.shouldRetry(lastStatus) {
+			if i == tryTimes-1 {
+				// No attempt is left, return without waiting
+				break
+			}
 			// Wait some time before request again,
 			// and the wait time will increase by the number of retried
-			time.Sleep(randomOverloadWaitTime(i))
+			waitTime = h.RetryPolicy.backoff(i, waitTime)
+			if err := h.sleep(ctx, waitTime); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		return response, nil
 	}
-	return nil, errors.New("server overload")
+	return nil, &OverloadExhaustedError{Attempts: tryTimes, Status: lastStatus}
 }
 
 func (h *RequestHelper) DoWithRetry(call Call, request interface{},
 	opts []option.Option, retryTimes int) (proto.Message, error) {
+	return h.DoWithRetryContext(context.Background(), call.WithContext(), request, opts, retryTimes)
+}
+
+// DoWithRetryContext
+// Same as DoWithRetry, but no more attempt is made once ctx is done,
+// a *CanceledError is returned in this case.
+func (h *RequestHelper) DoWithRetryContext(ctx context.Context, call ContextCall,
+	request interface{}, opts []option.Option, retryTimes int) (proto.Message, error) {
+	return h.doWithRetry(ctx, call, request, opts, h.RetryPolicy.retryTimes(retryTimes))
+}
+
+func (h *RequestHelper) doWithRetry(ctx context.Context, call ContextCall,
+	request interface{}, opts []option.Option, retryTimes int) (proto.Message, error) {
 	// To ensure the request is successfully received by the server,
-	// it should be retried after a network exception occurs.
+	// it should be retried after a timeout or transient network exception occurs.
 	// To prevent the retry from causing duplicate uploading same data,
 	// the request should be retried by using the same requestId.
 	// If a new requestId is used, it will be treated as a new request
@@ -96,18 +191,47 @@ func (h *RequestHelper) DoWithRetry(call Call, request interface{},
 		retryTimes = 0
 	}
 	tryTimes := retryTimes + 1
+	api := apiFromContext(ctx)
+	if api == "" {
+		api = h.api
+	}
+	var waitTime time.Duration
 	for i := 0; i < tryTimes; i++ {
-		response, err := call(request, opts...)
+		if ctx.Err() != nil {
+			return nil, newCanceledError(ctx.Err())
+		}
+		// Every attempt takes a token, retrying too fast is
+		// also limited to avoid server overload
+		if err := h.RateLimiters.Wait(ctx, api); err != nil {
+			return nil, err
+		}
+		response, err := call(ctx, request, opts...)
 		if err != nil {
-			if core.IsTimeoutError(err) {
+			if ctx.Err() != nil {
+				// The call may fail because of the canceled ctx,
+				// in which case the error should not be treated as a network error
+				return nil, newCanceledError(ctx.Err())
+			}
+			if h.RetryPolicy.isRetryableError(err) {
 				if i == tryTimes-1 {
-					logs.Error("[DoRetryRequest] fail finally after retried {} times", tryTimes)
-					return nil, errors.New("still fail after retry")
+					logs.Error("[DoRetryRequest] fail finally after retried %d times", tryTimes)
+					return nil, &RetryExhaustedError{Attempts: tryTimes, LastErr: err}
+				}
+				logs.Warn("[DoRetryRequest] request fail, will retry, msg:%s", err.Error())
+				// A timeout request has waited long enough, while the other
+				// transient exceptions, such as connection refused, usually
+				// return immediately, so wait some time before request again
+				if !core.IsTimeoutError(err) {
+					waitTime = h.RetryPolicy.backoff(i, waitTime)
+					if err := h.sleep(ctx, waitTime); err != nil {
+						return nil, err
+					}
 				}
 				continue
 			}
 			return nil, err
 		}
+		h.RateLimiters.feedback(api, response)
 		return response, nil
 	}
 	return nil, nil
@@ -128,28 +252,37 @@ func getStatus(response interface{}) *Status {
 	return statusField.Interface().(*Status)
 }
 
-func randomOverloadWaitTime(retriedTimes int) time.Duration {
-	const increaseSpeed = 3
-	if retriedTimes < 0 {
-		return overloadRetryInterval
+// sleepContext pauses the current goroutine for at least the duration d,
+// it returns a *CanceledError immediately once ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return newCanceledError(ctx.Err())
+	case <-timer.C:
+		return nil
 	}
-	rate := 1.0 + rand.Float64()*math.Pow(increaseSpeed, float64(retriedTimes))
-	return time.Duration(float64(overloadRetryInterval) * rate)
 }
 
-func (h *RequestHelper) pollingResponse(name string, response proto.Message) error {
-	responseAny, err := h.doPollingResponse(name)
+func (h *RequestHelper) pollingResponse(ctx context.Context, name string, response proto.Message) error {
+	responseAny, err := h.doPollingResponse(ctx, name)
 	if err != nil {
 		return err
 	}
 	return proto.Unmarshal(responseAny.Value, response)
 }
 
-func (h *RequestHelper) doPollingResponse(name string) (*anypb.Any, error) {
+func (h *RequestHelper) doPollingResponse(ctx context.Context, name string) (*anypb.Any, error) {
 	// Set the polling expiration time to prevent endless polling
-	endTime := time.Now().Add(pollingTimeout)
-	for ; time.Now().Before(endTime); {
-		opRsp, err := h.getPollingOperation(name)
+	pollingTimeout := h.RetryPolicy.pollingTimeout()
+	endTime := h.now().Add(pollingTimeout)
+	for h.now().Before(endTime) {
+		if ctx.Err() != nil {
+			logs.Warn("[PollingResponse] stop polling, name:%s msg:%s", name, ctx.Err().Error())
+			return nil, newCanceledError(ctx.Err())
+		}
+		opRsp, err := h.getPollingOperation(ctx, name)
 		if err != nil {
 			return nil, err
 		}
@@ -158,6 +291,9 @@ func (h *RequestHelper) doPollingResponse(name string) (*anypb.Any, error) {
 			// until the maximum polling time is exceeded, as long as there is
 			// no obvious error that should not continue, such as server telling
 			// operation lost, parse response body fail, etc
+			if err := h.sleep(ctx, h.RetryPolicy.pollingInterval()); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		// The server may lose operation information due to unexpected failure.
@@ -165,7 +301,7 @@ func (h *RequestHelper) doPollingResponse(name string) (*anypb.Any, error) {
 		// to confirm whether the data in this request has been successfully imported
 		if IsLossOperation(opRsp.GetStatus()) {
 			logs.Error("[PollingResponse] operation loss, rsp:\n%s", opRsp)
-			return nil, errors.New("operation loss")
+			return nil, &OperationLostError{Name: name}
 		}
 		op := opRsp.GetOperation()
 		// The task corresponding to this operation has been completed,
@@ -174,15 +310,38 @@ func (h *RequestHelper) doPollingResponse(name string) (*anypb.Any, error) {
 			return op.Response, nil
 		}
 		// Pause some time to prevent server overload
-		time.Sleep(pollingInterval)
+		if err := h.sleep(ctx, h.RetryPolicy.pollingInterval()); err != nil {
+			return nil, err
+		}
 	}
 	logs.Error("[PollingResponse] timeout after %s", pollingTimeout)
-	return nil, errors.New("polling import result timeout")
+	return nil, &PollingTimeoutError{Name: name, Timeout: pollingTimeout}
 }
 
-func (h *RequestHelper) getPollingOperation(name string) (*OperationResponse, error) {
+// getPollingOperation gets the operation, it returns a *CanceledError as soon as
+// ctx is done, without waiting for the "GetOperation" in flight, whose
+// result is discarded, because the client doesn't support cancellation
+func (h *RequestHelper) getPollingOperation(ctx context.Context, name string) (*OperationResponse, error) {
 	request := &GetOperationRequest{Name: name}
-	response, err := h.Client.GetOperation(request, option.WithTimeout(getOperationTimeout))
+	type result struct {
+		response *OperationResponse
+		err      error
+	}
+	// Buffered, so that the goroutine can exit after ctx is done
+	resultCh := make(chan result, 1)
+	go func() {
+		response, err := h.Client.GetOperation(request, option.WithTimeout(h.RetryPolicy.getOperationTimeout()))
+		resultCh <- result{response: response, err: err}
+	}()
+	var response *OperationResponse
+	var err error
+	select {
+	case <-ctx.Done():
+		logs.Warn("[PollingResponse] stop getting operation, name:%s msg:%s", name, ctx.Err().Error())
+		return nil, newCanceledError(ctx.Err())
+	case r := <-resultCh:
+		response, err = r.response, r.err
+	}
 	if err != nil {
 		if core.IsTimeoutError(err) {
 			// Should not return the NetException.
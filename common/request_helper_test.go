@@ -0,0 +1,618 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var (
+	errTimeout    = errors.New("[netError] Post \"http://127.0.0.1\": context deadline exceeded (Client.Timeout exceeded), timeout")
+	errConnReset  = errors.New("read tcp 127.0.0.1:80: connection reset by peer")
+	errBadRequest = errors.New("invalid request, msg:bad param")
+)
+
+// fakeCall returns the scripted results one by one, the last one is
+// repeated when the script is used up, and records the request id of each attempt
+type fakeCall struct {
+	lock       sync.Mutex
+	results    []callResult
+	requestIds []string
+}
+
+type callResult struct {
+	status *Status
+	err    error
+}
+
+func newFakeCall(results ...callResult) *fakeCall {
+	return &fakeCall{results: results}
+}
+
+func (c *fakeCall) call(_ interface{}, opts ...option.Option) (proto.Message, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	attempt := len(c.requestIds)
+	c.requestIds = append(c.requestIds, getRequestId(opts))
+	if attempt >= len(c.results) {
+		attempt = len(c.results) - 1
+	}
+	result := c.results[attempt]
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &OperationResponse{Status: result.status}, nil
+}
+
+func (c *fakeCall) attempts() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.requestIds)
+}
+
+func (c *fakeCall) sameRequestId() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, requestId := range c.requestIds {
+		if requestId == "" || requestId != c.requestIds[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func fail(err error) callResult {
+	return callResult{err: err}
+}
+
+func status(code int32) callResult {
+	return callResult{status: &Status{Code: code}}
+}
+
+// fakeClient returns the scripted "GetOperation" results one by one,
+// the last one is repeated when the script is used up. The "ListOperations"
+// returns the scripted pages one by one, and records the requests
+type fakeClient struct {
+	lock    sync.Mutex
+	results []operationResult
+	calls   int
+
+	pages        []pageResult
+	listRequests []*ListOperationsRequest
+}
+
+type operationResult struct {
+	response *OperationResponse
+	err      error
+}
+
+func (c *fakeClient) GetOperation(*GetOperationRequest, ...option.Option) (*OperationResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	i := c.calls
+	c.calls++
+	if i >= len(c.results) {
+		i = len(c.results) - 1
+	}
+	return c.results[i].response, c.results[i].err
+}
+
+type pageResult struct {
+	response *ListOperationsResponse
+	err      error
+}
+
+// page returns the page of the operations with the names
+func page(nextPageToken string, names ...string) pageResult {
+	operations := make([]*Operation, len(names))
+	for i, name := range names {
+		operations[i] = &Operation{Name: name, Done: true}
+	}
+	return pageResult{response: &ListOperationsResponse{
+		Status:        &Status{Code: core.StatusCodeSuccess},
+		Operations:    operations,
+		NextPageToken: nextPageToken,
+	}}
+}
+
+func (c *fakeClient) ListOperations(request *ListOperationsRequest, _ ...option.Option) (*ListOperationsResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	i := len(c.listRequests)
+	c.listRequests = append(c.listRequests, proto.Clone(request).(*ListOperationsRequest))
+	if i >= len(c.pages) {
+		return nil, errors.New("no more page")
+	}
+	return c.pages[i].response, c.pages[i].err
+}
+
+func (c *fakeClient) Done([]time.Time, string, ...option.Option) (*DoneResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) Release() {
+}
+
+func (c *fakeClient) getOperationCalls() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.calls
+}
+
+// listOperationsRequests returns the "pageToken/pageSize" of the "ListOperations" requests
+func (c *fakeClient) listOperationsRequests() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var requests []string
+	for _, request := range c.listRequests {
+		requests = append(requests, fmt.Sprintf("%s/%d", request.GetPageToken(), request.GetPageSize()))
+	}
+	return requests
+}
+
+func operationResponse(code int32, done bool, response proto.Message) operationResult {
+	op := &Operation{Name: "operations/1", Done: done}
+	if response != nil {
+		op.Response, _ = anypb.New(response)
+	}
+	return operationResult{response: &OperationResponse{Status: &Status{Code: code}, Operation: op}}
+}
+
+func TestDoWithRetryAttempts(t *testing.T) {
+	cases := []struct {
+		name       string
+		results    []callResult
+		retryTimes int
+		attempts   int
+		// errIs is the expected error, nil means success
+		errIs error
+	}{
+		{name: "success", results: []callResult{status(0)}, retryTimes: 2, attempts: 1},
+		{name: "recover from timeout", results: []callResult{fail(errTimeout), fail(errTimeout), status(0)},
+			retryTimes: 2, attempts: 3},
+		{name: "recover from connection reset", results: []callResult{fail(errConnReset), status(0)},
+			retryTimes: 2, attempts: 2},
+		{name: "timeout exhausted", results: []callResult{fail(errTimeout)},
+			retryTimes: 2, attempts: 3, errIs: ErrRetryExhausted},
+		{name: "negative retry times", results: []callResult{fail(errTimeout)},
+			retryTimes: -1, attempts: 1, errIs: ErrRetryExhausted},
+		{name: "permanent error", results: []callResult{fail(errBadRequest), status(0)},
+			retryTimes: 2, attempts: 1, errIs: errBadRequest},
+		{name: "overload is not retried", results: []callResult{status(core.StatusCodeTooManyRequest)},
+			retryTimes: 2, attempts: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			call := newFakeCall(c.results...)
+			_, err := fastRetryHelper().DoWithRetry(call.call, nil, nil, c.retryTimes)
+			if c.errIs == nil && err != nil {
+				t.Fatalf("expect success, got err:%v", err)
+			}
+			if c.errIs != nil && !errors.Is(err, c.errIs) {
+				t.Fatalf("expect err:%v, got err:%v", c.errIs, err)
+			}
+			if attempts := call.attempts(); attempts != c.attempts {
+				t.Fatalf("expect %d attempts, got %d", c.attempts, attempts)
+			}
+			if !call.sameRequestId() {
+				t.Fatalf("expect same request id across retries, got %v", call.requestIds)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryKeepCallerRequestId(t *testing.T) {
+	call := newFakeCall(fail(errTimeout), status(0))
+	opts := []option.Option{option.WithRequestId("caller-request-id")}
+	if _, err := fastRetryHelper().DoWithRetry(call.call, nil, opts, 2); err != nil {
+		t.Fatalf("expect success, got err:%v", err)
+	}
+	for _, requestId := range call.requestIds {
+		if requestId != "caller-request-id" {
+			t.Fatalf("expect the request id of caller, got %v", call.requestIds)
+		}
+	}
+}
+
+func TestDoWithRetryAlthoughOverload(t *testing.T) {
+	overload := status(core.StatusCodeTooManyRequest)
+	cases := []struct {
+		name       string
+		results    []callResult
+		retryTimes int
+		attempts   int
+		errIs      error
+		// The expected status code of the response when success
+		code int32
+	}{
+		{name: "success", results: []callResult{status(0)}, retryTimes: 2, attempts: 1},
+		{name: "recover from overload", results: []callResult{overload, overload, status(0)},
+			retryTimes: 2, attempts: 3},
+		{name: "overload exhausted", results: []callResult{overload},
+			retryTimes: 2, attempts: 3, errIs: ErrServerOverload},
+		{name: "failure status is returned", results: []callResult{status(400)},
+			retryTimes: 2, attempts: 1, code: 400},
+		{name: "timeout then overload", results: []callResult{fail(errTimeout), overload, status(0)},
+			retryTimes: 2, attempts: 3},
+		{name: "permanent error", results: []callResult{overload, fail(errBadRequest)},
+			retryTimes: 2, attempts: 2, errIs: errBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			call := newFakeCall(c.results...)
+			response, err := fastRetryHelper().DoWithRetryAlthoughOverload(call.call, nil, nil, c.retryTimes)
+			if c.errIs != nil {
+				if !errors.Is(err, c.errIs) {
+					t.Fatalf("expect err:%v, got err:%v", c.errIs, err)
+				}
+			} else if err != nil {
+				t.Fatalf("expect success, got err:%v", err)
+			} else if code := getStatus(response).GetCode(); code != c.code {
+				t.Fatalf("expect status code %d, got %d", c.code, code)
+			}
+			if attempts := call.attempts(); attempts != c.attempts {
+				t.Fatalf("expect %d attempts, got %d", c.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestOverloadExhaustedErrorDetail(t *testing.T) {
+	call := newFakeCall(status(core.StatusCodeTooManyRequest))
+	_, err := fastRetryHelper().DoWithRetryAlthoughOverload(call.call, nil, nil, 1)
+	var overloadErr *OverloadExhaustedError
+	if !errors.As(err, &overloadErr) {
+		t.Fatalf("expect OverloadExhaustedError, got err:%v", err)
+	}
+	if overloadErr.Attempts != 2 || !IsServerOverload(overloadErr.Status) {
+		t.Fatalf("expect 2 attempts with overload status, got %v", overloadErr)
+	}
+}
+
+func TestDoWithRetryAlthoughOverloadWaitBackoff(t *testing.T) {
+	interval := 20 * time.Millisecond
+	helper := &RequestHelper{RetryPolicy: &RetryPolicy{Backoff: &ConstantBackoff{Interval: interval}}}
+	overload := status(core.StatusCodeTooManyRequest)
+	call := newFakeCall(overload, overload, status(0))
+	start := time.Now()
+	if _, err := helper.DoWithRetryAlthoughOverload(call.call, nil, nil, 2); err != nil {
+		t.Fatalf("expect success, got err:%v", err)
+	}
+	// Waits twice before the second and the third attempts
+	if elapsed := time.Since(start); elapsed < 2*interval || elapsed > 2*interval+time.Second {
+		t.Fatalf("expect to wait about %s, got %s", 2*interval, elapsed)
+	}
+}
+
+func TestBackoffBounds(t *testing.T) {
+	base := 10 * time.Millisecond
+	cases := []struct {
+		name    string
+		policy  *RetryPolicy
+		retried int
+		prev    time.Duration
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "constant", policy: &RetryPolicy{Backoff: &ConstantBackoff{Interval: base}},
+			retried: 3, min: base, max: base},
+		{name: "exponential", policy: &RetryPolicy{Backoff: &ExponentialBackoff{Base: base, Factor: 2}},
+			retried: 3, min: 8 * base, max: 8 * base},
+		{name: "exponential with jitter",
+			policy:  &RetryPolicy{Backoff: &ExponentialBackoff{Base: base, Factor: 3, Jitter: true}},
+			retried: 2, min: base, max: 10 * base},
+		{name: "exponential without factor", policy: &RetryPolicy{Backoff: &ExponentialBackoff{Base: base}},
+			retried: 3, min: 8 * base, max: 8 * base},
+		{name: "exponential with factor not greater than 1",
+			policy:  &RetryPolicy{Backoff: &ExponentialBackoff{Base: base, Factor: 0.5}},
+			retried: 3, min: 8 * base, max: 8 * base},
+		{name: "exponential without base", policy: &RetryPolicy{Backoff: &ExponentialBackoff{Factor: 2}},
+			retried: 1, min: 2 * defaultOverloadRetryInterval, max: 2 * defaultOverloadRetryInterval},
+		{name: "decorrelated jitter", policy: &RetryPolicy{Backoff: &DecorrelatedJitterBackoff{Base: base}},
+			retried: 5, prev: 4 * base, min: base, max: 12 * base},
+		{name: "max backoff",
+			policy: &RetryPolicy{
+				Backoff:    &ExponentialBackoff{Base: base, Factor: 10},
+				MaxBackoff: 50 * time.Millisecond,
+			},
+			retried: 4, min: 50 * time.Millisecond, max: 50 * time.Millisecond},
+		{name: "default", policy: nil, retried: 1,
+			min: defaultOverloadRetryInterval, max: 4 * defaultOverloadRetryInterval},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				waitTime := c.policy.backoff(c.retried, c.prev)
+				if waitTime < c.min || waitTime > c.max {
+					t.Fatalf("expect wait time in [%s, %s], got %s", c.min, c.max, waitTime)
+				}
+			}
+		})
+	}
+}
+
+func fastPollingHelper(client *fakeClient) *RequestHelper {
+	return &RequestHelper{
+		Client: client,
+		RetryPolicy: &RetryPolicy{
+			Backoff:         &ConstantBackoff{Interval: time.Millisecond},
+			PollingTimeout:  200 * time.Millisecond,
+			PollingInterval: time.Millisecond,
+		},
+	}
+}
+
+func TestDoImportPolling(t *testing.T) {
+	result := &Status{Code: 0, Message: "imported"}
+	cases := []struct {
+		name string
+		// The status code of the import request
+		importCode int32
+		operations []operationResult
+		errIs      error
+		// The exact count of "GetOperation" calls
+		polls int
+	}{
+		{name: "done at once", operations: []operationResult{operationResponse(0, true, result)},
+			polls: 1},
+		{name: "done after running", operations: []operationResult{
+			operationResponse(0, false, nil),
+			operationResponse(0, false, nil),
+			operationResponse(0, true, result),
+		}, polls: 3},
+		{name: "nil operation response", operations: []operationResult{
+			{response: nil, err: nil},
+			{response: nil, err: errTimeout},
+			operationResponse(0, true, result),
+		}, polls: 3},
+		{name: "operation loss", operations: []operationResult{
+			operationResponse(0, false, nil),
+			operationResponse(core.StatusCodeOperationLoss, false, nil),
+		}, errIs: ErrOperationLost, polls: 2},
+		// Polls every 1ms in the 200ms window
+		{name: "polling timeout", operations: []operationResult{operationResponse(0, false, nil)},
+			errIs: ErrPollingTimeout, polls: 200},
+		{name: "polling timeout with nil responses", operations: []operationResult{{err: errTimeout}},
+			errIs: ErrPollingTimeout, polls: 200},
+		{name: "get operation error", operations: []operationResult{{err: errBadRequest}},
+			errIs: errBadRequest, polls: 1},
+		{name: "import failure", importCode: 400, errIs: ErrImportFailure},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &fakeClient{results: c.operations}
+			call := func(_ interface{}, _ ...option.Option) (proto.Message, error) {
+				return &OperationResponse{
+					Status:    &Status{Code: c.importCode},
+					Operation: &Operation{Name: "operations/1"},
+				}, nil
+			}
+			clock := newFakeClock()
+			helper := fastPollingHelper(client)
+			helper.Clock, helper.Sleeper = clock, clock
+			response := &Status{}
+			err := helper.DoImport(call, nil, response, nil, 2)
+			if c.errIs != nil {
+				if !errors.Is(err, c.errIs) {
+					t.Fatalf("expect err:%v, got err:%v", c.errIs, err)
+				}
+			} else if err != nil {
+				t.Fatalf("expect success, got err:%v", err)
+			} else if response.GetMessage() != result.GetMessage() {
+				t.Fatalf("expect the response of operation, got %v", response)
+			}
+			if polls := client.getOperationCalls(); polls != c.polls {
+				t.Fatalf("expect %d polls, got %d", c.polls, polls)
+			}
+		})
+	}
+}
+
+func TestDoImportStopPollingWhenCanceled(t *testing.T) {
+	client := &fakeClient{results: []operationResult{operationResponse(0, false, nil)}}
+	helper := fastPollingHelper(client)
+	helper.RetryPolicy.PollingTimeout = time.Minute
+	call := func(_ context.Context, _ interface{}, _ ...option.Option) (proto.Message, error) {
+		return &OperationResponse{Status: &Status{}, Operation: &Operation{Name: "operations/1"}}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := helper.DoImportContext(ctx, call, nil, &Status{}, nil, 2)
+	if !errors.Is(err, context.DeadlineExceeded) || !IsCanceledError(err) {
+		t.Fatalf("expect CanceledError, got err:%v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect polling stops soon after canceled, got %s", elapsed)
+	}
+}
+
+// fakeClock moves forward by the sleep time at once,
+// and records the sleep times
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if ctx.Err() != nil {
+		return newCanceledError(ctx.Err())
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+func (c *fakeClock) sleepTimes() []time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// blockingClient blocks "GetOperation" until release is closed
+type blockingClient struct {
+	fakeClient
+	release chan struct{}
+}
+
+func (c *blockingClient) GetOperation(request *GetOperationRequest, opts ...option.Option) (*OperationResponse, error) {
+	<-c.release
+	return c.fakeClient.GetOperation(request, opts...)
+}
+
+func TestPollImportNotWaitGetOperationWhenCanceled(t *testing.T) {
+	client := &blockingClient{
+		fakeClient: fakeClient{results: []operationResult{operationResponse(0, false, nil)}},
+		release:    make(chan struct{}),
+	}
+	defer close(client.release)
+	helper := &RequestHelper{Client: client}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := helper.PollImportContext(ctx, "operations/1", &Status{})
+	if !errors.Is(err, context.DeadlineExceeded) || !IsCanceledError(err) {
+		t.Fatalf("expect CanceledError, got err:%v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect not to wait for the get operation in flight, got %s", elapsed)
+	}
+}
+
+func TestDoImportPollingTimeoutWithFakeClock(t *testing.T) {
+	cases := []struct {
+		name       string
+		operations []operationResult
+	}{
+		{name: "polling timeout", operations: []operationResult{operationResponse(0, false, nil)}},
+		// The nil responses are waited as the running operation, rather than polled without pause
+		{name: "polling timeout with nil responses", operations: []operationResult{{err: errTimeout}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clock := newFakeClock()
+			client := &fakeClient{results: c.operations}
+			helper := &RequestHelper{Client: client, Clock: clock, Sleeper: clock}
+			call := func(_ interface{}, _ ...option.Option) (proto.Message, error) {
+				return &OperationResponse{Status: &Status{}, Operation: &Operation{Name: "operations/1"}}, nil
+			}
+			start := time.Now()
+			err := helper.DoImport(call, nil, &Status{}, nil, 2)
+			if !errors.Is(err, ErrPollingTimeout) {
+				t.Fatalf("expect polling timeout, got err:%v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("expect no real wait, got %s", elapsed)
+			}
+			// Polls every 100ms in the 10s window
+			expectPolls := int(defaultPollingTimeout / defaultPollingInterval)
+			if polls := client.getOperationCalls(); polls != expectPolls {
+				t.Fatalf("expect %d polls, got %d", expectPolls, polls)
+			}
+			if waited := clock.Now().Sub(time.Unix(0, 0)); waited != defaultPollingTimeout {
+				t.Fatalf("expect to wait %s, got %s", defaultPollingTimeout, waited)
+			}
+		})
+	}
+}
+
+func TestBackoffReproducibleWithSeed(t *testing.T) {
+	newBackoffs := func() []Backoff {
+		return []Backoff{
+			&ExponentialBackoff{Base: time.Second, Factor: 3, Jitter: true, Source: NewJitterSource(42)},
+			&DecorrelatedJitterBackoff{Base: time.Second, Source: NewJitterSource(42)},
+		}
+	}
+	first, second := newBackoffs(), newBackoffs()
+	for i := range first {
+		var prev1, prev2 time.Duration
+		for retried := 0; retried < 5; retried++ {
+			prev1, prev2 = first[i].Next(retried, prev1), second[i].Next(retried, prev2)
+			if prev1 != prev2 {
+				t.Fatalf("expect same wait times by same seed, got %s and %s", prev1, prev2)
+			}
+		}
+	}
+}
+
+func TestDoWithRetryAlthoughOverloadExactBackoff(t *testing.T) {
+	clock := newFakeClock()
+	helper := &RequestHelper{
+		RetryPolicy: &RetryPolicy{
+			Backoff: &ExponentialBackoff{Base: time.Second, Factor: 3, Jitter: true, Source: NewJitterSource(7)},
+		},
+		Clock:   clock,
+		Sleeper: clock,
+	}
+	overload := status(core.StatusCodeTooManyRequest)
+	call := newFakeCall(overload, overload, overload, status(0))
+	if _, err := helper.DoWithRetryAlthoughOverload(call.call, nil, nil, 3); err != nil {
+		t.Fatalf("expect success, got err:%v", err)
+	}
+	expect := &ExponentialBackoff{Base: time.Second, Factor: 3, Jitter: true, Source: NewJitterSource(7)}
+	sleeps := clock.sleepTimes()
+	if len(sleeps) != 3 {
+		t.Fatalf("expect 3 waits, got %v", sleeps)
+	}
+	for i, sleep := range sleeps {
+		if expectSleep := expect.Next(i, 0); sleep != expectSleep {
+			t.Fatalf("expect wait %s before retry %d, got %s", expectSleep, i+1, sleep)
+		}
+	}
+}
+
+func TestDoWithRetryAlthoughOverloadNoWaitAfterLastAttempt(t *testing.T) {
+	clock := newFakeClock()
+	helper := &RequestHelper{
+		RetryPolicy: &RetryPolicy{Backoff: &ConstantBackoff{Interval: time.Second}},
+		Clock:       clock,
+		Sleeper:     clock,
+	}
+	call := newFakeCall(status(core.StatusCodeTooManyRequest))
+	if _, err := helper.DoWithRetryAlthoughOverload(call.call, nil, nil, 2); !errors.Is(err, ErrServerOverload) {
+		t.Fatalf("expect overload exhausted, got err:%v", err)
+	}
+	// Waits before the second and the third attempts only
+	if sleeps := clock.sleepTimes(); call.attempts() != 3 || len(sleeps) != 2 {
+		t.Fatalf("expect 3 attempts and 2 waits, got %d attempts and waits %v", call.attempts(), sleeps)
+	}
+}
+
+func TestConcurrentHelperUseConfiguredSleeper(t *testing.T) {
+	clock := newFakeClock()
+	helper := NewConcurrentHelper(&RequestHelper{}, &ConcurrentHelperConfig{Clock: clock, Sleeper: clock})
+	defer helper.Close()
+	call := newFakeCall(fail(errConnReset), fail(errConnReset), status(0))
+	future, err := helper.Submit(&Submission{API: APIWriteUsers, Call: call.call})
+	if err != nil {
+		t.Fatalf("expect submitted, got err:%v", err)
+	}
+	if _, err := future.Wait(); err != nil {
+		t.Fatalf("expect success after retry, got err:%v", err)
+	}
+	if sleeps := clock.sleepTimes(); len(sleeps) != 2 {
+		t.Fatalf("expect 2 waits by the configured sleeper, got %v", sleeps)
+	}
+}
@@ -0,0 +1,226 @@
+package common
+
+import (
+	"math"
+	"time"
+
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+)
+
+const (
+	// The maximum time for polling the execution results of the import task
+	defaultPollingTimeout = 10 * time.Second
+
+	// The time interval between requests during polling
+	defaultPollingInterval = 100 * time.Millisecond
+
+	// The interval base of retry for server overload
+	defaultOverloadRetryInterval = 200 * time.Millisecond
+
+	// The growth rate of the wait time between retries for server overload
+	defaultOverloadIncreaseSpeed = 3
+
+	// The growth rate of ExponentialBackoff, if its Factor is not set
+	defaultBackoffFactor = 2
+
+	defaultGetOperationTimeout = 500 * time.Millisecond
+)
+
+// Backoff decides how long to wait before requesting again
+type Backoff interface {
+	// Next returns the wait time before the retry, retriedTimes starts from 0,
+	// prev is the wait time returned last time, and is 0 before the first retry
+	Next(retriedTimes int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff always waits the same Interval
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+func (b *ConstantBackoff) Next(int, time.Duration) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff waits Base * Factor^retriedTimes.
+// If Jitter is true, the wait time is randomized to
+// Base * (1 + random[0,1) * Factor^retriedTimes),
+// which prevents many clients from retrying at the same moment
+type ExponentialBackoff struct {
+	// Base is the wait time before the first retry, default is 200ms
+	Base time.Duration
+
+	// Factor is the growth rate of the wait time, default is 2. The
+	// values not greater than 1 are replaced by the default, which
+	// would retry faster and faster, or without waiting at all
+	Factor float64
+
+	Jitter bool
+
+	// Source provides the random of jitter, default is the global source
+	// of math/rand, set it by NewJitterSource to reproduce the wait times
+	Source JitterSource
+}
+
+func (b *ExponentialBackoff) Next(retriedTimes int, _ time.Duration) time.Duration {
+	base := b.Base
+	if base <= 0 {
+		base = defaultOverloadRetryInterval
+	}
+	if retriedTimes < 0 {
+		return base
+	}
+	factor := b.Factor
+	if factor <= 1 {
+		factor = defaultBackoffFactor
+	}
+	growth := math.Pow(factor, float64(retriedTimes))
+	if !b.Jitter {
+		return time.Duration(float64(base) * growth)
+	}
+	rate := 1.0 + jitterSource(b.Source).Float64()*growth
+	return time.Duration(float64(base) * rate)
+}
+
+// DecorrelatedJitterBackoff waits a random time between Base and
+// 3 times of the previous wait time, which spreads retries of different
+// clients better than ExponentialBackoff when they are rejected together
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+
+	// Source provides the random of jitter, default is the global source
+	// of math/rand, set it by NewJitterSource to reproduce the wait times
+	Source JitterSource
+}
+
+func (b *DecorrelatedJitterBackoff) Next(_ int, prev time.Duration) time.Duration {
+	if prev < b.Base {
+		prev = b.Base
+	}
+	upper := float64(prev) * 3
+	return b.Base + time.Duration(jitterSource(b.Source).Float64()*(upper-float64(b.Base)))
+}
+
+// RetryPolicy controls how RequestHelper retries requests and polls import results.
+// The zero value of each field means using the default value of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum count of attempts of one request, including
+	// the first one. If it is positive, it takes precedence over the
+	// "retryTimes" passed to the methods of RequestHelper
+	MaxAttempts int
+
+	// Backoff decides the wait time before requesting again,
+	// when server asks to retry later, such as overload
+	Backoff Backoff
+
+	// MaxBackoff is the upper limit of the wait time returned by Backoff,
+	// 0 means no limit
+	MaxBackoff time.Duration
+
+	// ShouldRetry decides whether the request should be sent again
+	// after waiting, according to the status returned by server
+	ShouldRetry func(status *Status) bool
+
+	// RetryableError decides whether the request should be sent again
+	// with the same request id, according to the error returned by call
+	RetryableError func(err error) bool
+
+	// RetryableItemError decides whether the record failed in a write
+	// request should be resubmitted, according to the message of its error
+	RetryableItemError func(message string) bool
+
+	// The maximum time for polling the execution results of the import task
+	PollingTimeout time.Duration
+
+	// The time interval between requests during polling
+	PollingInterval time.Duration
+
+	// The timeout of each "GetOperation" request during polling
+	GetOperationTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when RequestHelper.RetryPolicy is nil:
+// retry by the "retryTimes" passed by caller when timeout or transient network
+// exception occurs, wait 200ms * (1 + random[0,1) * 3^retriedTimes)
+// when server is overload, and polling import result every 100ms for at most 10s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Backoff: &ExponentialBackoff{
+			Base:   defaultOverloadRetryInterval,
+			Factor: defaultOverloadIncreaseSpeed,
+			Jitter: true,
+		},
+		ShouldRetry:         IsServerOverload,
+		RetryableError:      IsRetryableError,
+		RetryableItemError:  IsRetryableItemError,
+		PollingTimeout:      defaultPollingTimeout,
+		PollingInterval:     defaultPollingInterval,
+		GetOperationTimeout: defaultGetOperationTimeout,
+	}
+}
+
+var defaultRetryPolicy = DefaultRetryPolicy()
+
+func (p *RetryPolicy) retryTimes(retryTimes int) int {
+	if p != nil && p.MaxAttempts > 0 {
+		retryTimes = p.MaxAttempts - 1
+	}
+	if retryTimes < 0 {
+		return 0
+	}
+	return retryTimes
+}
+
+func (p *RetryPolicy) backoff(retriedTimes int, prev time.Duration) time.Duration {
+	backoff := defaultRetryPolicy.Backoff
+	if p != nil && p.Backoff != nil {
+		backoff = p.Backoff
+	}
+	waitTime := backoff.Next(retriedTimes, prev)
+	if p != nil && p.MaxBackoff > 0 && waitTime > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return waitTime
+}
+
+func (p *RetryPolicy) shouldRetry(status *Status) bool {
+	if p != nil && p.ShouldRetry != nil {
+		return p.ShouldRetry(status)
+	}
+	return defaultRetryPolicy.ShouldRetry(status)
+}
+
+func (p *RetryPolicy) isRetryableError(err error) bool {
+	if p != nil && p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return defaultRetryPolicy.RetryableError(err)
+}
+
+func (p *RetryPolicy) isRetryableItemError(message string) bool {
+	if p != nil && p.RetryableItemError != nil {
+		return p.RetryableItemError(message)
+	}
+	return defaultRetryPolicy.RetryableItemError(message)
+}
+
+func (p *RetryPolicy) pollingTimeout() time.Duration {
+	if p != nil && p.PollingTimeout > 0 {
+		return p.PollingTimeout
+	}
+	return defaultRetryPolicy.PollingTimeout
+}
+
+func (p *RetryPolicy) pollingInterval() time.Duration {
+	if p != nil && p.PollingInterval > 0 {
+		return p.PollingInterval
+	}
+	return defaultRetryPolicy.PollingInterval
+}
+
+func (p *RetryPolicy) getOperationTimeout() time.Duration {
+	if p != nil && p.GetOperationTimeout > 0 {
+		return p.GetOperationTimeout
+	}
+	return defaultRetryPolicy.GetOperationTimeout
+}
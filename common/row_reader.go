@@ -0,0 +1,218 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// The formats of the data files read by RowReader
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Row is a record read from a data file
+type Row struct {
+	// Number is the 1-based number of the row, the header of CSV is not
+	// counted, and it is the line number for JSONL
+	Number int64
+
+	// Columns are the names of the columns in the order of the file,
+	// only set for CSV and Parquet
+	Columns []string
+
+	// Fields are the values by the column names, they are strings for CSV,
+	// the values decoded by encoding/json with UseNumber for JSONL, and
+	// the values of the columns for Parquet, null values are omitted
+	Fields map[string]interface{}
+
+	// Raw is the original line of JSONL, nil for CSV
+	Raw []byte
+}
+
+// RowError is returned by RowReader.Read when a row can't be parsed,
+// the reading can be continued with the next row
+type RowError struct {
+	Number int64
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row:%d msg:%s", e.Number, e.Err.Error())
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// RowReader reads the rows of a data file one by one, so that
+// a large file is streamed without being loaded into memory
+type RowReader interface {
+	// Read returns the next row, io.EOF is returned after the last row,
+	// and a *RowError is returned for an invalid row
+	Read() (*Row, error)
+
+	Close() error
+}
+
+// OpenRowReader opens the data file in the format, which is decided by
+// the extension of path if format is empty, such as ".csv", ".jsonl" and ".parquet"
+func OpenRowReader(path string, format string) (RowReader, error) {
+	if format == "" {
+		format = formatByExtension(path)
+	}
+	if strings.ToLower(format) == FormatParquet {
+		return NewParquetRowReader(path, 0)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		reader, err := NewCSVRowReader(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		return reader, nil
+	case FormatJSONL, "json", "ndjson":
+		return NewJSONLRowReader(file), nil
+	}
+	_ = file.Close()
+	return nil, fmt.Errorf("unsupported format:%s path:%s", format, path)
+}
+
+func formatByExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".json", ".ndjson":
+		return FormatJSONL
+	case ".parquet", ".parq":
+		return FormatParquet
+	}
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+type csvRowReader struct {
+	closer  io.Closer
+	reader  *csv.Reader
+	columns []string
+	number  int64
+}
+
+// NewCSVRowReader reads CSV with a header row, which has the names of
+// the columns, r is closed by Close if it is an io.Closer
+func NewCSVRowReader(r io.Reader) (RowReader, error) {
+	reader := csv.NewReader(r)
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header fail, msg:%s", err.Error())
+	}
+	// The first column may start with the BOM written by Excel
+	columns[0] = strings.TrimPrefix(columns[0], "\ufeff")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	closer, _ := r.(io.Closer)
+	return &csvRowReader{closer: closer, reader: reader, columns: columns}, nil
+}
+
+func (r *csvRowReader) Read() (*Row, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	r.number++
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return nil, &RowError{Number: r.number, Err: err}
+		}
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(record))
+	for i, value := range record {
+		fields[r.columns[i]] = value
+	}
+	return &Row{Number: r.number, Columns: r.columns, Fields: fields}, nil
+}
+
+func (r *csvRowReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+type jsonlRowReader struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+	number  int64
+}
+
+// NewJSONLRowReader reads JSONL, each line is a JSON object,
+// r is closed by Close if it is an io.Closer
+func NewJSONLRowReader(r io.Reader) RowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	closer, _ := r.(io.Closer)
+	return &jsonlRowReader{closer: closer, scanner: scanner}
+}
+
+func (r *jsonlRowReader) Read() (*Row, error) {
+	for r.scanner.Scan() {
+		r.number++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		fields := make(map[string]interface{})
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, &RowError{Number: r.number, Err: err}
+		}
+		raw := append([]byte(nil), line...)
+		return &Row{Number: r.number, Fields: fields, Raw: raw}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *jsonlRowReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// FillMessage sets the fields of message by the row. The line of JSONL is
+// parsed by protojson, so the nested fields are nested objects, while the
+// column names of CSV and Parquet are the field paths of SetProtoField, such as
+// "price.current_price" and "categories.0.category_nodes.0.id_or_name",
+// the nested groups and lists of Parquet are set to the nested fields
+func FillMessage(message proto.Message, row *Row) error {
+	if row.Raw != nil {
+		return protojson.Unmarshal(row.Raw, message)
+	}
+	for _, column := range row.Columns {
+		if err := SetProtoField(message, column, row.Fields[column]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
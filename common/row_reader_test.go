@@ -0,0 +1,245 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readRows reads all the rows, each row is described as "number:key=value,...",
+// with the keys sorted, and each *RowError as "number:error"
+func readRows(t *testing.T, reader RowReader) []string {
+	t.Helper()
+	var rows []string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rows = append(rows, fmt.Sprintf("%d:error", rowErr.Number))
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expect rows read, got err:%v", err)
+		}
+		keys := make([]string, 0, len(row.Fields))
+		for key := range row.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = fmt.Sprintf("%s=%v", key, row.Fields[key])
+		}
+		rows = append(rows, fmt.Sprintf("%d:%s", row.Number, strings.Join(fields, ",")))
+	}
+}
+
+func TestCSVRowReader(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		columns []string
+		expect  []string
+	}{
+		{name: "header", data: "id,name\n1,a\n2,b\n",
+			columns: []string{"id", "name"}, expect: []string{"1:id=1,name=a", "2:id=2,name=b"}},
+		{name: "spaces and BOM in header", data: "\ufeff id , name\n1,a\n",
+			columns: []string{"id", "name"}, expect: []string{"1:id=1,name=a"}},
+		{name: "only header", data: "id,name\n", columns: []string{"id", "name"}},
+		{name: "quoted fields", data: "id,name\n1,\"a, \"\"b\"\"\"\n",
+			columns: []string{"id", "name"}, expect: []string{`1:id=1,name=a, "b"`}},
+		// The row number is the number of the record, not the line
+		{name: "embedded newlines", data: "id,name\n1,\"a\nb\"\n2,c\n",
+			columns: []string{"id", "name"}, expect: []string{"1:id=1,name=a\nb", "2:id=2,name=c"}},
+		{name: "blank lines and no trailing newline", data: "id,name\n\n1,a\n\n2,b",
+			columns: []string{"id", "name"}, expect: []string{"1:id=1,name=a", "2:id=2,name=b"}},
+		{name: "wrong number of fields", data: "id,name\n1,a\n2\n3,c\n",
+			columns: []string{"id", "name"}, expect: []string{"1:id=1,name=a", "2:error", "3:id=3,name=c"}},
+		{name: "bare quote", data: "id,name\n1,a\"b\n2,c\n",
+			columns: []string{"id", "name"}, expect: []string{"1:error", "2:id=2,name=c"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reader, err := NewCSVRowReader(strings.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("expect reader created, got err:%v", err)
+			}
+			defer reader.Close()
+			if rows := readRows(t, reader); !reflect.DeepEqual(rows, c.expect) {
+				t.Fatalf("expect rows %q, got %q", c.expect, rows)
+			}
+		})
+	}
+	reader, _ := NewCSVRowReader(strings.NewReader("\ufeffid, name \n1,a\n"))
+	row, err := reader.Read()
+	if err != nil || !reflect.DeepEqual(row.Columns, []string{"id", "name"}) || row.Raw != nil {
+		t.Fatalf("expect the columns of the header and no raw line, got %+v err:%v", row, err)
+	}
+	if _, err := NewCSVRowReader(strings.NewReader("")); err == nil ||
+		!strings.Contains(err.Error(), "read csv header fail") {
+		t.Fatalf("expect header error of empty file, got err:%v", err)
+	}
+}
+
+func TestJSONLRowReader(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		expect []string
+	}{
+		{name: "lines", data: "{\"id\": \"1\"}\n{\"id\": \"2\", \"price\": 1.5}\n",
+			expect: []string{"1:id=1", "2:id=2,price=1.5"}},
+		// The blank lines are skipped, but counted in the line numbers
+		{name: "blank and trailing lines", data: "\n{\"id\": \"1\"}\n  \n\r\n{\"id\": \"2\"}\n\n\n",
+			expect: []string{"2:id=1", "5:id=2"}},
+		{name: "no trailing newline", data: "{\"id\": \"1\"}\n{\"id\": \"2\"}",
+			expect: []string{"1:id=1", "2:id=2"}},
+		{name: "crlf", data: "{\"id\": \"1\"}\r\n{\"id\": \"2\"}\r\n",
+			expect: []string{"1:id=1", "2:id=2"}},
+		{name: "malformed line", data: "{\"id\": \"1\"}\n\n{\"id\": \n[1, 2]\n{\"id\": \"5\"}\n",
+			expect: []string{"1:id=1", "3:error", "4:error", "5:id=5"}},
+		{name: "empty", data: ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reader := NewJSONLRowReader(strings.NewReader(c.data))
+			defer reader.Close()
+			if rows := readRows(t, reader); !reflect.DeepEqual(rows, c.expect) {
+				t.Fatalf("expect rows %q, got %q", c.expect, rows)
+			}
+		})
+	}
+	reader := NewJSONLRowReader(strings.NewReader(" {\"id\": 12345678901234567890} \n"))
+	row, err := reader.Read()
+	if err != nil || string(row.Raw) != `{"id": 12345678901234567890}` || row.Columns != nil {
+		t.Fatalf("expect the trimmed raw line and no columns, got %+v err:%v", row, err)
+	}
+	// The large number is kept without losing precision
+	if number, ok := row.Fields["id"].(json.Number); !ok || number.String() != "12345678901234567890" {
+		t.Fatalf("expect json.Number, got %#v", row.Fields["id"])
+	}
+}
+
+func TestOpenRowReader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		path := dir + "/" + name
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("expect %s written, got err:%v", name, err)
+		}
+		return path
+	}
+	cases := []struct {
+		name   string
+		path   string
+		format string
+		expect []string
+	}{
+		{name: "csv by extension", path: write("users.CSV", "id\n1\n"), expect: []string{"1:id=1"}},
+		{name: "jsonl by extension", path: write("users.ndjson", "{\"id\": \"1\"}\n"), expect: []string{"1:id=1"}},
+		{name: "format overrides extension", path: write("users.txt", "{\"id\": \"1\"}\n"),
+			format: "JSONL", expect: []string{"1:id=1"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reader, err := OpenRowReader(c.path, c.format)
+			if err != nil {
+				t.Fatalf("expect reader opened, got err:%v", err)
+			}
+			defer reader.Close()
+			if rows := readRows(t, reader); !reflect.DeepEqual(rows, c.expect) {
+				t.Fatalf("expect rows %q, got %q", c.expect, rows)
+			}
+		})
+	}
+	if _, err := OpenRowReader(write("users.txt", "id\n"), ""); err == nil ||
+		!strings.Contains(err.Error(), "unsupported format:txt") {
+		t.Fatalf("expect unsupported format, got err:%v", err)
+	}
+	if _, err := OpenRowReader(dir+"/missing.csv", ""); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expect file not exist, got err:%v", err)
+	}
+}
+
+// The row numbers of the file are stable across runs, so that the
+// rows confirmed before restart are skipped by the checkpoint offset
+func TestRowReaderResumeFromOffset(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{name: "csv", format: FormatCSV,
+			data: "id,name\n1,a\n2,\"b\nb\"\n3\n4,d\n5,e\n6,f\n7,g\n"},
+		{name: "jsonl", format: FormatJSONL,
+			data: "{\"id\": \"1\"}\n\n{\"id\": \"2\"}\n{\"id\": \n{\"id\": \"4\"}\n\n{\"id\": \"5\"}\n{\"id\": \"6\"}\n{\"id\": \"7\"}\n\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := dir + "/users." + c.format
+			if err := os.WriteFile(path, []byte(c.data), 0644); err != nil {
+				t.Fatalf("expect data written, got err:%v", err)
+			}
+			ingest := func(recorder *batchRecorder) *IngestSummary {
+				t.Helper()
+				reader, err := OpenRowReader(path, "")
+				if err != nil {
+					t.Fatalf("expect reader opened, got err:%v", err)
+				}
+				defer reader.Close()
+				checkpoint := openTestCheckpoint(t, dir+"/users.checkpoint")
+				defer checkpoint.Close()
+				summary, err := Ingest(reader, &IngestConfig{
+					API:       APIImportUsers,
+					BatchSize: 2,
+					Convert: func(row *Row) (interface{}, error) {
+						return row.Fields["id"], nil
+					},
+					Write:      recorder.write,
+					Checkpoint: checkpoint,
+				})
+				if err != nil {
+					t.Fatalf("expect ingested, got err:%v", err)
+				}
+				return summary
+			}
+			// The batches after the second one fail, so the offset is
+			// the last row of the second batch, after the invalid row
+			first := &batchRecorder{}
+			first.fail = func(*IngestBatch, ItemFailureHandler) error {
+				if len(first.batches) > 2 {
+					return errors.New("server error")
+				}
+				return nil
+			}
+			if summary := ingest(first); summary.Written != 4 || summary.Failed != 3 {
+				t.Fatalf("expect 4 written and 3 failed with the invalid row, got %+v", summary)
+			}
+			second := &batchRecorder{}
+			summary := ingest(second)
+			if summary.Skipped != 4 || summary.Written != 2 || len(summary.Errors) != 0 {
+				t.Fatalf("expect 4 skipped and 2 written without row error, got %+v", summary)
+			}
+			var ids []interface{}
+			for _, batch := range second.batches {
+				ids = append(ids, batch.Records...)
+			}
+			if expect := []interface{}{"6", "7"}; !reflect.DeepEqual(ids, expect) {
+				t.Fatalf("expect the rows after offset written, got %v", ids)
+			}
+			if second.batches[0].Progress.RequestId != first.batches[2].Progress.RequestId {
+				t.Fatalf("expect the request id of the failed batch kept")
+			}
+		})
+	}
+}
@@ -29,3 +29,15 @@ func IsLossOperation(status *Status) bool {
 	code := status.Code
 	return code == StatusCodeOperationLoss
 }
+
+// IsSuccessResponse checks the "Status" of the response,
+// or the "Code" if the response doesn't have "Status", such as CallbackResponse
+func IsSuccessResponse(response interface{}) bool {
+	switch rsp := response.(type) {
+	case interface{ GetStatus() *Status }:
+		return IsSuccess(rsp.GetStatus())
+	case interface{ GetCode() int32 }:
+		return IsSuccessCode(rsp.GetCode())
+	}
+	return false
+}
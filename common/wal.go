@@ -0,0 +1,203 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+)
+
+const (
+	walOpSubmit   = "submit"
+	walOpComplete = "complete"
+)
+
+// walEntry is a line of the WAL file, the submission is kept as a
+// DeadLetter, which has enough information to be sent again
+type walEntry struct {
+	Op         string      `json:"op"`
+	RequestId  string      `json:"request_id"`
+	Submission *DeadLetter `json:"submission,omitempty"`
+}
+
+// WAL is a write-ahead log of the submissions of ConcurrentHelper.
+// A submission is appended before it is accepted by Submit, and marked
+// complete after the server accepts it, or it fails and is put to the
+// DeadLetterSink if it is set. A failed submission isn't submitted again,
+// which may repeat a non-idempotent write, while the submissions queued,
+// retrying or abandoned by shutdown when the process dies are kept,
+// and can be submitted again on startup with the original request ids,
+// which are deduplicated by the server as idempotent.
+// A nil WAL does nothing
+type WAL struct {
+	path string
+	lock sync.Mutex
+	file *os.File
+}
+
+// OpenWAL opens the WAL file, and returns the submissions not complete
+// in it, which should be submitted again. The file is compacted to only
+// contain these submissions
+func OpenWAL(path string) (*WAL, []*DeadLetter, error) {
+	pending, err := readPendingSubmissions(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := compactWAL(path, pending); err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &WAL{path: path, file: file}, pending, nil
+}
+
+func readPendingSubmissions(path string) ([]*DeadLetter, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var requestIds []string
+	submissions := make(map[string]*DeadLetter)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	// The line failed to be parsed, it is tolerated only if it is the
+	// last one, which may be partially written when the process dies
+	var badLine int
+	var badErr error
+	for line := 1; scanner.Scan(); line++ {
+		if badErr != nil {
+			return nil, fmt.Errorf("wal %s is corrupted at line %d, msg:%s", path, badLine, badErr.Error())
+		}
+		entry := &walEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			badLine, badErr = line, err
+			continue
+		}
+		switch entry.Op {
+		case walOpSubmit:
+			if _, ok := submissions[entry.RequestId]; !ok {
+				requestIds = append(requestIds, entry.RequestId)
+			}
+			submissions[entry.RequestId] = entry.Submission
+		case walOpComplete:
+			delete(submissions, entry.RequestId)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if badErr != nil {
+		logs.Warn("[WAL] ignore the partially written last line %d of %s, msg:%s", badLine, path, badErr.Error())
+	}
+	pending := make([]*DeadLetter, 0, len(submissions))
+	for _, requestId := range requestIds {
+		if submission, ok := submissions[requestId]; ok && submission != nil {
+			pending = append(pending, submission)
+			// A request id may be submitted again after completed
+			delete(submissions, requestId)
+		}
+	}
+	return pending, nil
+}
+
+func compactWAL(path string, pending []*DeadLetter) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, submission := range pending {
+		if err := writeWALEntry(writer, &walEntry{
+			Op:         walOpSubmit,
+			RequestId:  submission.RequestId,
+			Submission: submission,
+		}); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func writeWALEntry(writer *bufio.Writer, entry *walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(line); err != nil {
+		return err
+	}
+	return writer.WriteByte('\n')
+}
+
+func (w *WAL) appendSubmit(submission *DeadLetter) error {
+	if w == nil {
+		return nil
+	}
+	return w.append(&walEntry{
+		Op:         walOpSubmit,
+		RequestId:  submission.RequestId,
+		Submission: submission,
+	})
+}
+
+func (w *WAL) appendComplete(requestId string) error {
+	if w == nil {
+		return nil
+	}
+	return w.append(&walEntry{Op: walOpComplete, RequestId: requestId})
+}
+
+func (w *WAL) append(entry *walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return fmt.Errorf("wal is closed, path:%s", w.path)
+	}
+	if _, err := w.file.Write(line); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Close closes the WAL file, it should be called after
+// the ConcurrentHelper using it is shut down
+func (w *WAL) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
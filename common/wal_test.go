@@ -0,0 +1,128 @@
+package common
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/byteplus-sdk/sdk-go/core/option"
+)
+
+func walSubmission(t *testing.T, requestId string) *DeadLetter {
+	letter, err := NewDeadLetter(APIWriteData, []map[string]interface{}{{"id": requestId}},
+		[]option.Option{option.WithRequestId(requestId)}, map[string]string{"topic": "user"}, nil)
+	if err != nil {
+		t.Fatalf("expect submission created, got err:%v", err)
+	}
+	return letter
+}
+
+func pendingRequestIds(pending []*DeadLetter) []string {
+	requestIds := make([]string, len(pending))
+	for i, submission := range pending {
+		requestIds[i] = submission.RequestId
+	}
+	return requestIds
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("expect file opened, got err:%v", err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestWALReplayAfterTruncatedLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.wal")
+	wal, pending, err := OpenWAL(path)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("expect empty wal, got %d pending, err:%v", len(pending), err)
+	}
+	for _, requestId := range []string{"r1", "r2", "r3", "r4"} {
+		if err := wal.appendSubmit(walSubmission(t, requestId)); err != nil {
+			t.Fatalf("expect appended, got err:%v", err)
+		}
+	}
+	_ = wal.appendComplete("r2")
+	// A request id may be submitted again after completed
+	_ = wal.appendComplete("r3")
+	_ = wal.appendSubmit(walSubmission(t, "r3"))
+	if err := wal.Close(); err != nil {
+		t.Fatalf("expect closed, got err:%v", err)
+	}
+	// The process dies when writing the complete of r4
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.WriteString(`{"op":"complete","requ`)
+	_ = file.Close()
+
+	wal, pending, err = OpenWAL(path)
+	if err != nil {
+		t.Fatalf("expect wal opened, got err:%v", err)
+	}
+	expect := []string{"r1", "r3", "r4"}
+	if requestIds := pendingRequestIds(pending); len(requestIds) != 3 ||
+		requestIds[0] != expect[0] || requestIds[1] != expect[1] || requestIds[2] != expect[2] {
+		t.Fatalf("expect pending %v in submitting order, got %v", expect, requestIds)
+	}
+	var dataList []map[string]interface{}
+	if err := pending[0].DecodeJSON(&dataList); err != nil || dataList[0]["id"] != "r1" {
+		t.Fatalf("expect the submission kept, got %v err:%v", dataList, err)
+	}
+	if pending[0].RequestId != "r1" || pending[0].Meta["topic"] != "user" {
+		t.Fatalf("expect the request id and meta kept, got %+v", pending[0])
+	}
+	// The file is compacted to the pending submissions, without the truncated line
+	if lines := countLines(t, path); lines != 3 {
+		t.Fatalf("expect 3 lines after compaction, got %d", lines)
+	}
+	_ = wal.appendComplete("r1")
+	_ = wal.Close()
+	_, pending, err = OpenWAL(path)
+	if requestIds := pendingRequestIds(pending); err != nil || len(requestIds) != 2 {
+		t.Fatalf("expect 2 pending after r1 completed, got %v err:%v", requestIds, err)
+	}
+}
+
+func TestWALCorruptedMiddleLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.wal")
+	wal, _, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("expect wal opened, got err:%v", err)
+	}
+	_ = wal.appendSubmit(walSubmission(t, "r1"))
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.WriteString("{\"op\":\"sub\x00\x00\n")
+	_ = file.Close()
+	_ = wal.appendSubmit(walSubmission(t, "r2"))
+	_ = wal.Close()
+
+	// A corrupted line not at the end isn't a partial write, the submission
+	// in it would be lost silently if it were skipped
+	if _, _, err := OpenWAL(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expect error of the corrupted line 2, got err:%v", err)
+	}
+}
+
+func TestWALClosed(t *testing.T) {
+	var nilWAL *WAL
+	if err := nilWAL.appendSubmit(walSubmission(t, "r1")); err != nil {
+		t.Fatalf("expect nil wal does nothing, got err:%v", err)
+	}
+	wal, _, err := OpenWAL(filepath.Join(t.TempDir(), "submissions.wal"))
+	if err != nil {
+		t.Fatalf("expect wal opened, got err:%v", err)
+	}
+	_ = wal.Close()
+	if err := wal.appendComplete("r1"); err == nil {
+		t.Fatalf("expect error after closed")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -8,7 +9,6 @@ import (
 
 	"github.com/byteplus-sdk/example-go/common"
 	. "github.com/byteplus-sdk/sdk-go/common/protocol"
-	"github.com/byteplus-sdk/sdk-go/core"
 	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/byteplus-sdk/sdk-go/general"
@@ -35,25 +35,6 @@ var (
 	requestHelper *common.RequestHelper
 )
 
-const (
-	// Token
-	// A unique token assigned by bytedance, which is used to
-	// generate an authenticated signature when building a request.
-	// It is sometimes called "secret".
-	Token = "xxxxxxxxxxxxxxxxxxxxx"
-
-	// TenantId
-	// A unique ID assigned by Bytedance, which is used to
-	// generate an authenticated signature when building a request
-	// It is sometimes called "appkey".
-	TenantId = "xxxxxxxxxxxx"
-
-	// Tenant
-	// A unique identity assigned by Bytedance, which is need to fill in URL.
-	// It is sometimes called "company".
-	Tenant = "general_demo"
-)
-
 func init() {
 	//// Metrics configuration, when Metrics and Metrics Log are turned on,
 	//// the metrics and logs at runtime will be collected and sent to the byteplus server.
@@ -77,15 +58,30 @@ func init() {
 	//}
 
 	logs.Level = logs.LevelDebug
-	client, _ = (&general.ClientBuilder{}).
-		Tenant(Tenant).        // Required
-		TenantId(TenantId).    // Required
-		Token(Token).          // Required
-		Region(core.RegionCn). // Required
+	// The credentials are loaded from the config file and the environment variables,
+	// e.g. "BYTEPLUS_CONFIG=config.yaml BYTEPLUS_PROFILE=staging go run .", see common.ConfigLoader.
+	// The requests are sent to the local mock server when BYTEPLUS_MOCK_HOST is set,
+	// e.g. run "go run ./mockserver/cmd -vertical general" in the project directory,
+	// then "BYTEPLUS_MOCK_HOST=127.0.0.1:8080 go run ." in this directory
+	config, err := common.LoadClientConfig(common.VerticalGeneral)
+	if err != nil {
+		logs.Error("[Init] load client config fail, msg:%s", err.Error())
+		os.Exit(1)
+	}
+	client, _ = config.GeneralClientBuilder().
 		//MetricsConfig(metricsConfig). // Optional
 		//HostAvailablerConfig(hostAvailablerConfig). // Optional
 		Build()
-	requestHelper = &common.RequestHelper{Client: client}
+	// Limit the QPS of each api on client side to avoid exceeding the quota,
+	// the limits are shared by all the requests sent by requestHelper.
+	// Please adjust them according to the quota of your account
+	rateLimiters := common.NewRateLimiterGroup(map[string]*common.RateLimiterConfig{
+		common.APIWriteData: {QPS: 50},
+		common.APIDone:      {QPS: 1},
+		common.APIPredict:   {QPS: 100},
+		common.APICallback:  {QPS: 100},
+	})
+	requestHelper = &common.RequestHelper{Client: client, RateLimiters: rateLimiters}
 }
 
 /**
@@ -97,8 +93,18 @@ func init() {
  * you can change account to yours here: {@link Constant}
  */
 func main() {
+	// Resubmit the requests kept in the dead letter file,
+	// e.g. "go run . replay dead_letters.jsonl"
+	if len(os.Args) == 3 && os.Args[1] == "replay" {
+		replayDeadLetters(os.Args[2])
+		client.Release()
+		return
+	}
+
 	// Write real-time user data
 	writeDataExample()
+	// Write real-time data one by one, which are sent in batches
+	batchWriteDataExample()
 
 	// Mark some day's data has been entirely imported
 	doneExample()
@@ -126,7 +132,7 @@ func writeDataExample() {
 	call := func(dataList interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.WriteData(dataList.([]map[string]interface{}), topic, opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, dataList, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIWriteData).DoWithRetry(call, dataList, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("[WriteData] occur error, msg:%s", err.Error())
 		return
@@ -140,6 +146,26 @@ func writeDataExample() {
 		response.GetStatus(), response.GetErrors())
 }
 
+func batchWriteDataExample() {
+	// The data written one by one are sent in batches of each topic,
+	// and the batch not full is sent after waiting 1 second
+	batchWriter := NewBatchWriter(client, requestHelper, &common.BatchWriterConfig{
+		Linger: time.Second,
+	})
+	for _, data := range mockDataList(10) {
+		if err := batchWriter.WriteData("user", data); err != nil {
+			logs.Error("[BatchWriteData] occur error, msg:%s", err.Error())
+			return
+		}
+	}
+	// Write the remaining data before exit
+	if err := batchWriter.Close(); err != nil {
+		logs.Error("[BatchWriteData] occur error, msg:%s", err.Error())
+		return
+	}
+	logs.Info("[BatchWriteData] success")
+}
+
 func writeOptions() []option.Option {
 	date, _ := time.Parse("2006-01-02", "2021-08-27")
 	return []option.Option{
@@ -165,7 +191,7 @@ func doneExample() {
 	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.Done(dateList, topic, opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, dateList, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIDone).DoWithRetry(call, dateList, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("[Done] occur error, msg:%s", err.Error())
 		return
@@ -184,6 +210,8 @@ func recommendExample() {
 	// The `scene` is provided by ByteDance,
 	// who according to tenant's situation
 	scene := "home"
+	// Wait for the quota of predict, it never fails without deadline
+	_ = requestHelper.RateLimiters.Wait(context.Background(), common.APIPredict)
 	predictResponse, err := client.Predict(predictRequest, scene, predictOpts...)
 	if err != nil {
 		logs.Error("predict occur error, msg:%s", err.Error())
@@ -279,6 +307,8 @@ func searchExample() {
 	// The `scene` is provided by ByteDance,
 	// that usually is "search" in search request
 	scene := "search"
+	// Wait for the quota of predict, it never fails without deadline
+	_ = requestHelper.RateLimiters.Wait(context.Background(), common.APIPredict)
 	predictResponse, err := client.Predict(predictRequest, scene, opts...)
 	if err != nil {
 		logs.Error("search occur error, msg:%s", err.Error())
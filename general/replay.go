@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/general/protocol"
+)
+
+// DeadLetterFile stores the requests which ultimately fail in ConcurrentHelper
+const DeadLetterFile = "dead_letters.jsonl"
+
+// replayDeadLetters resubmits the requests in the dead letter file through
+// ConcurrentHelper, the ones failing again are written to a new dead letter file
+func replayDeadLetters(path string) {
+	letters, err := common.TakeDeadLetters(path)
+	if err != nil {
+		logs.Error("[Replay] read dead letters fail, msg:%s", err.Error())
+		return
+	}
+	helper := NewConcurrentHelper(client, requestHelper, &common.ConcurrentHelperConfig{
+		DeadLetterSink: common.NewFileDeadLetterSink(DeadLetterFile),
+	})
+	submitted := 0
+	for _, letter := range letters {
+		if err := replayDeadLetter(helper, letter); err != nil {
+			logs.Error("[Replay] replay fail, api:%s requestId:%s msg:%s",
+				letter.API, letter.RequestId, err.Error())
+			continue
+		}
+		submitted++
+	}
+	logs.Info("[Replay] submitted %d of %d dead letters", submitted, len(letters))
+	// Wait until the resubmitted requests complete
+	_, _ = helper.Shutdown(context.Background())
+}
+
+func replayDeadLetter(helper *ConcurrentHelper, letter *common.DeadLetter) error {
+	topic := letter.Meta["topic"]
+	switch letter.API {
+	case common.APIWriteData:
+		var dataList []map[string]interface{}
+		if err := letter.DecodeJSON(&dataList); err != nil {
+			return err
+		}
+		opts := append(letter.Options(), option.WithTimeout(DefaultWriteTimeout))
+		_, err := helper.submitWriteRequest(dataList, topic, opts...)
+		return err
+	case common.APIDone:
+		var dateList []time.Time
+		if err := letter.DecodeJSON(&dateList); err != nil {
+			return err
+		}
+		opts := append(letter.Options(), option.WithTimeout(DefaultDoneTimeout))
+		_, err := helper.submitDoneRequest(dateList, topic, opts...)
+		return err
+	case common.APICallback:
+		request := &protocol.CallbackRequest{}
+		if err := letter.DecodeProto(request); err != nil {
+			return err
+		}
+		opts := append(letter.Options(), option.WithTimeout(DefaultCallbackTimeout))
+		_, err := helper.submitCallbackRequest(request, opts...)
+		return err
+	}
+	return errors.New("can't replay this api")
+}
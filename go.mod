@@ -3,7 +3,11 @@ module github.com/byteplus-sdk/example-go
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/byteplus-sdk/sdk-go v0.1.16
 	github.com/google/uuid v1.2.0
+	github.com/xitongsys/parquet-go v1.6.2
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
 	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/media"
+	"github.com/byteplus-sdk/sdk-go/media/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// BatchWriter accepts the data one by one, and writes them
+// in batches by the "WriteXXX" api through RequestHelper
+type BatchWriter struct {
+	client        media.Client
+	requestHelper *common.RequestHelper
+	users         *common.BatchWriter
+	contents      *common.BatchWriter
+	userEvents    *common.BatchWriter
+}
+
+func NewBatchWriter(client media.Client, requestHelper *common.RequestHelper,
+	config *common.BatchWriterConfig) *BatchWriter {
+	w := &BatchWriter{
+		client:        client,
+		requestHelper: requestHelper,
+	}
+	w.users = common.NewBatchWriter(common.APIWriteUsers, common.MaxWriteItems, config, w.writeUsers)
+	w.contents = common.NewBatchWriter(common.APIWriteContents, common.MaxWriteItems, config, w.writeContents)
+	w.userEvents = common.NewBatchWriter(common.APIWriteUserEvents, common.MaxWriteItems, config, w.writeUserEvents)
+	return w
+}
+
+// WriteUsers adds the users to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUsers(users ...*protocol.User) error {
+	records := make([]interface{}, len(users))
+	for i, record := range users {
+		records[i] = record
+	}
+	return w.users.Write(records...)
+}
+
+func (w *BatchWriter) writeUsers(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		users := make([]*protocol.User, len(records))
+		for i, record := range records {
+			users[i] = record.(*protocol.User)
+		}
+		return w.client.WriteUsers(&protocol.WriteUsersRequest{Users: users}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUsers).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// WriteContents adds the contents to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteContents(contents ...*protocol.Content) error {
+	records := make([]interface{}, len(contents))
+	for i, record := range contents {
+		records[i] = record
+	}
+	return w.contents.Write(records...)
+}
+
+func (w *BatchWriter) writeContents(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		contents := make([]*protocol.Content, len(records))
+		for i, record := range records {
+			contents[i] = record.(*protocol.Content)
+		}
+		return w.client.WriteContents(&protocol.WriteContentsRequest{Contents: contents}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteContents).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// WriteUserEvents adds the user events to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUserEvents(userEvents ...*protocol.UserEvent) error {
+	records := make([]interface{}, len(userEvents))
+	for i, record := range userEvents {
+		records[i] = record
+	}
+	return w.userEvents.Write(records...)
+}
+
+func (w *BatchWriter) writeUserEvents(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		userEvents := make([]*protocol.UserEvent, len(records))
+		for i, record := range records {
+			userEvents[i] = record.(*protocol.UserEvent)
+		}
+		return w.client.WriteUserEvents(&protocol.WriteUserEventsRequest{UserEvents: userEvents}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUserEvents).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// Flush writes the data in batches immediately
+func (w *BatchWriter) Flush() error {
+	for _, writer := range []*common.BatchWriter{w.users, w.contents, w.userEvents} {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the remaining data, and stops accepting new data
+func (w *BatchWriter) Close() error {
+	var firstErr error
+	for _, writer := range []*common.BatchWriter{w.users, w.contents, w.userEvents} {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
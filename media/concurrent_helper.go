@@ -1,133 +1,70 @@
 package main
 
 import (
+	"context"
 	"errors"
 
 	"github.com/byteplus-sdk/example-go/common"
-	"github.com/byteplus-sdk/sdk-go/core"
-	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/byteplus-sdk/sdk-go/media"
 	"github.com/byteplus-sdk/sdk-go/media/protocol"
 	"google.golang.org/protobuf/proto"
 )
 
-const (
-	consumerCount = 5
-	retryTimes    = 2
-)
-
-func NewConcurrentHelper(client media.Client) *ConcurrentHelper {
-	taskChan := make(chan runner)
-	for i := 0; i < consumerCount; i++ {
-		core.AsyncExecute(func() {
-			for {
-				task := <-taskChan
-				task()
-			}
-		})
-	}
+// NewConcurrentHelper creates the ConcurrentHelper sending requests by
+// requestHelper, the fields not set in config use the defaults of
+// common.NewConcurrentHelper
+func NewConcurrentHelper(client media.Client, requestHelper *common.RequestHelper,
+	config *common.ConcurrentHelperConfig) *ConcurrentHelper {
 	return &ConcurrentHelper{
-		client:        client,
-		requestHelper: &common.RequestHelper{Client: client},
-		taskChan:      taskChan,
+		client: client,
+		helper: common.NewConcurrentHelper(requestHelper, config),
 	}
 }
 
-type runner func()
-
 type ConcurrentHelper struct {
-	client        media.Client
-	requestHelper *common.RequestHelper
-	taskChan      chan runner
+	client media.Client
+	helper *common.ConcurrentHelper
 }
 
-func (h *ConcurrentHelper) SubmitRequest(request interface{}, opts ...option.Option) error {
-	switch realRequest := request.(type) {
+// SubmitRequest submits the request to be sent asynchronously,
+// the returned Future can be waited for the response of server
+func (h *ConcurrentHelper) SubmitRequest(request interface{}, opts ...option.Option) (*common.Future, error) {
+	submission := &common.Submission{Request: request, Opts: opts}
+	switch request.(type) {
 	case *protocol.WriteUsersRequest:
-		h.submitWriteUsersRequest(realRequest, opts...)
-	case *protocol.WriteContentsRequest:
-		h.submitWriteContentsRequest(realRequest, opts...)
-	case *protocol.WriteUserEventsRequest:
-		h.submitWriteUserEventsRequest(realRequest, opts...)
-	case *protocol.AckServerImpressionsRequest:
-		h.submitAckRequest(realRequest, opts...)
-	}
-	return errors.New("can't support this request type")
-}
-
-func (h *ConcurrentHelper) submitWriteUsersRequest(request *protocol.WriteUsersRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteUsers(request.(*protocol.WriteUsersRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteUsers] occur error, msg:%s", err.Error())
-			return
+		submission.API = common.APIWriteUsers
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteUsers(request.(*protocol.WriteUsersRequest), opts...)
 		}
-		if common.IsSuccess(response.(*protocol.WriteUsersResponse).GetStatus()) {
-			logs.Info("[AsyncWriteUsers] success")
-			return
+	case *protocol.WriteContentsRequest:
+		submission.API = common.APIWriteContents
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteContents(request.(*protocol.WriteContentsRequest), opts...)
 		}
-		logs.Error("[AsyncWriteUsers] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
-}
-
-func (h *ConcurrentHelper) submitWriteContentsRequest(request *protocol.WriteContentsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteContents(request.(*protocol.WriteContentsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteContents] occur error, msg:%s", err.Error())
-			return
+	case *protocol.WriteUserEventsRequest:
+		submission.API = common.APIWriteUserEvents
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteUserEvents(request.(*protocol.WriteUserEventsRequest), opts...)
 		}
-		if common.IsSuccess(response.(*protocol.WriteContentsResponse).GetStatus()) {
-			logs.Info("[AsyncWriteContents] success")
-			return
+	case *protocol.AckServerImpressionsRequest:
+		submission.API = common.APIAckServerImpressions
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.AckServerImpressions(request.(*protocol.AckServerImpressionsRequest), opts...)
 		}
-		logs.Error("[AsyncWriteContents] fail, rsp:\n%s", response)
+	default:
+		return nil, errors.New("can't support this request type")
 	}
-	h.taskChan <- task
+	return h.helper.Submit(submission)
 }
 
-func (h *ConcurrentHelper) submitWriteUserEventsRequest(request *protocol.WriteUserEventsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteUserEvents(request.(*protocol.WriteUserEventsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteUserEvents] occur error, msg:%s", err.Error())
-			return
-		}
-		if common.IsSuccess(response.(*protocol.WriteUserEventsResponse).GetStatus()) {
-			logs.Info("[AsyncWriteUserEvents] success")
-			return
-		}
-		logs.Error("[AsyncWriteUserEvents] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
+// QueueDepth returns the count of submitted requests waiting for a free consumer
+func (h *ConcurrentHelper) QueueDepth() int {
+	return h.helper.QueueDepth()
 }
 
-func (h *ConcurrentHelper) submitAckRequest(request *protocol.AckServerImpressionsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.AckServerImpressions(request.(*protocol.AckServerImpressionsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncAckImpressions] occur error, msg:%s", err.Error())
-			return
-		}
-		if common.IsSuccess(response.(*protocol.AckServerImpressionsResponse).GetStatus()) {
-			logs.Info("[AsyncAckImpressions] success")
-			return
-		}
-		logs.Error("[AsyncAckImpressions] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
+// Shutdown stops accepting new requests, and waits until the submitted
+// requests complete or ctx is done, the abandoned requests are returned
+func (h *ConcurrentHelper) Shutdown(ctx context.Context) ([]*common.Future, error) {
+	return h.helper.Shutdown(ctx)
 }
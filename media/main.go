@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/byteplus-sdk/example-go/common"
-	"github.com/byteplus-sdk/sdk-go/core"
 	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/byteplus-sdk/sdk-go/media"
@@ -14,6 +14,8 @@ import (
 )
 
 const (
+	DefaultRetryTimes = 2
+
 	DefaultWriteTimeout = 800 * time.Millisecond
 
 	DefaultDoneTimeout = 800 * time.Millisecond
@@ -26,27 +28,14 @@ const (
 var (
 	client media.Client
 
+	requestHelper *common.RequestHelper
+
 	concurrentHelper *ConcurrentHelper
+
+	wal *common.WAL
 )
 
 const (
-	// Token
-	// A unique token assigned by bytedance, which is used to
-	// generate an authenticated signature when building a request.
-	// It is sometimes called "secret".
-	Token = "xxxxxxxxxxxxxxxxxxxxx"
-
-	// TenantId
-	// A unique ID assigned by Bytedance, which is used to
-	// generate an authenticated signature when building a request
-	// It is sometimes called "appkey".
-	TenantId = "xxxxxxxxxxxx"
-
-	// Tenant
-	// A unique identity assigned by Bytedance, which is need to fill in URL.
-	// It is sometimes called "company".
-	Tenant = "media_demo"
-
 	TopicUser      = "user"
 	TopicContent   = "content"
 	TopicUserEvent = "user_event"
@@ -75,18 +64,46 @@ func init() {
 	//}
 
 	logs.Level = logs.LevelDebug
-	client, _ = (&media.ClientBuilder{}).
-		Tenant(Tenant).        // Required
-		TenantId(TenantId).    // Required
-		Token(Token).          // Required
-		Region(core.RegionSg). // Required
-		//Schema("https"). // Optional
-		//Hosts([]string{"rec-ap-singapore-1.byteplusapi.com"}).
-		//Headers(map[string]string{"Customer-Header": "Value"}). // Optional
+	// The credentials are loaded from the config file and the environment variables,
+	// e.g. "BYTEPLUS_CONFIG=config.yaml BYTEPLUS_PROFILE=staging go run .", see common.ConfigLoader.
+	// The requests are sent to the local mock server when BYTEPLUS_MOCK_HOST is set,
+	// e.g. run "go run ./mockserver/cmd -vertical media" in the project directory,
+	// then "BYTEPLUS_MOCK_HOST=127.0.0.1:8080 go run ." in this directory
+	config, err := common.LoadClientConfig(common.VerticalMedia)
+	if err != nil {
+		logs.Error("[Init] load client config fail, msg:%s", err.Error())
+		os.Exit(1)
+	}
+	client, _ = config.MediaClientBuilder().
 		//MetricsConfig(metricsConfig). // Optional
 		//HostAvailablerConfig(hostAvailablerConfig). // Optional
 		Build()
-	concurrentHelper = NewConcurrentHelper(client)
+	// Limit the QPS of each api on client side to avoid exceeding the quota,
+	// the requests sent by requestHelper and concurrentHelper share the limits.
+	// Please adjust them according to the quota of your account
+	rateLimiters := common.NewRateLimiterGroup(map[string]*common.RateLimiterConfig{
+		common.APIWriteUsers:           {QPS: 50},
+		common.APIWriteContents:        {QPS: 50},
+		common.APIWriteUserEvents:      {QPS: 50},
+		common.APIPredict:              {QPS: 100},
+		common.APIAckServerImpressions: {QPS: 100},
+	})
+	requestHelper = &common.RequestHelper{Client: client, RateLimiters: rateLimiters}
+	// The requests which ultimately fail are kept in the dead letter file,
+	// and the requests not complete when the process dies are kept in WAL
+	var pending []*common.DeadLetter
+	wal, pending, err = common.OpenWAL(WALFile)
+	if err != nil {
+		logs.Error("open wal fail, the submitted requests are not kept, msg:%s", err.Error())
+	}
+	concurrentHelper = NewConcurrentHelper(client, requestHelper, &common.ConcurrentHelperConfig{
+		DeadLetterSink: common.NewFileDeadLetterSink(DeadLetterFile),
+		WAL:            wal,
+	})
+	// Submit again the requests not complete before the last exit
+	if len(pending) > 0 {
+		logs.Info("resubmit %d requests in wal, submitted:%d", len(pending), resubmit(pending))
+	}
 }
 
 /**
@@ -98,6 +115,14 @@ func init() {
  * you can change account to yours here: {@link Constant}
  */
 func main() {
+	// Resubmit the requests kept in the dead letter file,
+	// e.g. "go run . replay dead_letters.jsonl"
+	if len(os.Args) == 3 && os.Args[1] == "replay" {
+		replayDeadLetters(os.Args[2])
+		shutdown()
+		return
+	}
+
 	// Write real-time user data
 	writeUsersExample()
 	// Write real-time user data concurrently
@@ -113,18 +138,32 @@ func main() {
 	// Write real-time user event data concurrently
 	concurrentWriteUserEventsExample()
 
+	// Write real-time user data one by one, which are sent in batches
+	batchWriteExample()
+
 	// Pass a date list to mark the completion of data synchronization for these days.
 	doneExample()
 
 	// Get recommendation results
 	recommendExample()
 
-	// Pause for 5 seconds until the asynchronous import task completes
-	time.Sleep(5 * time.Second)
-	client.Release()
+	shutdown()
 	os.Exit(0)
 }
 
+func shutdown() {
+	// Wait at most 5 seconds until the asynchronous tasks complete,
+	// the client can't be released before that
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	abandoned, err := concurrentHelper.Shutdown(ctx)
+	cancel()
+	if err != nil {
+		logs.Warn("asynchronous tasks not complete, abandoned:%d", len(abandoned))
+	}
+	_ = wal.Close()
+	client.Release()
+}
+
 func writeUsersExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUsersRequest(1)
@@ -146,7 +185,7 @@ func concurrentWriteUsersExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUsersRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteUsersRequest(count int) *protocol.WriteUsersRequest {
@@ -178,7 +217,7 @@ func concurrentWriteContentsExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteContentsRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteContentsRequest(count int) *protocol.WriteContentsRequest {
@@ -210,7 +249,7 @@ func concurrentWriteUserEventsExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUserEventsRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteUserEventsRequest(count int) *protocol.WriteUserEventsRequest {
@@ -241,6 +280,8 @@ func recommendExample() {
 	predictRequest := buildPredictRequest()
 	predictOpts := defaultOptions(DefaultPredictTimeout)
 	// The "home" is scene name, which provided by ByteDance, usually is "home"
+	// Wait for the quota of predict, it never fails without deadline
+	_ = requestHelper.RateLimiters.Wait(context.Background(), common.APIPredict)
 	response, err := client.Predict(predictRequest, "home", predictOpts...)
 	if err != nil {
 		logs.Error("predict occur error, msg:%s", err.Error())
@@ -256,7 +297,7 @@ func recommendExample() {
 	alteredContents := doSomethingWithPredictResult(response.GetValue())
 	ackRequest := buildAckRequest(response.GetRequestId(), predictRequest, alteredContents)
 	ackOpts := defaultOptions(DefaultAckImpressionsTimeout)
-	_ = concurrentHelper.SubmitRequest(ackRequest, ackOpts...)
+	_, _ = concurrentHelper.SubmitRequest(ackRequest, ackOpts...)
 }
 
 func buildPredictRequest() *protocol.PredictRequest {
@@ -322,6 +363,27 @@ func buildAckRequest(predictRequestId string, predictRequest *protocol.PredictRe
 	}
 }
 
+func batchWriteExample() {
+	// The users written one by one are sent in batches of at most 2000 items,
+	// and the batch not full is sent after waiting 1 second
+	batchWriter := NewBatchWriter(client, requestHelper, &common.BatchWriterConfig{
+		BatchSize: common.MaxWriteItems,
+		Linger:    time.Second,
+	})
+	for _, user := range mockUsers(10) {
+		if err := batchWriter.WriteUsers(user); err != nil {
+			logs.Error("batch write user occur err, msg:%s", err.Error())
+			return
+		}
+	}
+	// Write the remaining data before exit
+	if err := batchWriter.Close(); err != nil {
+		logs.Error("batch write user occur err, msg:%s", err.Error())
+		return
+	}
+	logs.Info("batch write user success")
+}
+
 func defaultOptions(timeout time.Duration) []option.Option {
 	// All options are optional
 	// var customerHeaders map[string]string
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/media/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DeadLetterFile stores the requests which ultimately fail in concurrentHelper
+	DeadLetterFile = "dead_letters.jsonl"
+
+	// WALFile keeps the requests submitted to concurrentHelper until they complete
+	WALFile = "submissions.wal"
+)
+
+// newReplayRequest returns an empty request of the api and its timeout,
+// the request is nil if the api can't be replayed
+func newReplayRequest(api string) (proto.Message, time.Duration) {
+	switch api {
+	case common.APIWriteUsers:
+		return &protocol.WriteUsersRequest{}, DefaultWriteTimeout
+	case common.APIWriteContents:
+		return &protocol.WriteContentsRequest{}, DefaultWriteTimeout
+	case common.APIWriteUserEvents:
+		return &protocol.WriteUserEventsRequest{}, DefaultWriteTimeout
+	case common.APIAckServerImpressions:
+		return &protocol.AckServerImpressionsRequest{}, DefaultAckImpressionsTimeout
+	}
+	return nil, 0
+}
+
+// replayDeadLetters resubmits the requests in the dead letter file through
+// concurrentHelper, the ones failing again are written to a new dead letter file
+func replayDeadLetters(path string) {
+	letters, err := common.TakeDeadLetters(path)
+	if err != nil {
+		logs.Error("[Replay] read dead letters fail, msg:%s", err.Error())
+		return
+	}
+	submitted := resubmit(letters)
+	logs.Info("[Replay] submitted %d of %d dead letters", submitted, len(letters))
+}
+
+// resubmit submits the requests kept by dead letters or WAL through
+// concurrentHelper with their original request ids, returns the count
+// of requests submitted successfully
+func resubmit(letters []*common.DeadLetter) int {
+	submitted := 0
+	for _, letter := range letters {
+		request, timeout := newReplayRequest(letter.API)
+		if request == nil {
+			logs.Error("[Replay] can't replay api:%s requestId:%s", letter.API, letter.RequestId)
+			continue
+		}
+		if err := letter.DecodeProto(request); err != nil {
+			logs.Error("[Replay] decode request fail, api:%s requestId:%s msg:%s",
+				letter.API, letter.RequestId, err.Error())
+			continue
+		}
+		opts := append(letter.Options(), option.WithTimeout(timeout))
+		if _, err := concurrentHelper.SubmitRequest(request, opts...); err != nil {
+			logs.Error("[Replay] submit fail, api:%s requestId:%s msg:%s",
+				letter.API, letter.RequestId, err.Error())
+			continue
+		}
+		submitted++
+	}
+	return submitted
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/byteplus-sdk/example-go/mockserver"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+)
+
+/**
+ * Run a local mock server, and point the examples to it, e.g.
+ *   go run ./mockserver/cmd -addr 127.0.0.1:8080 -faults "WriteUsers:too_many_request:2"
+ *   cd retailv2 && BYTEPLUS_MOCK_HOST=127.0.0.1:8080 go run .
+ */
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "the address to listen on")
+	vertical := flag.String("vertical", mockserver.VerticalRetailV2,
+		"the vertical of the requests whose path doesn't contain the vertical")
+	faultSpec := flag.String("faults", "",
+		"the faults to inject, in the form of \"api:kind[:times[:delay]],...\"")
+	operationDelay := flag.Duration("operation-delay", 0, "the time an import operation takes")
+	flag.Parse()
+
+	faults, err := mockserver.ParseFaults(*faultSpec)
+	if err != nil {
+		logs.Error("parse faults fail, msg:%s", err.Error())
+		os.Exit(1)
+	}
+	server := mockserver.NewServer(&mockserver.Config{
+		Vertical:       *vertical,
+		OperationDelay: *operationDelay,
+		Faults:         faults,
+	})
+	logs.Info("mock server is listening on %s", *addr)
+	if err := server.ListenAndServe(*addr); err != nil {
+		logs.Error("mock server exit, msg:%s", err.Error())
+		os.Exit(1)
+	}
+}
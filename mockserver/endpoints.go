@@ -0,0 +1,445 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/byteplus-sdk/example-go/common"
+	bpair "github.com/byteplus-sdk/sdk-go/byteair/protocol"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	general "github.com/byteplus-sdk/sdk-go/general/protocol"
+	media "github.com/byteplus-sdk/sdk-go/media/protocol"
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	retailv2 "github.com/byteplus-sdk/sdk-go/retailv2/protocol"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The topics of the data in path
+const (
+	topicUser      = "user"
+	topicProduct   = "product"
+	topicContent   = "content"
+	topicUserEvent = "user_event"
+	topicItem      = "item"
+)
+
+// endpoints are the apis of a vertical
+type endpoints struct {
+	// topic -> write api
+	writes map[string]*endpoint
+	// topic -> import api
+	imports map[string]*endpoint
+	// The WriteData api of general and byteair, which accepts any topic
+	writeData *endpoint
+	predict   *endpoint
+	ack       *endpoint
+	callback  *endpoint
+}
+
+// recordSpec tells how to validate and save the records of a topic
+type recordSpec struct {
+	// The field identifying the record, the record with the same id is
+	// overwritten, empty means the records are never overwritten
+	idField string
+	// The fields must not be empty
+	requiredFields []string
+}
+
+var (
+	userSpec      = &recordSpec{idField: "user_id", requiredFields: []string{"user_id"}}
+	productSpec   = &recordSpec{idField: "product_id", requiredFields: []string{"product_id"}}
+	contentSpec   = &recordSpec{idField: "content_id", requiredFields: []string{"content_id"}}
+	userEventSpec = &recordSpec{requiredFields: []string{"user_id", "event_type"}}
+)
+
+var verticalEndpoints = map[string]*endpoints{
+	VerticalRetail: {
+		writes: map[string]*endpoint{
+			topicUser: writeEndpoint(common.APIWriteUsers, userSpec,
+				func() proto.Message { return &retail.WriteUsersRequest{} },
+				func() proto.Message { return &retail.WriteUsersResponse{} }),
+			topicProduct: writeEndpoint(common.APIWriteProducts, productSpec,
+				func() proto.Message { return &retail.WriteProductsRequest{} },
+				func() proto.Message { return &retail.WriteProductsResponse{} }),
+			topicUserEvent: writeEndpoint(common.APIWriteUserEvents, userEventSpec,
+				func() proto.Message { return &retail.WriteUserEventsRequest{} },
+				func() proto.Message { return &retail.WriteUserEventsResponse{} }),
+		},
+		imports: map[string]*endpoint{
+			topicUser: importEndpoint(common.APIImportUsers, userSpec,
+				func() proto.Message { return &retail.ImportUsersRequest{} },
+				func() proto.Message { return &retail.ImportUsersResponse{} }),
+			topicProduct: importEndpoint(common.APIImportProducts, productSpec,
+				func() proto.Message { return &retail.ImportProductsRequest{} },
+				func() proto.Message { return &retail.ImportProductsResponse{} }),
+			topicUserEvent: importEndpoint(common.APIImportUserEvents, userEventSpec,
+				func() proto.Message { return &retail.ImportUserEventsRequest{} },
+				func() proto.Message { return &retail.ImportUserEventsResponse{} }),
+		},
+		predict: &endpoint{
+			api:         common.APIPredict,
+			newResponse: func() proto.Message { return &retail.PredictResponse{} },
+			handle: func(s *Server, req *request, response proto.Message) error {
+				predictRequest := &retail.PredictRequest{}
+				if err := req.decode(predictRequest); err != nil {
+					return err
+				}
+				result := &retail.PredictResult{}
+				for i, id := range s.predictIds(req.vertical, topicProduct, predictRequest.GetSize()) {
+					result.ResponseProducts = append(result.ResponseProducts,
+						&retail.PredictResult_ResponseProduct{ProductId: id, Rank: int32(i + 1)})
+				}
+				setSuccess(response)
+				predictResponse := response.(*retail.PredictResponse)
+				predictResponse.RequestId = uuid.NewString()
+				predictResponse.Value = result
+				return nil
+			},
+		},
+		ack: ackEndpoint(common.APIAckServerImpressions,
+			func() proto.Message { return &retail.AckServerImpressionsRequest{} },
+			func() proto.Message { return &retail.AckServerImpressionsResponse{} }),
+	},
+	VerticalRetailV2: {
+		writes: map[string]*endpoint{
+			topicUser: writeEndpoint(common.APIWriteUsers, userSpec,
+				func() proto.Message { return &retailv2.WriteUsersRequest{} },
+				func() proto.Message { return &retailv2.WriteUsersResponse{} }),
+			topicProduct: writeEndpoint(common.APIWriteProducts, productSpec,
+				func() proto.Message { return &retailv2.WriteProductsRequest{} },
+				func() proto.Message { return &retailv2.WriteProductsResponse{} }),
+			topicUserEvent: writeEndpoint(common.APIWriteUserEvents, userEventSpec,
+				func() proto.Message { return &retailv2.WriteUserEventsRequest{} },
+				func() proto.Message { return &retailv2.WriteUserEventsResponse{} }),
+		},
+		predict: &endpoint{
+			api:         common.APIPredict,
+			newResponse: func() proto.Message { return &retailv2.PredictResponse{} },
+			handle: func(s *Server, req *request, response proto.Message) error {
+				predictRequest := &retailv2.PredictRequest{}
+				if err := req.decode(predictRequest); err != nil {
+					return err
+				}
+				result := &retailv2.PredictResult{}
+				for i, id := range s.predictIds(req.vertical, topicProduct, predictRequest.GetSize()) {
+					result.ResponseProducts = append(result.ResponseProducts,
+						&retailv2.PredictResult_ResponseProduct{ProductId: id, Rank: int32(i + 1)})
+				}
+				setSuccess(response)
+				predictResponse := response.(*retailv2.PredictResponse)
+				predictResponse.RequestId = uuid.NewString()
+				predictResponse.Value = result
+				return nil
+			},
+		},
+		ack: ackEndpoint(common.APIAckServerImpressions,
+			func() proto.Message { return &retailv2.AckServerImpressionsRequest{} },
+			func() proto.Message { return &retailv2.AckServerImpressionsResponse{} }),
+	},
+	VerticalMedia: {
+		writes: map[string]*endpoint{
+			topicUser: writeEndpoint(common.APIWriteUsers, userSpec,
+				func() proto.Message { return &media.WriteUsersRequest{} },
+				func() proto.Message { return &media.WriteUsersResponse{} }),
+			topicContent: writeEndpoint(common.APIWriteContents, contentSpec,
+				func() proto.Message { return &media.WriteContentsRequest{} },
+				func() proto.Message { return &media.WriteContentsResponse{} }),
+			topicUserEvent: writeEndpoint(common.APIWriteUserEvents, userEventSpec,
+				func() proto.Message { return &media.WriteUserEventsRequest{} },
+				func() proto.Message { return &media.WriteUserEventsResponse{} }),
+		},
+		predict: &endpoint{
+			api:         common.APIPredict,
+			newResponse: func() proto.Message { return &media.PredictResponse{} },
+			handle: func(s *Server, req *request, response proto.Message) error {
+				predictRequest := &media.PredictRequest{}
+				if err := req.decode(predictRequest); err != nil {
+					return err
+				}
+				result := &media.PredictResult{}
+				for i, id := range s.predictIds(req.vertical, topicContent, predictRequest.GetSize()) {
+					result.ResponseContents = append(result.ResponseContents,
+						&media.PredictResult_ResponseContent{ContentId: id, Rank: int32(i + 1)})
+				}
+				setSuccess(response)
+				predictResponse := response.(*media.PredictResponse)
+				predictResponse.RequestId = uuid.NewString()
+				predictResponse.Value = result
+				return nil
+			},
+		},
+		ack: ackEndpoint(common.APIAckServerImpressions,
+			func() proto.Message { return &media.AckServerImpressionsRequest{} },
+			func() proto.Message { return &media.AckServerImpressionsResponse{} }),
+	},
+	VerticalGeneral: {
+		writeData: writeDataEndpoint(func() proto.Message { return &general.WriteResponse{} }),
+		predict: &endpoint{
+			api:         common.APIPredict,
+			newResponse: func() proto.Message { return &general.PredictResponse{} },
+			handle: func(s *Server, req *request, response proto.Message) error {
+				predictRequest := &general.PredictRequest{}
+				if err := req.decode(predictRequest); err != nil {
+					return err
+				}
+				result := &general.PredictResult{}
+				for i, id := range s.predictIds(req.vertical, topicItem, predictRequest.GetSize()) {
+					result.Items = append(result.Items, &general.PredictItem{Id: id, Rank: int32(i + 1)})
+				}
+				setSuccess(response)
+				predictResponse := response.(*general.PredictResponse)
+				predictResponse.RequestId = uuid.NewString()
+				predictResponse.Value = result
+				return nil
+			},
+		},
+		callback: ackEndpoint(common.APICallback,
+			func() proto.Message { return &general.CallbackRequest{} },
+			func() proto.Message { return &general.CallbackResponse{} }),
+	},
+	VerticalByteAir: {
+		writeData: writeDataEndpoint(func() proto.Message { return &bpair.WriteResponse{} }),
+		predict: &endpoint{
+			api:         common.APIPredict,
+			newResponse: func() proto.Message { return &bpair.PredictResponse{} },
+			handle: func(s *Server, req *request, response proto.Message) error {
+				predictRequest := &bpair.PredictRequest{}
+				if err := req.decode(predictRequest); err != nil {
+					return err
+				}
+				result := &bpair.PredictResult{}
+				for i, id := range s.predictIds(req.vertical, topicItem, predictRequest.GetSize()) {
+					result.Items = append(result.Items, &bpair.PredictItem{Id: id, Rank: int32(i + 1)})
+				}
+				setSuccess(response)
+				predictResponse := response.(*bpair.PredictResponse)
+				predictResponse.RequestId = uuid.NewString()
+				predictResponse.Value = result
+				return nil
+			},
+		},
+		callback: ackEndpoint(common.APICallback,
+			func() proto.Message { return &bpair.CallbackRequest{} },
+			func() proto.Message { return &bpair.CallbackResponse{} }),
+	},
+}
+
+// dataError is the error of an invalid record
+type dataError struct {
+	message string
+	data    string
+}
+
+// writeEndpoint creates the "WriteXXX" api, which saves the valid
+// records, and returns the errors of the invalid ones in "errors"
+func writeEndpoint(api string, spec *recordSpec,
+	newRequest func() proto.Message, newResponse func() proto.Message) *endpoint {
+	return &endpoint{
+		api:         api,
+		newResponse: newResponse,
+		handle: func(s *Server, req *request, response proto.Message) error {
+			writeRequest := newRequest()
+			if err := req.decode(writeRequest); err != nil {
+				return err
+			}
+			if s.isIdempotent(req.requestId) {
+				setStatus(response, core.StatusCodeIdempotent, "idempotent request")
+				return nil
+			}
+			dataErrors := s.saveMessages(req, spec, findRecords(writeRequest.ProtoReflect()))
+			setDataErrors(response, "errors", dataErrors)
+			return nil
+		},
+	}
+}
+
+// importEndpoint creates the "ImportXXX" api, which saves the valid records,
+// and returns an operation whose response is the result of the import
+func importEndpoint(api string, spec *recordSpec,
+	newRequest func() proto.Message, newImportResponse func() proto.Message) *endpoint {
+	return &endpoint{
+		api:         api,
+		newResponse: func() proto.Message { return &OperationResponse{} },
+		handle: func(s *Server, req *request, response proto.Message) error {
+			importRequest := newRequest()
+			if err := req.decode(importRequest); err != nil {
+				return err
+			}
+			op, replay := s.reserveImport(req.vertical, req.requestId)
+			if replay {
+				// The operation is returned for the retry of the import timed out
+				setStatus(response, core.StatusCodeIdempotent, "idempotent request")
+				response.(*OperationResponse).Operation = op
+				return nil
+			}
+			dataErrors := s.saveMessages(req, spec, findRecords(importRequest.ProtoReflect()))
+			importResponse := newImportResponse()
+			setDataErrors(importResponse, "error_samples", dataErrors)
+			if err := s.finishImport(op.Name, importResponse); err != nil {
+				return err
+			}
+			setSuccess(response)
+			response.(*OperationResponse).Operation = op
+			return nil
+		},
+	}
+}
+
+// writeDataEndpoint creates the "WriteData" api of general and byteair,
+// whose request is the JSON list of the records of any topic
+func writeDataEndpoint(newResponse func() proto.Message) *endpoint {
+	return &endpoint{
+		api:         common.APIWriteData,
+		newResponse: newResponse,
+		handle: func(s *Server, req *request, response proto.Message) error {
+			var dataList []json.RawMessage
+			if err := json.Unmarshal(req.body, &dataList); err != nil {
+				return fmt.Errorf("parse data list fail, msg:%s", err.Error())
+			}
+			if s.isIdempotent(req.requestId) {
+				setStatus(response, core.StatusCodeIdempotent, "idempotent request")
+				return nil
+			}
+			var dataErrors []*dataError
+			for _, data := range dataList {
+				decoder := json.NewDecoder(bytes.NewReader(data))
+				decoder.UseNumber()
+				record := make(map[string]interface{})
+				if err := decoder.Decode(&record); err != nil || len(record) == 0 {
+					dataErrors = append(dataErrors, &dataError{message: "empty or invalid data", data: string(data)})
+					continue
+				}
+				s.save(req.vertical, req.topic, dataId(record, req.topic), data)
+			}
+			setDataErrors(response, "errors", dataErrors)
+			return nil
+		},
+	}
+}
+
+// ackEndpoint creates the api which only replies success,
+// such as "AckServerImpressions" and "Callback"
+func ackEndpoint(api string, newRequest func() proto.Message, newResponse func() proto.Message) *endpoint {
+	return &endpoint{
+		api:         api,
+		newResponse: newResponse,
+		handle: func(s *Server, req *request, response proto.Message) error {
+			if err := req.decode(newRequest()); err != nil {
+				return err
+			}
+			setSuccess(response)
+			return nil
+		},
+	}
+}
+
+// predictIds returns the ids of the records to recommend, size is the
+// size of the predict request, 0 means the default size
+func (s *Server) predictIds(vertical, topic string, size int32) []string {
+	if size <= 0 {
+		size = defaultPredictSize
+	}
+	return s.ids(vertical, topic, int(size))
+}
+
+// saveMessages validates and saves the records, and returns the errors of invalid ones
+func (s *Server) saveMessages(req *request, spec *recordSpec, records []protoreflect.Message) []*dataError {
+	var dataErrors []*dataError
+	for _, record := range records {
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(record.Interface())
+		if err != nil {
+			dataErrors = append(dataErrors, &dataError{message: err.Error()})
+			continue
+		}
+		if missing := missingField(record, spec.requiredFields); missing != "" {
+			dataErrors = append(dataErrors, &dataError{message: "missing " + missing, data: string(data)})
+			continue
+		}
+		id := ""
+		if spec.idField != "" {
+			id = fieldString(record, spec.idField)
+		}
+		s.save(req.vertical, req.topic, id, data)
+	}
+	return dataErrors
+}
+
+// findRecords finds the records in the request, which are the first
+// repeated message field of the request, or of its message field,
+// such as "users" of WriteUsersRequest, and
+// "input_config.users_inline_source.users" of ImportUsersRequest
+func findRecords(message protoreflect.Message) []protoreflect.Message {
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Message() == nil || fd.IsMap() || !message.Has(fd) {
+			continue
+		}
+		if fd.IsList() {
+			list := message.Get(fd).List()
+			records := make([]protoreflect.Message, list.Len())
+			for j := range records {
+				records[j] = list.Get(j).Message()
+			}
+			return records
+		}
+		if records := findRecords(message.Get(fd).Message()); records != nil {
+			return records
+		}
+	}
+	return nil
+}
+
+func missingField(record protoreflect.Message, fields []string) string {
+	for _, field := range fields {
+		if fieldString(record, field) == "" {
+			return field
+		}
+	}
+	return ""
+}
+
+func fieldString(record protoreflect.Message, field string) string {
+	fd := record.Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil || !record.Has(fd) {
+		return ""
+	}
+	return record.Get(fd).String()
+}
+
+// dataId returns the id of the data of WriteData, which is the field
+// "id" or "{topic}_id", empty if the data doesn't have id, such as behavior
+func dataId(record map[string]interface{}, topic string) string {
+	for _, field := range []string{"id", topic + "_id"} {
+		if id, ok := record[field]; ok {
+			return strings.TrimSpace(fmt.Sprint(id))
+		}
+	}
+	return ""
+}
+
+// setDataErrors sets the errors to the field of the response, and sets
+// the status to failure if there are errors, otherwise to success
+func setDataErrors(response proto.Message, field string, dataErrors []*dataError) {
+	if len(dataErrors) == 0 {
+		setSuccess(response)
+		return
+	}
+	setStatus(response, statusCodeInvalidData, fmt.Sprintf("%d items are invalid", len(dataErrors)))
+	m := response.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(field))
+	list := m.Mutable(fd).List()
+	for _, itemError := range dataErrors {
+		elem := list.NewElement()
+		errorFields := elem.Message().Descriptor().Fields()
+		elem.Message().Set(errorFields.ByName("message"), protoreflect.ValueOfString(itemError.message))
+		elem.Message().Set(errorFields.ByName("data"), protoreflect.ValueOfString(itemError.data))
+		list.Append(elem)
+	}
+}
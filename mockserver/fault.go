@@ -0,0 +1,150 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byteplus-sdk/sdk-go/core"
+	"google.golang.org/protobuf/proto"
+)
+
+// FaultKind is how the server fails the request
+type FaultKind string
+
+const (
+	// FaultTimeout delays the response by Fault.Delay, the request
+	// is still handled, so that the client may send it again
+	FaultTimeout FaultKind = "timeout"
+
+	// FaultTooManyRequest returns the status of StatusCodeTooManyRequest
+	FaultTooManyRequest FaultKind = "too_many_request"
+
+	// FaultOperationLoss returns the status of StatusCodeOperationLoss,
+	// which is expected by GetOperation
+	FaultOperationLoss FaultKind = "operation_loss"
+
+	// FaultServerError returns http status 500
+	FaultServerError FaultKind = "server_error"
+)
+
+// The delay of FaultTimeout, which exceeds the default timeouts of the examples
+const defaultFaultDelay = 5 * time.Second
+
+// Fault fails the requests of an api in the way of Kind
+type Fault struct {
+	Kind FaultKind
+
+	// API is the name of the api, such as common.APIWriteUsers,
+	// empty or "*" means all the apis
+	API string
+
+	// Times is the count of requests failed by the fault,
+	// the fault is always applied if it is 0
+	Times int
+
+	// Delay is the delay of FaultTimeout, default is 5s
+	Delay time.Duration
+}
+
+// ParseFaults parses the faults separated by ",", each of them is
+// "api:kind[:times[:delay]]", such as "WriteUsers:too_many_request:2"
+// or "*:timeout:1:3s", the "api" is the name of api, such as
+// common.APIWriteUsers, and "*" means all the apis
+func ParseFaults(spec string) ([]*Fault, error) {
+	var faults []*Fault
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid fault:%s", item)
+		}
+		fault := &Fault{API: parts[0], Kind: FaultKind(parts[1])}
+		switch fault.Kind {
+		case FaultTimeout, FaultTooManyRequest, FaultOperationLoss, FaultServerError:
+		default:
+			return nil, fmt.Errorf("unknown fault kind:%s", parts[1])
+		}
+		if len(parts) > 2 {
+			times, err := strconv.Atoi(parts[2])
+			if err != nil || times < 0 {
+				return nil, fmt.Errorf("invalid fault times:%s", parts[2])
+			}
+			fault.Times = times
+		}
+		if len(parts) > 3 {
+			delay, err := time.ParseDuration(parts[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid fault delay:%s", parts[3])
+			}
+			fault.Delay = delay
+		}
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
+
+// InjectFault adds the fault, which is applied to the requests
+// after the faults injected before are used up
+func (s *Server) InjectFault(fault *Fault) {
+	faultCopy := *fault
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &faultCopy)
+}
+
+// ClearFaults removes all the faults
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// takeFault returns the first fault of the api, the fault
+// is removed once it has failed the requests for Times
+func (s *Server) takeFault(api string) *Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, fault := range s.faults {
+		if fault.API != "" && fault.API != "*" && fault.API != api {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+// apply fails the request, the response should be written
+// after it if true is returned
+func (f *Fault) apply(w http.ResponseWriter, r *http.Request, response proto.Message) bool {
+	switch f.Kind {
+	case FaultTimeout:
+		delay := f.Delay
+		if delay <= 0 {
+			delay = defaultFaultDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	case FaultTooManyRequest:
+		setStatus(response, core.StatusCodeTooManyRequest, "too many request")
+	case FaultOperationLoss:
+		setStatus(response, core.StatusCodeOperationLoss, "operation loss")
+	case FaultServerError:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,517 @@
+package mockserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// The verticals served by Server
+const (
+	VerticalRetail   = "retail"
+	VerticalRetailV2 = "retailv2"
+	VerticalMedia    = "media"
+	VerticalGeneral  = "general"
+	VerticalByteAir  = "byteair"
+)
+
+const (
+	// The status code returned when some items of a write are invalid
+	statusCodeInvalidData = 400
+
+	defaultPredictSize = 10
+
+	defaultListPageSize = 100
+)
+
+// Config is the configuration of Server,
+// the zero value of each field means using the default value
+type Config struct {
+	// The vertical of the requests whose path doesn't contain
+	// the name of a vertical, default is VerticalRetailV2
+	Vertical string
+
+	// The time an import operation takes before it is done,
+	// default is 0, the operation is done at the first GetOperation
+	OperationDelay time.Duration
+
+	// The faults injected before the server starts
+	Faults []*Fault
+}
+
+// Server is a fake BytePlus server for running the examples offline.
+// It serves the write/import/done/predict/ack/callback and
+// GetOperation/ListOperations apis of all the verticals, with the
+// same protobuf/JSON wire formats as the real server, keeps the written
+// records in memory, and fails the requests by the injected faults.
+// The vertical and the api of a request are decided by its path, such as
+// "/data/api/retail/{tenant}/user?method=write", it is lenient on the
+// other segments, so that it works with the urls of each SDK version
+type Server struct {
+	config *Config
+
+	lock sync.Mutex
+	// vertical -> topic -> records
+	tables     map[string]map[string]*table
+	operations []*operation
+	// The request ids of the writes saved, the requests
+	// with the same request id are treated as idempotent
+	requestIds map[string]bool
+	// The operations of the imports by request id, the import with
+	// the same request id is replied with the operation created before
+	imports map[string]*operation
+	faults  []*Fault
+}
+
+// table keeps the records of a topic in the order of first writing,
+// the records with the same id are overwritten
+type table struct {
+	ids     []string
+	records map[string]json.RawMessage
+}
+
+type operation struct {
+	vertical  string
+	createdAt time.Time
+	proto     *Operation
+	response  *anypb.Any
+}
+
+// request is the request parsed by ServeHTTP
+type request struct {
+	vertical  string
+	topic     string
+	requestId string
+	body      []byte
+	isJSON    bool
+}
+
+// endpoint is an api of a vertical
+type endpoint struct {
+	api string
+	// newResponse creates an empty response of the api,
+	// which is also used to return the injected failure status
+	newResponse func() proto.Message
+	// handle fills the response of the request,
+	// the error is returned to the client as bad request
+	handle func(s *Server, req *request, response proto.Message) error
+}
+
+func NewServer(config *Config) *Server {
+	if config == nil {
+		config = &Config{}
+	}
+	configCopy := *config
+	if configCopy.Vertical == "" {
+		configCopy.Vertical = VerticalRetailV2
+	}
+	return &Server{
+		config:     &configCopy,
+		tables:     make(map[string]map[string]*table),
+		requestIds: make(map[string]bool),
+		imports:    make(map[string]*operation),
+		faults:     append([]*Fault(nil), config.Faults...),
+	}
+}
+
+// ListenAndServe serves on addr, such as "127.0.0.1:8080",
+// the clients can be pointed to it by common.MockHostEnv
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if segments[len(segments)-1] == "ping" {
+		_, _ = w.Write([]byte("pong"))
+		return
+	}
+	req, ep, err := s.route(r, segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.body = body
+	response := ep.newResponse()
+	if fault := s.takeFault(ep.api); fault != nil {
+		logs.Info("[MockServer] inject fault, api:%s kind:%s", ep.api, fault.Kind)
+		if !fault.apply(w, r, response) {
+			return
+		}
+		if fault.Kind == FaultTimeout {
+			// The request is still handled after the delay,
+			// like the real server which finishes the request
+			// after the client gives up
+			if err := ep.handle(s, req, response); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := ep.handle(s, req, response); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeResponse(w, r, response)
+}
+
+// route finds the endpoint by the path and the "method" query
+func (s *Server) route(r *http.Request, segments []string) (*request, *endpoint, error) {
+	req := &request{
+		vertical:  s.resolveVertical(segments),
+		requestId: r.Header.Get("Request-Id"),
+		isJSON:    strings.Contains(r.Header.Get("Content-Type"), "json"),
+	}
+	endpoints := verticalEndpoints[req.vertical]
+	last := segments[len(segments)-1]
+	method := r.URL.Query().Get("method")
+	var ep *endpoint
+	switch {
+	case last == "ack_server_impressions" || last == "ack_impressions":
+		ep = endpoints.ack
+	case last == "callback":
+		ep = endpoints.callback
+	case segments[0] == "predict":
+		ep = endpoints.predict
+	case last == "done":
+		req.topic = r.URL.Query().Get("topic")
+		ep = doneEndpoint
+	case last == "operation" || last == "operations":
+		if method == "list" || (method == "" && last == "operations") {
+			ep = listOperationsEndpoint
+		} else {
+			ep = getOperationEndpoint
+		}
+	case method == "import":
+		req.topic = normalizeTopic(last)
+		ep = endpoints.imports[req.topic]
+	default:
+		req.topic = normalizeTopic(last)
+		ep = endpoints.writes[req.topic]
+		if ep == nil && endpoints.writeData != nil {
+			req.topic = last
+			ep = endpoints.writeData
+		}
+	}
+	if ep == nil {
+		return nil, nil, fmt.Errorf("unknown api, vertical:%s path:%s", req.vertical, r.URL.Path)
+	}
+	return req, ep, nil
+}
+
+func (s *Server) resolveVertical(segments []string) string {
+	for i, segment := range segments {
+		switch segment {
+		case VerticalRetailV2, "retail_v2":
+			return VerticalRetailV2
+		case VerticalRetail:
+			if i+1 < len(segments) && segments[i+1] == "v2" {
+				return VerticalRetailV2
+			}
+			return VerticalRetail
+		case VerticalMedia, VerticalGeneral, VerticalByteAir:
+			return segment
+		}
+	}
+	return s.config.Vertical
+}
+
+// normalizeTopic turns the topic in path, such as "users" or
+// "user-events", to the name of topic, such as "user_event"
+func normalizeTopic(topic string) string {
+	topic = strings.ReplaceAll(strings.ToLower(topic), "-", "_")
+	return strings.TrimSuffix(topic, "s")
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, response proto.Message) {
+	body, err := proto.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		_, _ = writer.Write(body)
+		_ = writer.Close()
+		body = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	_, _ = w.Write(body)
+}
+
+// decode parses the body to the request message,
+// which is in JSON if the Content-Type says so, otherwise in protobuf
+func (req *request) decode(message proto.Message) error {
+	if req.isJSON {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(req.body, message)
+	}
+	return proto.Unmarshal(req.body, message)
+}
+
+// isIdempotent tells whether the request with the same request id
+// has been saved, and marks the request id as saved if not
+func (s *Server) isIdempotent(requestId string) bool {
+	if requestId == "" {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.requestIds[requestId] {
+		return true
+	}
+	s.requestIds[requestId] = true
+	return false
+}
+
+func (s *Server) save(vertical, topic, id string, record json.RawMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	topics := s.tables[vertical]
+	if topics == nil {
+		topics = make(map[string]*table)
+		s.tables[vertical] = topics
+	}
+	t := topics[topic]
+	if t == nil {
+		t = &table{records: make(map[string]json.RawMessage)}
+		topics[topic] = t
+	}
+	if id == "" {
+		// The record without id, such as user event, is never overwritten
+		id = strconv.Itoa(len(t.ids))
+	}
+	if _, ok := t.records[id]; !ok {
+		t.ids = append(t.ids, id)
+	}
+	t.records[id] = record
+}
+
+// Records returns the records saved in the topic of the vertical in JSON,
+// in the order of first writing
+func (s *Server) Records(vertical, topic string) []json.RawMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t := s.tables[vertical][topic]
+	if t == nil {
+		return nil
+	}
+	records := make([]json.RawMessage, len(t.ids))
+	for i, id := range t.ids {
+		records[i] = t.records[id]
+	}
+	return records
+}
+
+// ids returns the ids of at most size records in the topic
+func (s *Server) ids(vertical, topic string, size int) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t := s.tables[vertical][topic]
+	if t == nil {
+		return nil
+	}
+	if size <= 0 || size > len(t.ids) {
+		size = len(t.ids)
+	}
+	return append([]string(nil), t.ids[:size]...)
+}
+
+// reserveImport creates the operation of the import, whose response is set by
+// finishImport. If an import with the same request id has been received, it
+// returns the operation of that import and true, so that the client retrying
+// an import timed out gets the operation to poll
+func (s *Server) reserveImport(vertical, requestId string) (*Operation, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if op, ok := s.imports[requestId]; ok && requestId != "" {
+		return proto.Clone(op.proto).(*Operation), true
+	}
+	op := &operation{
+		vertical:  vertical,
+		createdAt: time.Now(),
+		proto:     &Operation{Name: fmt.Sprintf("operations/%d", len(s.operations)+1)},
+	}
+	s.operations = append(s.operations, op)
+	if requestId != "" {
+		s.imports[requestId] = op
+	}
+	return proto.Clone(op.proto).(*Operation), false
+}
+
+// finishImport sets the response of the operation created by reserveImport
+func (s *Server) finishImport(name string, response proto.Message) error {
+	anyResponse, err := anypb.New(response)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, op := range s.operations {
+		if op.proto.Name == name {
+			op.response = anyResponse
+			return nil
+		}
+	}
+	return fmt.Errorf("operation not found:%s", name)
+}
+
+// operationProto returns the current state of the operation,
+// the response is set once the operation is done
+func (s *Server) operationProto(op *operation) *Operation {
+	result := proto.Clone(op.proto).(*Operation)
+	// The operation isn't done before the import is finished
+	if op.response != nil && time.Since(op.createdAt) >= s.config.OperationDelay {
+		result.Done = true
+		result.Response = op.response
+	}
+	return result
+}
+
+func (s *Server) getOperation(name string) *Operation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, op := range s.operations {
+		if op.proto.Name == name {
+			return s.operationProto(op)
+		}
+	}
+	return nil
+}
+
+// listOperations returns a page of the operations, the page token
+// is the index of the first operation of the page
+func (s *Server) listOperations(pageSize int, pageToken string) ([]*Operation, string, error) {
+	start := 0
+	if pageToken != "" {
+		var err error
+		if start, err = strconv.Atoi(pageToken); err != nil || start < 0 {
+			return nil, "", fmt.Errorf("invalid page token:%s", pageToken)
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var operations []*Operation
+	for i := start; i < len(s.operations) && len(operations) < pageSize; i++ {
+		operations = append(operations, s.operationProto(s.operations[i]))
+	}
+	nextPageToken := ""
+	if end := start + len(operations); end < len(s.operations) {
+		nextPageToken = strconv.Itoa(end)
+	}
+	return operations, nextPageToken, nil
+}
+
+// setStatus sets the "Status" of the response,
+// or the "Code" and "Message" if it doesn't have "Status"
+func setStatus(response proto.Message, code int32, message string) {
+	m := response.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	if fd := fields.ByName("status"); fd != nil && fd.Message() != nil {
+		status := &Status{Code: code, Message: message}
+		m.Set(fd, protoreflect.ValueOfMessage(status.ProtoReflect()))
+		return
+	}
+	if fd := fields.ByName("code"); fd != nil {
+		m.Set(fd, protoreflect.ValueOfInt32(code))
+	}
+	if fd := fields.ByName("message"); fd != nil {
+		m.Set(fd, protoreflect.ValueOfString(message))
+	}
+}
+
+func setSuccess(response proto.Message) {
+	setStatus(response, core.StatusCodeSuccess, "success")
+}
+
+var doneEndpoint = &endpoint{
+	api:         common.APIDone,
+	newResponse: func() proto.Message { return &DoneResponse{} },
+	handle: func(s *Server, req *request, response proto.Message) error {
+		if err := req.decode(&DoneRequest{}); err != nil {
+			return err
+		}
+		setSuccess(response)
+		return nil
+	},
+}
+
+var getOperationEndpoint = &endpoint{
+	api:         common.APIGetOperation,
+	newResponse: func() proto.Message { return &OperationResponse{} },
+	handle: func(s *Server, req *request, response proto.Message) error {
+		getRequest := &GetOperationRequest{}
+		if err := req.decode(getRequest); err != nil {
+			return err
+		}
+		op := s.getOperation(getRequest.GetName())
+		if op == nil {
+			setStatus(response, core.StatusCodeOperationLoss, "operation not found")
+			return nil
+		}
+		setSuccess(response)
+		response.(*OperationResponse).Operation = op
+		return nil
+	},
+}
+
+var listOperationsEndpoint = &endpoint{
+	api:         common.APIListOperations,
+	newResponse: func() proto.Message { return &ListOperationsResponse{} },
+	handle: func(s *Server, req *request, response proto.Message) error {
+		listRequest := &ListOperationsRequest{}
+		if err := req.decode(listRequest); err != nil {
+			return err
+		}
+		operations, nextPageToken, err := s.listOperations(
+			int(listRequest.GetPageSize()), listRequest.GetPageToken())
+		if err != nil {
+			return err
+		}
+		setSuccess(response)
+		listResponse := response.(*ListOperationsResponse)
+		listResponse.Operations = operations
+		listResponse.NextPageToken = nextPageToken
+		return nil
+	},
+}
@@ -0,0 +1,295 @@
+package mockserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core"
+	retail "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+const testTenantPath = "/data/api/retail/tenant"
+
+// post sends the protobuf request to the server, and parses the response to response
+func post(t *testing.T, client *http.Client, url, requestId string,
+	request proto.Message, response proto.Message) error {
+	t.Helper()
+	body, err := proto.Marshal(request)
+	if err != nil {
+		t.Fatalf("expect request marshaled, got err:%v", err)
+	}
+	httpRequest, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	if requestId != "" {
+		httpRequest.Header.Set("Request-Id", requestId)
+	}
+	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Fatalf("expect http status 200, got %d", httpResponse.StatusCode)
+	}
+	body, err = ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(body, response); err != nil {
+		t.Fatalf("expect response parsed, got err:%v", err)
+	}
+	return nil
+}
+
+func importUsersRequest(userIds ...string) *retail.ImportUsersRequest {
+	source := &retail.UsersInlineSource{}
+	for _, userId := range userIds {
+		source.Users = append(source.Users, &retail.User{UserId: userId})
+	}
+	return &retail.ImportUsersRequest{InputConfig: &retail.UsersInputConfig{
+		Source: &retail.UsersInputConfig_UsersInlineSource{UsersInlineSource: source},
+	}}
+}
+
+func getOperation(t *testing.T, url, name string) *OperationResponse {
+	t.Helper()
+	response := &OperationResponse{}
+	if err := post(t, http.DefaultClient, url+testTenantPath+"/operation?method=get", "",
+		&GetOperationRequest{Name: name}, response); err != nil {
+		t.Fatalf("expect operation got, got err:%v", err)
+	}
+	return response
+}
+
+func TestImportIdempotentReplay(t *testing.T) {
+	server := httptest.NewServer(NewServer(&Config{}))
+	defer server.Close()
+	url := server.URL + testTenantPath + "/users?method=import"
+	first := &OperationResponse{}
+	if err := post(t, http.DefaultClient, url, "request-1", importUsersRequest("1", "2"), first); err != nil {
+		t.Fatalf("expect imported, got err:%v", err)
+	}
+	if first.GetStatus().GetCode() != core.StatusCodeSuccess || first.GetOperation().GetName() == "" {
+		t.Fatalf("expect success with operation, got %v", first)
+	}
+	replay := &OperationResponse{}
+	if err := post(t, http.DefaultClient, url, "request-1", importUsersRequest("1", "2"), replay); err != nil {
+		t.Fatalf("expect replied, got err:%v", err)
+	}
+	if replay.GetStatus().GetCode() != core.StatusCodeIdempotent {
+		t.Fatalf("expect idempotent, got %v", replay.GetStatus())
+	}
+	if replay.GetOperation().GetName() != first.GetOperation().GetName() {
+		t.Fatalf("expect operation %s, got %v", first.GetOperation().GetName(), replay.GetOperation())
+	}
+	other := &OperationResponse{}
+	if err := post(t, http.DefaultClient, url, "request-2", importUsersRequest("3"), other); err != nil {
+		t.Fatalf("expect imported, got err:%v", err)
+	}
+	if other.GetOperation().GetName() == first.GetOperation().GetName() {
+		t.Fatalf("expect a new operation for another request id, got %v", other.GetOperation())
+	}
+	if operation := getOperation(t, server.URL, first.GetOperation().GetName()).GetOperation(); !operation.GetDone() ||
+		operation.GetResponse() == nil {
+		t.Fatalf("expect the operation done with response, got %v", operation)
+	}
+}
+
+func TestImportRetryAfterTimeout(t *testing.T) {
+	mockServer := NewServer(&Config{Faults: []*Fault{
+		{Kind: FaultTimeout, API: common.APIImportUsers, Times: 1, Delay: time.Second},
+	}})
+	server := httptest.NewServer(mockServer)
+	defer server.Close()
+	url := server.URL + testTenantPath + "/users?method=import"
+	timeoutClient := &http.Client{Timeout: 20 * time.Millisecond}
+	if err := post(t, timeoutClient, url, "request-1", importUsersRequest("1"), &OperationResponse{}); err == nil {
+		t.Fatalf("expect the first request timeout")
+	}
+	// The request given up by the client is still handled by the server
+	deadline := time.Now().Add(time.Second)
+	for !mockServer.getOperation("operations/1").GetDone() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the request timeout is handled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	retry := &OperationResponse{}
+	if err := post(t, http.DefaultClient, url, "request-1", importUsersRequest("1"), retry); err != nil {
+		t.Fatalf("expect retried, got err:%v", err)
+	}
+	if retry.GetStatus().GetCode() != core.StatusCodeIdempotent {
+		t.Fatalf("expect idempotent, got %v", retry.GetStatus())
+	}
+	name := retry.GetOperation().GetName()
+	if name == "" {
+		t.Fatalf("expect the operation of the request timeout, got %v", retry)
+	}
+	response := getOperation(t, server.URL, name)
+	if response.GetStatus().GetCode() != core.StatusCodeSuccess || !response.GetOperation().GetDone() {
+		t.Fatalf("expect the operation can be polled, got %v", response)
+	}
+}
+
+func TestOperationNotDoneBeforeDelay(t *testing.T) {
+	server := httptest.NewServer(NewServer(&Config{OperationDelay: time.Hour}))
+	defer server.Close()
+	response := &OperationResponse{}
+	if err := post(t, http.DefaultClient, server.URL+testTenantPath+"/users?method=import", "request-1",
+		importUsersRequest("1"), response); err != nil {
+		t.Fatalf("expect imported, got err:%v", err)
+	}
+	if operation := getOperation(t, server.URL, response.GetOperation().GetName()).GetOperation(); operation.GetDone() {
+		t.Fatalf("expect the operation not done, got %v", operation)
+	}
+	if code := getOperation(t, server.URL, "operations/100").GetStatus().GetCode(); code != core.StatusCodeOperationLoss {
+		t.Fatalf("expect operation loss of unknown operation, got %d", code)
+	}
+}
+
+func TestListOperationsPaging(t *testing.T) {
+	server := httptest.NewServer(NewServer(&Config{}))
+	defer server.Close()
+	for _, requestId := range []string{"request-1", "request-2", "request-3"} {
+		if err := post(t, http.DefaultClient, server.URL+testTenantPath+"/users?method=import", requestId,
+			importUsersRequest("1"), &OperationResponse{}); err != nil {
+			t.Fatalf("expect imported, got err:%v", err)
+		}
+	}
+	url := server.URL + testTenantPath + "/operations?method=list"
+	var names []string
+	pageToken := ""
+	for page := 0; ; page++ {
+		response := &ListOperationsResponse{}
+		if err := post(t, http.DefaultClient, url, "",
+			&ListOperationsRequest{PageSize: 2, PageToken: pageToken}, response); err != nil {
+			t.Fatalf("expect listed, got err:%v", err)
+		}
+		if page == 0 && len(response.GetOperations()) != 2 {
+			t.Fatalf("expect page of 2 operations, got %d", len(response.GetOperations()))
+		}
+		for _, operation := range response.GetOperations() {
+			names = append(names, operation.GetName())
+		}
+		pageToken = response.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+	expect := []string{"operations/1", "operations/2", "operations/3"}
+	if !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expect %v, got %v", expect, names)
+	}
+}
+
+func TestWriteIdempotentAndInvalidRecords(t *testing.T) {
+	mockServer := NewServer(&Config{})
+	server := httptest.NewServer(mockServer)
+	defer server.Close()
+	url := server.URL + testTenantPath + "/users?method=write"
+	request := &retail.WriteUsersRequest{Users: []*retail.User{{UserId: "1"}, {Gender: "male"}}}
+	response := &retail.WriteUsersResponse{}
+	if err := post(t, http.DefaultClient, url, "request-1", request, response); err != nil {
+		t.Fatalf("expect written, got err:%v", err)
+	}
+	if len(response.GetErrors()) != 1 {
+		t.Fatalf("expect the user without user_id is invalid, got %v", response)
+	}
+	response = &retail.WriteUsersResponse{}
+	if err := post(t, http.DefaultClient, url, "request-1", request, response); err != nil {
+		t.Fatalf("expect written, got err:%v", err)
+	}
+	if response.GetStatus().GetCode() != core.StatusCodeIdempotent {
+		t.Fatalf("expect idempotent, got %v", response.GetStatus())
+	}
+	if records := mockServer.Records(VerticalRetail, topicUser); len(records) != 1 {
+		t.Fatalf("expect 1 user saved, got %d", len(records))
+	}
+}
+
+func TestFaultTimes(t *testing.T) {
+	mockServer := NewServer(&Config{})
+	mockServer.InjectFault(&Fault{Kind: FaultTooManyRequest, API: common.APIWriteUsers, Times: 2})
+	server := httptest.NewServer(mockServer)
+	defer server.Close()
+	url := server.URL + testTenantPath + "/users?method=write"
+	expect := []int32{core.StatusCodeTooManyRequest, core.StatusCodeTooManyRequest, core.StatusCodeSuccess}
+	for i, code := range expect {
+		response := &retail.WriteUsersResponse{}
+		request := &retail.WriteUsersRequest{Users: []*retail.User{{UserId: "1"}}}
+		if err := post(t, http.DefaultClient, url, "", request, response); err != nil {
+			t.Fatalf("expect written, got err:%v", err)
+		}
+		if response.GetStatus().GetCode() != code {
+			t.Fatalf("expect code %d of request %d, got %v", code, i, response.GetStatus())
+		}
+	}
+}
+
+func TestParseFaults(t *testing.T) {
+	cases := []struct {
+		spec   string
+		expect []*Fault
+		// invalid means an error is expected
+		invalid bool
+	}{
+		{spec: "", expect: nil},
+		{spec: "WriteUsers:too_many_request:2",
+			expect: []*Fault{{API: "WriteUsers", Kind: FaultTooManyRequest, Times: 2}}},
+		{spec: "*:timeout:1:3s, GetOperation:operation_loss",
+			expect: []*Fault{
+				{API: "*", Kind: FaultTimeout, Times: 1, Delay: 3 * time.Second},
+				{API: "GetOperation", Kind: FaultOperationLoss},
+			}},
+		{spec: "WriteUsers", invalid: true},
+		{spec: "WriteUsers:unknown", invalid: true},
+		{spec: "WriteUsers:server_error:-1", invalid: true},
+		{spec: "WriteUsers:timeout:1:3", invalid: true},
+		{spec: "WriteUsers:timeout:1:3s:1", invalid: true},
+	}
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			faults, err := ParseFaults(c.spec)
+			if c.invalid {
+				if err == nil {
+					t.Fatalf("expect invalid, got %v", faults)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expect %v, got err:%v", c.expect, err)
+			}
+			if !reflect.DeepEqual(faults, c.expect) {
+				t.Fatalf("expect %v, got %v", c.expect, faults)
+			}
+		})
+	}
+}
+
+func TestResolveVertical(t *testing.T) {
+	server := NewServer(&Config{Vertical: VerticalMedia})
+	cases := []struct {
+		path   string
+		expect string
+	}{
+		{path: "data/api/retail/tenant/user", expect: VerticalRetail},
+		{path: "data/api/retail/v2/tenant/user", expect: VerticalRetailV2},
+		{path: "data/api/retail_v2/tenant/user", expect: VerticalRetailV2},
+		{path: "data/api/general/tenant/item", expect: VerticalGeneral},
+		{path: "data/api/tenant/user", expect: VerticalMedia},
+	}
+	for _, c := range cases {
+		if vertical := server.resolveVertical(strings.Split(c.path, "/")); vertical != c.expect {
+			t.Fatalf("expect %s of %s, got %s", c.expect, c.path, vertical)
+		}
+	}
+}
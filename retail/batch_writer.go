@@ -0,0 +1,124 @@
+package main
+
+import (
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/retail"
+	. "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// BatchWriter accepts the data one by one, and writes them
+// in batches by the "WriteXXX" api through RequestHelper
+type BatchWriter struct {
+	client        retail.Client
+	requestHelper *common.RequestHelper
+	users         *common.BatchWriter
+	products      *common.BatchWriter
+	userEvents    *common.BatchWriter
+}
+
+func NewBatchWriter(client retail.Client, requestHelper *common.RequestHelper,
+	config *common.BatchWriterConfig) *BatchWriter {
+	w := &BatchWriter{
+		client:        client,
+		requestHelper: requestHelper,
+	}
+	w.users = common.NewBatchWriter(common.APIWriteUsers, common.MaxWriteItems, config, w.writeUsers)
+	w.products = common.NewBatchWriter(common.APIWriteProducts, common.MaxWriteItems, config, w.writeProducts)
+	w.userEvents = common.NewBatchWriter(common.APIWriteUserEvents, common.MaxWriteItems, config, w.writeUserEvents)
+	return w
+}
+
+// WriteUsers adds the users to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUsers(users ...*User) error {
+	records := make([]interface{}, len(users))
+	for i, record := range users {
+		records[i] = record
+	}
+	return w.users.Write(records...)
+}
+
+func (w *BatchWriter) writeUsers(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		users := make([]*User, len(records))
+		for i, record := range records {
+			users[i] = record.(*User)
+		}
+		return w.client.WriteUsers(&WriteUsersRequest{Users: users}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUsers).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// WriteProducts adds the products to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteProducts(products ...*Product) error {
+	records := make([]interface{}, len(products))
+	for i, record := range products {
+		records[i] = record
+	}
+	return w.products.Write(records...)
+}
+
+func (w *BatchWriter) writeProducts(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		products := make([]*Product, len(records))
+		for i, record := range records {
+			products[i] = record.(*Product)
+		}
+		return w.client.WriteProducts(&WriteProductsRequest{Products: products}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteProducts).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// WriteUserEvents adds the user events to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUserEvents(userEvents ...*UserEvent) error {
+	records := make([]interface{}, len(userEvents))
+	for i, record := range userEvents {
+		records[i] = record
+	}
+	return w.userEvents.Write(records...)
+}
+
+func (w *BatchWriter) writeUserEvents(records []interface{}) error {
+	call := func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		userEvents := make([]*UserEvent, len(records))
+		for i, record := range records {
+			userEvents[i] = record.(*UserEvent)
+		}
+		return w.client.WriteUserEvents(&WriteUserEventsRequest{UserEvents: userEvents}, opts...)
+	}
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUserEvents).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// Flush writes the data in batches immediately
+func (w *BatchWriter) Flush() error {
+	for _, writer := range []*common.BatchWriter{w.users, w.products, w.userEvents} {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the remaining data, and stops accepting new data
+func (w *BatchWriter) Close() error {
+	var firstErr error
+	for _, writer := range []*common.BatchWriter{w.users, w.products, w.userEvents} {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
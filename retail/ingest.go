@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/byteplus-sdk/example-go/common"
+	. "github.com/byteplus-sdk/sdk-go/common/protocol"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/retail"
+	. "github.com/byteplus-sdk/sdk-go/retail/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// ingest imports the data in a CSV, JSONL or Parquet file by "ImportXXX", e.g.
+// "go run . ingest --topic user --file users.jsonl --checkpoint users.checkpoint".
+// The rows are converted as the ingest of retailv2. With the checkpoint, the run
+// restarted after crash skips the batches confirmed, polls the operations of the
+// batches imported but not confirmed again, and continues from where it stopped
+func ingest(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of data, one of user, product and user_event")
+	file := flags.String("file", "", "the path of the data file")
+	format := flags.String("format", "", "csv, jsonl or parquet, decided by the extension of file by default")
+	date := flags.String("date", "", "the date of data in RFC3339, default is now, or the date recorded in the checkpoint")
+	isEnd := flags.Bool("is-end", false, "whether the data of the date is all imported after this run")
+	batchSize := flags.Int("batch-size", common.MaxImportItems, "the count of records imported by one request")
+	concurrency := flags.Int("concurrency", 1, "the count of requests sent at the same time")
+	checkpointPath := flags.String("checkpoint", "", "the path of the checkpoint file, the restarted run continues from where it stopped")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	importTopic := newImportTopic(client, *topic)
+	if importTopic == nil {
+		return fmt.Errorf("unknown topic:%s", *topic)
+	}
+	if *file == "" {
+		return fmt.Errorf("file is required")
+	}
+	reader, err := common.OpenRowReader(*file, *format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	var checkpoint *common.Checkpoint
+	if *checkpointPath != "" {
+		if checkpoint, err = common.OpenCheckpoint(*checkpointPath, *file); err != nil {
+			return err
+		}
+		defer checkpoint.Close()
+	}
+	// The restarted run imports the data with the date of the run before
+	dataDate, err := checkpoint.KeepDate(*date)
+	if err != nil {
+		return err
+	}
+	dateConfig := &DateConfig{Date: dataDate, IsEnd: *isEnd}
+	helper := requestHelper.ForAPI(importTopic.api)
+	summary, err := common.Ingest(reader, &common.IngestConfig{
+		API:          importTopic.api,
+		BatchSize:    *batchSize,
+		MaxBatchSize: common.MaxImportItems,
+		Concurrency:  *concurrency,
+		Checkpoint:   checkpoint,
+		Convert: func(row *common.Row) (interface{}, error) {
+			message := importTopic.newMessage()
+			if err := common.FillMessage(message, row); err != nil {
+				return nil, err
+			}
+			return message, nil
+		},
+		Write: func(batch *common.IngestBatch, onFailure common.ItemFailureHandler) error {
+			return importBatch(helper, importTopic, batch, dateConfig)
+		},
+	})
+	summary.Log(importTopic.api)
+	if err != nil {
+		logs.Error("[Ingest] read %s fail, msg:%s", *file, err.Error())
+	}
+	return err
+}
+
+// importBatch imports the batch, and records the name of operation in the
+// checkpoint before polling it, the operation is polled again if the batch
+// has been imported before restart, instead of being imported again
+func importBatch(helper *common.RequestHelper, importTopic *importTopic,
+	batch *common.IngestBatch, dateConfig *DateConfig) error {
+	ctx := context.Background()
+	name := batch.Progress.Operation
+	if name != "" {
+		logs.Info("[Ingest%s] poll the operation imported before, name:%s", importTopic.api, name)
+	} else {
+		request := importTopic.buildRequest(batch.Records, dateConfig)
+		opts := batch.RequestOpts(defaultOptions(DefaultImportTimeout))
+		var err error
+		name, err = helper.SubmitImportContext(ctx, importTopic.call.WithContext(), request, opts, DefaultRetryTimes)
+		if err != nil {
+			return err
+		}
+		if err := batch.SetOperation(name); err != nil {
+			logs.Warn("[Ingest%s] save operation fail, name:%s msg:%s", importTopic.api, name, err.Error())
+		}
+	}
+	response := importTopic.newResponse()
+	err := helper.PollImportContext(ctx, name, response)
+	if err == nil && !common.IsSuccess(response.GetStatus()) {
+		logs.Error("[Ingest%s] import find failure info, rsp:\n%s", importTopic.api, response)
+		err = &common.ImportFailureError{Status: response.GetStatus()}
+	}
+	// The operation failed, lost or expired is not polled again after restart,
+	// the batch is imported again instead, so it is removed from the checkpoint
+	if errors.Is(err, common.ErrImportFailure) || errors.Is(err, common.ErrOperationLost) ||
+		errors.Is(err, common.ErrPollingTimeout) {
+		if saveErr := batch.SetOperation(""); saveErr != nil {
+			logs.Warn("[Ingest%s] clear operation fail, name:%s msg:%s", importTopic.api, name, saveErr.Error())
+		}
+	}
+	return err
+}
+
+// importTopic tells how to import the records of a topic by "ImportXXX"
+type importTopic struct {
+	api string
+	// newMessage creates an empty record of the topic, such as *User
+	newMessage func() proto.Message
+	// buildRequest builds the request importing the records created by newMessage
+	buildRequest func(records []interface{}, dateConfig *DateConfig) interface{}
+	call         common.Call
+	// newResponse creates an empty response of the import operation
+	newResponse func() importResponse
+}
+
+// importResponse is the response of the import operation, such as *ImportUsersResponse
+type importResponse interface {
+	proto.Message
+	GetStatus() *Status
+}
+
+// newImportTopic returns how to import the records of the topic by client,
+// the topic is one of "user", "product" and "user_event", nil if it is unknown
+func newImportTopic(client retail.Client, topic string) *importTopic {
+	switch topic {
+	case "user":
+		return &importTopic{
+			api:        common.APIImportUsers,
+			newMessage: func() proto.Message { return &User{} },
+			buildRequest: func(records []interface{}, dateConfig *DateConfig) interface{} {
+				users := make([]*User, len(records))
+				for i, record := range records {
+					users[i] = record.(*User)
+				}
+				return &ImportUsersRequest{
+					InputConfig: &UsersInputConfig{
+						Source: &UsersInputConfig_UsersInlineSource{
+							UsersInlineSource: &UsersInlineSource{Users: users},
+						}},
+					DateConfig: dateConfig,
+				}
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportUsers(request.(*ImportUsersRequest), opts...)
+			},
+			newResponse: func() importResponse { return &ImportUsersResponse{} },
+		}
+	case "product":
+		return &importTopic{
+			api:        common.APIImportProducts,
+			newMessage: func() proto.Message { return &Product{} },
+			buildRequest: func(records []interface{}, dateConfig *DateConfig) interface{} {
+				products := make([]*Product, len(records))
+				for i, record := range records {
+					products[i] = record.(*Product)
+				}
+				return &ImportProductsRequest{
+					InputConfig: &ProductsInputConfig{
+						Source: &ProductsInputConfig_ProductsInlineSource{
+							ProductsInlineSource: &ProductsInlineSource{Products: products},
+						}},
+					DateConfig: dateConfig,
+				}
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportProducts(request.(*ImportProductsRequest), opts...)
+			},
+			newResponse: func() importResponse { return &ImportProductsResponse{} },
+		}
+	case "user_event":
+		return &importTopic{
+			api:        common.APIImportUserEvents,
+			newMessage: func() proto.Message { return &UserEvent{} },
+			buildRequest: func(records []interface{}, dateConfig *DateConfig) interface{} {
+				userEvents := make([]*UserEvent, len(records))
+				for i, record := range records {
+					userEvents[i] = record.(*UserEvent)
+				}
+				return &ImportUserEventsRequest{
+					InputConfig: &UserEventsInputConfig{
+						Source: &UserEventsInputConfig_UserEventsInlineSource{
+							UserEventsInlineSource: &UserEventsInlineSource{UserEvents: userEvents},
+						}},
+					DateConfig: dateConfig,
+				}
+			},
+			call: func(request interface{}, opts ...option.Option) (proto.Message, error) {
+				return client.ImportUserEvents(request.(*ImportUserEventsRequest), opts...)
+			},
+			newResponse: func() importResponse { return &ImportUserEventsResponse{} },
+		}
+	}
+	return nil
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
+	"context"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/byteplus-sdk/example-go/common"
 	. "github.com/byteplus-sdk/sdk-go/common/protocol"
-	"github.com/byteplus-sdk/sdk-go/core"
 	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/byteplus-sdk/sdk-go/retail"
@@ -34,25 +34,8 @@ var (
 	requestHelper *common.RequestHelper
 
 	concurrentHelper *ConcurrentHelper
-)
 
-const (
-	// Token
-	// A unique token assigned by bytedance, which is used to
-	// generate an authenticated signature when building a request.
-	// It is sometimes called "secret".
-	Token = "xxxxxxxxxxxxxxxxxxxxx"
-
-	// TenantId
-	// A unique ID assigned by Bytedance, which is used to
-	// generate an authenticated signature when building a request
-	// It is sometimes called "appkey".
-	TenantId = "xxxxxxxxxxxx"
-
-	// Tenant
-	// A unique identity assigned by Bytedance, which is need to fill in URL.
-	// It is sometimes called "company".
-	Tenant = "retail_demo"
+	wal *common.WAL
 )
 
 func init() {
@@ -78,18 +61,49 @@ func init() {
 	//}
 
 	logs.Level = logs.LevelDebug
-	client, _ = (&retail.ClientBuilder{}).
-		Tenant(Tenant).        // Required
-		TenantId(TenantId).    // Required
-		Token(Token).          // Required
-		Region(core.RegionSg). // Required
-		//Schema("https"). // Optional
-		//Headers(map[string]string{"Customer-Header": "Value"}). // Optional
+	// The credentials are loaded from the config file and the environment variables,
+	// e.g. "BYTEPLUS_CONFIG=config.yaml BYTEPLUS_PROFILE=staging go run .", see common.ConfigLoader.
+	// The requests are sent to the local mock server when BYTEPLUS_MOCK_HOST is set,
+	// e.g. run "go run ./mockserver/cmd -vertical retail" in the project directory,
+	// then "BYTEPLUS_MOCK_HOST=127.0.0.1:8080 go run ." in this directory
+	config, err := common.LoadClientConfig(common.VerticalRetail)
+	if err != nil {
+		logs.Error("[Init] load client config fail, msg:%s", err.Error())
+		os.Exit(1)
+	}
+	client, _ = config.RetailClientBuilder().
 		//MetricsConfig(metricsConfig). // Optional
 		//HostAvailablerConfig(hostAvailablerConfig). // Optional
 		Build()
-	requestHelper = &common.RequestHelper{Client: client}
-	concurrentHelper = NewConcurrentHelper(client)
+	// Limit the QPS of each api on client side to avoid exceeding the quota,
+	// the requests sent by requestHelper and concurrentHelper share the limits.
+	// Please adjust them according to the quota of your account
+	rateLimiters := common.NewRateLimiterGroup(map[string]*common.RateLimiterConfig{
+		common.APIWriteUsers:           {QPS: 50},
+		common.APIWriteProducts:        {QPS: 50},
+		common.APIWriteUserEvents:      {QPS: 50},
+		common.APIImportUsers:          {QPS: 1},
+		common.APIImportProducts:       {QPS: 1},
+		common.APIImportUserEvents:     {QPS: 1},
+		common.APIPredict:              {QPS: 100},
+		common.APIAckServerImpressions: {QPS: 100},
+	})
+	requestHelper = &common.RequestHelper{Client: client, RateLimiters: rateLimiters}
+	// The requests which ultimately fail are kept in the dead letter file,
+	// and the requests not complete when the process dies are kept in WAL
+	var pending []*common.DeadLetter
+	wal, pending, err = common.OpenWAL(WALFile)
+	if err != nil {
+		logs.Error("open wal fail, the submitted requests are not kept, msg:%s", err.Error())
+	}
+	concurrentHelper = NewConcurrentHelper(client, requestHelper, &common.ConcurrentHelperConfig{
+		DeadLetterSink: common.NewFileDeadLetterSink(DeadLetterFile),
+		WAL:            wal,
+	})
+	// Submit again the requests not complete before the last exit
+	if len(pending) > 0 {
+		logs.Info("resubmit %d requests in wal, submitted:%d", len(pending), resubmit(pending))
+	}
 }
 
 /**
@@ -101,6 +115,24 @@ func init() {
  * you can change account to yours here: {@link Constant}
  */
 func main() {
+	// Resubmit the requests kept in the dead letter file,
+	// e.g. "go run . replay dead_letters.jsonl"
+	if len(os.Args) == 3 && os.Args[1] == "replay" {
+		replayDeadLetters(os.Args[2])
+		shutdown()
+		return
+	}
+	// Import the data in a CSV, JSONL or Parquet file, which can be resumed by the checkpoint,
+	// e.g. "go run . ingest --topic user --file users.jsonl --checkpoint users.checkpoint"
+	if len(os.Args) > 1 && os.Args[1] == "ingest" {
+		err := ingest(os.Args[2:])
+		shutdown()
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Write real-time user data
 	writeUsersExample()
 	// Write real-time user data concurrently
@@ -123,10 +155,15 @@ func main() {
 	writeUserEventsExample()
 	// Write real-time user event data concurrently
 	concurrentWriteUserEventsExample()
+
+	// Write real-time user data one by one, which are sent in batches
+	batchWriteExample()
 	// Import daily offline user event data
 	importUserEventsExample()
 	// Concurrent import daily offline user event data
 	concurrentImportUserEventsExample()
+	// Import users, products and user events, and track the operations together
+	trackImportOperationsExample()
 
 	// Obtain Operation information according to operationName,
 	// if the corresponding task is executing, the real-time
@@ -144,12 +181,23 @@ func main() {
 	// Get recommendation results
 	recommendExample()
 
-	// Pause for 5 seconds until the asynchronous import task completes
-	time.Sleep(5 * time.Second)
-	client.Release()
+	shutdown()
 	os.Exit(0)
 }
 
+func shutdown() {
+	// Wait at most 5 seconds until the asynchronous tasks complete,
+	// the client can't be released before that
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	abandoned, err := concurrentHelper.Shutdown(ctx)
+	cancel()
+	if err != nil {
+		logs.Warn("asynchronous tasks not complete, abandoned:%d", len(abandoned))
+	}
+	_ = wal.Close()
+	client.Release()
+}
+
 func writeUsersExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUsersRequest(1)
@@ -157,7 +205,7 @@ func writeUsersExample() {
 	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.WriteUsers(request.(*WriteUsersRequest), opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, request, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIWriteUsers).DoWithRetry(call, request, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("write user occur err, msg:%s", err.Error())
 		return
@@ -175,7 +223,7 @@ func concurrentWriteUsersExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUsersRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteUsersRequest(count int) *WriteUsersRequest {
@@ -194,7 +242,7 @@ func importUsersExample() {
 		return client.ImportUsers(request.(*ImportUsersRequest), opts...)
 	}
 	response := &ImportUsersResponse{}
-	err := requestHelper.DoImport(call, request, response, opts, DefaultRetryTimes)
+	err := requestHelper.ForAPI(common.APIImportUsers).DoImport(call, request, response, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("import user occur err, msg:%s", err.Error())
 		return
@@ -211,7 +259,7 @@ func concurrentImportUsersExample() {
 	// The "ImportXXX" api can transfer max to 10k items at one request
 	request := buildImportUsersRequest(10)
 	opts := defaultOptions(DefaultImportTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildImportUsersRequest(count int) *ImportUsersRequest {
@@ -241,7 +289,7 @@ func writeProductsExample() {
 	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.WriteProducts(request.(*WriteProductsRequest), opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, request, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIWriteProducts).DoWithRetry(call, request, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("write product occur err, msg:%s", err.Error())
 		return
@@ -259,7 +307,7 @@ func concurrentWriteProductsExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteProductsRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteProductsRequest(count int) *WriteProductsRequest {
@@ -278,7 +326,7 @@ func importProductsExample() {
 		return client.ImportProducts(request.(*ImportProductsRequest), opts...)
 	}
 	response := &ImportProductsResponse{}
-	err := requestHelper.DoImport(call, request, response, opts, DefaultRetryTimes)
+	err := requestHelper.ForAPI(common.APIImportProducts).DoImport(call, request, response, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("import product occur err, msg:%s", err.Error())
 		return
@@ -295,7 +343,7 @@ func concurrentImportProductsExample() {
 	// The "ImportXXX" api can transfer max to 10k items at one request
 	request := buildImportProductsRequest(10)
 	opts := defaultOptions(DefaultImportTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildImportProductsRequest(count int) *ImportProductsRequest {
@@ -325,7 +373,7 @@ func writeUserEventsExample() {
 	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
 		return client.WriteUserEvents(request.(*WriteUserEventsRequest), opts...)
 	}
-	responseItr, err := requestHelper.DoWithRetry(call, request, opts, DefaultRetryTimes)
+	responseItr, err := requestHelper.ForAPI(common.APIWriteUserEvents).DoWithRetry(call, request, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("write user event occur err, msg:%s", err.Error())
 		return
@@ -343,7 +391,7 @@ func concurrentWriteUserEventsExample() {
 	// The "WriteXXX" api can transfer max to 2000 items at one request
 	request := buildWriteUserEventsRequest(1)
 	opts := defaultOptions(DefaultWriteTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildWriteUserEventsRequest(count int) *WriteUserEventsRequest {
@@ -362,7 +410,7 @@ func importUserEventsExample() {
 		return client.ImportUserEvents(request.(*ImportUserEventsRequest), opts...)
 	}
 	response := &ImportUserEventsResponse{}
-	err := requestHelper.DoImport(call, request, response, opts, DefaultRetryTimes)
+	err := requestHelper.ForAPI(common.APIImportUserEvents).DoImport(call, request, response, opts, DefaultRetryTimes)
 	if err != nil {
 		logs.Error("import user event occur err, msg:%s", err.Error())
 		return
@@ -379,7 +427,7 @@ func concurrentImportUserEventsExample() {
 	// The "ImportXXX" api can transfer max to 10k items at one request
 	request := buildImportUserEventsRequest(10)
 	opts := defaultOptions(DefaultImportTimeout)
-	_ = concurrentHelper.SubmitRequest(request, opts...)
+	_, _ = concurrentHelper.SubmitRequest(request, opts...)
 }
 
 func buildImportUserEventsRequest(count int) *ImportUserEventsRequest {
@@ -402,12 +450,65 @@ func buildImportUserEventsRequest(count int) *ImportUserEventsRequest {
 	}
 }
 
+func trackImportOperationsExample() {
+	// The operations are polled in shared batches by one goroutine,
+	// instead of polling each of them in its own goroutine by DoImport
+	tracker := common.NewOperationTracker(requestHelper, nil)
+	imports := []struct {
+		api         string
+		call        common.Call
+		request     interface{}
+		newResponse func() proto.Message
+	}{
+		{common.APIImportUsers, func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return client.ImportUsers(request.(*ImportUsersRequest), opts...)
+		}, buildImportUsersRequest(10), func() proto.Message { return &ImportUsersResponse{} }},
+		{common.APIImportProducts, func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return client.ImportProducts(request.(*ImportProductsRequest), opts...)
+		}, buildImportProductsRequest(10), func() proto.Message { return &ImportProductsResponse{} }},
+		{common.APIImportUserEvents, func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return client.ImportUserEvents(request.(*ImportUserEventsRequest), opts...)
+		}, buildImportUserEventsRequest(10), func() proto.Message { return &ImportUserEventsResponse{} }},
+	}
+	for _, imp := range imports {
+		opts := defaultOptions(DefaultImportTimeout)
+		name, err := requestHelper.ForAPI(imp.api).SubmitImportContext(context.Background(),
+			imp.call.WithContext(), imp.request, opts, DefaultRetryTimes)
+		if err != nil {
+			logs.Error("[TrackImport] %s occur err, msg:%s", imp.api, err.Error())
+			continue
+		}
+		_ = tracker.Track(name, imp.newResponse)
+	}
+	go tracker.Close()
+	// The channel is closed after all the operations end
+	for event := range tracker.Events() {
+		switch event.Type {
+		case common.OperationDone:
+			logs.Info("[TrackImport] operation done, name:%s rsp:\n%s", event.Name, event.Response)
+		default:
+			// Send the name of the lost operation to bytedance to confirm whether
+			// the data has been imported, and get the result of the timeout operation later
+			logs.Error("[TrackImport] operation %s, name:%s msg:%s", event.Type, event.Name, event.Err)
+		}
+	}
+}
+
 func getOperationExample() {
 	common.GetOperationExample(client, "750eca88-5165-4aae-851f-a93b75a27b03")
 }
 
 func listOperationsExample() {
-	filter := "date>=2021-06-15 and worksOn=ImportUsers and done=true"
+	// The filter is "date>=2021-06-15 and worksOn=ImportUsers and done=true"
+	filter, err := common.AllOf(
+		common.DateSince(time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)),
+		common.WorksOn(common.WorksOnImportUsers),
+		common.Done(true),
+	).Build()
+	if err != nil {
+		logs.Error("build filter occur err, msg:%s", err.Error())
+		return
+	}
 	operations := common.ListOperationsExample(client, filter)
 	if operations == nil {
 		return
@@ -459,6 +560,8 @@ func recommendExample() {
 	predictRequest := buildPredictRequest()
 	predictOpts := defaultOptions(DefaultPredictTimeout)
 	// The "home" is scene name, which provided by ByteDance, usually is "home"
+	// Wait for the quota of predict, it never fails without deadline
+	_ = requestHelper.RateLimiters.Wait(context.Background(), common.APIPredict)
 	response, err := client.Predict(predictRequest, "home", predictOpts...)
 	if err != nil {
 		logs.Error("predict occur error, msg:%s", err.Error())
@@ -474,7 +577,7 @@ func recommendExample() {
 	alteredProducts := doSomethingWithPredictResult(response.GetValue())
 	ackRequest := buildAckRequest(response.GetRequestId(), predictRequest, alteredProducts)
 	ackOpts := defaultOptions(DefaultAckImpressionsTimeout)
-	_ = concurrentHelper.SubmitRequest(ackRequest, ackOpts...)
+	_, _ = concurrentHelper.SubmitRequest(ackRequest, ackOpts...)
 }
 
 func buildPredictRequest() *PredictRequest {
@@ -535,6 +638,27 @@ func buildAckRequest(predictRequestId string, predictRequest *PredictRequest,
 	}
 }
 
+func batchWriteExample() {
+	// The users written one by one are sent in batches of at most 2000 items,
+	// and the batch not full is sent after waiting 1 second
+	batchWriter := NewBatchWriter(client, requestHelper, &common.BatchWriterConfig{
+		BatchSize: common.MaxWriteItems,
+		Linger:    time.Second,
+	})
+	for _, user := range mockUsers(10) {
+		if err := batchWriter.WriteUsers(user); err != nil {
+			logs.Error("batch write user occur err, msg:%s", err.Error())
+			return
+		}
+	}
+	// Write the remaining data before exit
+	if err := batchWriter.Close(); err != nil {
+		logs.Error("batch write user occur err, msg:%s", err.Error())
+		return
+	}
+	logs.Info("batch write user success")
+}
+
 func defaultOptions(timeout time.Duration) []option.Option {
 	// All options are optional
 	//var customerHeaders map[string]string
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/option"
+	"github.com/byteplus-sdk/sdk-go/retailv2"
+	. "github.com/byteplus-sdk/sdk-go/retailv2/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// BatchWriter accepts the data one by one, and writes them
+// in batches by the "WriteXXX" api through RequestHelper
+type BatchWriter struct {
+	client        retailv2.Client
+	requestHelper *common.RequestHelper
+	users         *common.BatchWriter
+	products      *common.BatchWriter
+	userEvents    *common.BatchWriter
+}
+
+func NewBatchWriter(client retailv2.Client, requestHelper *common.RequestHelper,
+	config *common.BatchWriterConfig) *BatchWriter {
+	w := &BatchWriter{
+		client:        client,
+		requestHelper: requestHelper,
+	}
+	w.users = common.NewBatchWriter(common.APIWriteUsers, common.MaxWriteItems, config, w.writeUsers)
+	w.products = common.NewBatchWriter(common.APIWriteProducts, common.MaxWriteItems, config, w.writeProducts)
+	w.userEvents = common.NewBatchWriter(common.APIWriteUserEvents, common.MaxWriteItems, config, w.writeUserEvents)
+	return w
+}
+
+// newWriteUsersCall returns the WriteCall sending the records of *User by WriteUsers
+func newWriteUsersCall(client retailv2.Client) common.WriteCall {
+	return func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		users := make([]*User, len(records))
+		for i, record := range records {
+			users[i] = record.(*User)
+		}
+		return client.WriteUsers(&WriteUsersRequest{Users: users}, opts...)
+	}
+}
+
+// WriteUsers adds the users to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUsers(users ...*User) error {
+	records := make([]interface{}, len(users))
+	for i, record := range users {
+		records[i] = record
+	}
+	return w.users.Write(records...)
+}
+
+func (w *BatchWriter) writeUsers(records []interface{}) error {
+	call := newWriteUsersCall(w.client)
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUsers).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// newWriteProductsCall returns the WriteCall sending the records of *Product by WriteProducts
+func newWriteProductsCall(client retailv2.Client) common.WriteCall {
+	return func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		products := make([]*Product, len(records))
+		for i, record := range records {
+			products[i] = record.(*Product)
+		}
+		return client.WriteProducts(&WriteProductsRequest{Products: products}, opts...)
+	}
+}
+
+// WriteProducts adds the products to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteProducts(products ...*Product) error {
+	records := make([]interface{}, len(products))
+	for i, record := range products {
+		records[i] = record
+	}
+	return w.products.Write(records...)
+}
+
+func (w *BatchWriter) writeProducts(records []interface{}) error {
+	call := newWriteProductsCall(w.client)
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteProducts).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// newWriteUserEventsCall returns the WriteCall sending the records of *UserEvent by WriteUserEvents
+func newWriteUserEventsCall(client retailv2.Client) common.WriteCall {
+	return func(records []interface{}, opts ...option.Option) (proto.Message, error) {
+		userEvents := make([]*UserEvent, len(records))
+		for i, record := range records {
+			userEvents[i] = record.(*UserEvent)
+		}
+		return client.WriteUserEvents(&WriteUserEventsRequest{UserEvents: userEvents}, opts...)
+	}
+}
+
+// WriteUserEvents adds the user events to the batch, and writes the batch if it is full
+func (w *BatchWriter) WriteUserEvents(userEvents ...*UserEvent) error {
+	records := make([]interface{}, len(userEvents))
+	for i, record := range userEvents {
+		records[i] = record
+	}
+	return w.userEvents.Write(records...)
+}
+
+func (w *BatchWriter) writeUserEvents(records []interface{}) error {
+	call := newWriteUserEventsCall(w.client)
+	opts := defaultOptions(DefaultWriteTimeout)
+	// The records failing for server side reason are resubmitted,
+	// and the ones failing permanently are logged
+	return w.requestHelper.ForAPI(common.APIWriteUserEvents).
+		DoWriteWithResubmit(call, records, opts, DefaultRetryTimes, nil)
+}
+
+// Flush writes the data in batches immediately
+func (w *BatchWriter) Flush() error {
+	for _, writer := range []*common.BatchWriter{w.users, w.products, w.userEvents} {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the remaining data, and stops accepting new data
+func (w *BatchWriter) Close() error {
+	var firstErr error
+	for _, writer := range []*common.BatchWriter{w.users, w.products, w.userEvents} {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -1,133 +1,70 @@
 package main
 
 import (
+	"context"
 	"errors"
 
 	"github.com/byteplus-sdk/example-go/common"
-	"github.com/byteplus-sdk/sdk-go/core"
-	"github.com/byteplus-sdk/sdk-go/core/logs"
 	"github.com/byteplus-sdk/sdk-go/core/option"
 	"github.com/byteplus-sdk/sdk-go/retailv2"
 	. "github.com/byteplus-sdk/sdk-go/retailv2/protocol"
 	"google.golang.org/protobuf/proto"
 )
 
-const (
-	consumerCount = 5
-	retryTimes    = 2
-)
-
-func NewConcurrentHelper(client retailv2.Client) *ConcurrentHelper {
-	taskChan := make(chan runner)
-	for i := 0; i < consumerCount; i++ {
-		core.AsyncExecute(func() {
-			for {
-				task := <-taskChan
-				task()
-			}
-		})
-	}
+// NewConcurrentHelper creates the ConcurrentHelper sending requests by
+// requestHelper, the fields not set in config use the defaults of
+// common.NewConcurrentHelper
+func NewConcurrentHelper(client retailv2.Client, requestHelper *common.RequestHelper,
+	config *common.ConcurrentHelperConfig) *ConcurrentHelper {
 	return &ConcurrentHelper{
-		client:        client,
-		requestHelper: &common.RequestHelper{Client: client},
-		taskChan:      taskChan,
+		client: client,
+		helper: common.NewConcurrentHelper(requestHelper, config),
 	}
 }
 
-type runner func()
-
 type ConcurrentHelper struct {
-	client        retailv2.Client
-	requestHelper *common.RequestHelper
-	taskChan      chan runner
+	client retailv2.Client
+	helper *common.ConcurrentHelper
 }
 
-func (h *ConcurrentHelper) SubmitRequest(request interface{}, opts ...option.Option) error {
-	switch realRequest := request.(type) {
+// SubmitRequest submits the request to be sent asynchronously,
+// the returned Future can be waited for the response of server
+func (h *ConcurrentHelper) SubmitRequest(request interface{}, opts ...option.Option) (*common.Future, error) {
+	submission := &common.Submission{Request: request, Opts: opts}
+	switch request.(type) {
 	case *WriteUsersRequest:
-		h.submitWriteUsersRequest(realRequest, opts...)
-	case *WriteProductsRequest:
-		h.submitWriteProductsRequest(realRequest, opts...)
-	case *WriteUserEventsRequest:
-		h.submitWriteUserEventsRequest(realRequest, opts...)
-	case *AckServerImpressionsRequest:
-		h.submitAckRequest(realRequest, opts...)
-	}
-	return errors.New("can't support this request type")
-}
-
-func (h *ConcurrentHelper) submitWriteUsersRequest(request *WriteUsersRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteUsers(request.(*WriteUsersRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteUsers] occur error, msg:%s", err.Error())
-			return
+		submission.API = common.APIWriteUsers
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteUsers(request.(*WriteUsersRequest), opts...)
 		}
-		if common.IsSuccess(response.(*WriteUsersResponse).GetStatus()) {
-			logs.Info("[AsyncWriteUsers] success")
-			return
+	case *WriteProductsRequest:
+		submission.API = common.APIWriteProducts
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteProducts(request.(*WriteProductsRequest), opts...)
 		}
-		logs.Error("[AsyncWriteUsers] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
-}
-
-func (h *ConcurrentHelper) submitWriteProductsRequest(request *WriteProductsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteProducts(request.(*WriteProductsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteProducts] occur error, msg:%s", err.Error())
-			return
+	case *WriteUserEventsRequest:
+		submission.API = common.APIWriteUserEvents
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.WriteUserEvents(request.(*WriteUserEventsRequest), opts...)
 		}
-		if common.IsSuccess(response.(*WriteProductsResponse).GetStatus()) {
-			logs.Info("[AsyncWriteProducts] success")
-			return
+	case *AckServerImpressionsRequest:
+		submission.API = common.APIAckServerImpressions
+		submission.Call = func(request interface{}, opts ...option.Option) (proto.Message, error) {
+			return h.client.AckServerImpressions(request.(*AckServerImpressionsRequest), opts...)
 		}
-		logs.Error("[AsyncWriteProducts] fail, rsp:\n%s", response)
+	default:
+		return nil, errors.New("can't support this request type")
 	}
-	h.taskChan <- task
+	return h.helper.Submit(submission)
 }
 
-func (h *ConcurrentHelper) submitWriteUserEventsRequest(request *WriteUserEventsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.WriteUserEvents(request.(*WriteUserEventsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncWriteUserEvents] occur error, msg:%s", err.Error())
-			return
-		}
-		if common.IsSuccess(response.(*WriteUserEventsResponse).GetStatus()) {
-			logs.Info("[AsyncWriteUserEvents] success")
-			return
-		}
-		logs.Error("[AsyncWriteUserEvents] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
+// QueueDepth returns the count of submitted requests waiting for a free consumer
+func (h *ConcurrentHelper) QueueDepth() int {
+	return h.helper.QueueDepth()
 }
 
-func (h *ConcurrentHelper) submitAckRequest(request *AckServerImpressionsRequest, opts ...option.Option) {
-	call := func(request interface{}, opts ...option.Option) (proto.Message, error) {
-		return h.client.AckServerImpressions(request.(*AckServerImpressionsRequest), opts...)
-	}
-	task := func() {
-		response, err := h.requestHelper.DoWithRetry(call, request, opts, retryTimes)
-		if err != nil {
-			logs.Error("[AsyncAckImpressions] occur error, msg:%s", err.Error())
-			return
-		}
-		if common.IsSuccess(response.(*AckServerImpressionsResponse).GetStatus()) {
-			logs.Info("[AsyncAckImpressions] success")
-			return
-		}
-		logs.Error("[AsyncAckImpressions] fail, rsp:\n%s", response)
-	}
-	h.taskChan <- task
+// Shutdown stops accepting new requests, and waits until the submitted
+// requests complete or ctx is done, the abandoned requests are returned
+func (h *ConcurrentHelper) Shutdown(ctx context.Context) ([]*common.Future, error) {
+	return h.helper.Shutdown(ctx)
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/byteplus-sdk/example-go/common"
+	"github.com/byteplus-sdk/sdk-go/core/logs"
+	. "github.com/byteplus-sdk/sdk-go/retailv2/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// ingestTopic tells how to ingest the data of a topic
+type ingestTopic struct {
+	api        string
+	newMessage func() proto.Message
+	call       common.WriteCall
+}
+
+func newIngestTopic(topic string) *ingestTopic {
+	switch topic {
+	case TopicUser:
+		return &ingestTopic{
+			api:        common.APIWriteUsers,
+			newMessage: func() proto.Message { return &User{} },
+			call:       newWriteUsersCall(client),
+		}
+	case TopicProduct:
+		return &ingestTopic{
+			api:        common.APIWriteProducts,
+			newMessage: func() proto.Message { return &Product{} },
+			call:       newWriteProductsCall(client),
+		}
+	case TopicUserEvent:
+		return &ingestTopic{
+			api:        common.APIWriteUserEvents,
+			newMessage: func() proto.Message { return &UserEvent{} },
+			call:       newWriteUserEventsCall(client),
+		}
+	}
+	return nil
+}
+
+// ingest writes the data in a CSV, JSONL or Parquet file, e.g.
+// "go run . ingest --topic product --file products.jsonl".
+// Each line of JSONL is a message in JSON, such as {"product_id":"1","price":{"current_price":1.5}},
+// and the columns of CSV and Parquet are the paths of fields, such as "product_id", "price.current_price",
+// "categories.0.category_nodes.0.id_or_name", "seller.id", "device.platform" and "extra.color",
+// the values of repeated fields, such as "tags", are separated by ",".
+// The columns of a flat table exported from warehouse can be mapped to the fields
+// by a spec in YAML or JSON, e.g. "--mapping product_mapping.yaml", see common.MappingSpec
+func ingest(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	topic := flags.String("topic", "", "the topic of data, one of user, product and user_event")
+	file := flags.String("file", "", "the path of the data file")
+	format := flags.String("format", "", "csv, jsonl or parquet, decided by the extension of file by default")
+	batchSize := flags.Int("batch-size", common.MaxWriteItems, "the count of records written by one request")
+	concurrency := flags.Int("concurrency", 1, "the count of requests sent at the same time")
+	checkpointPath := flags.String("checkpoint", "", "the path of the checkpoint file, the restarted run continues from where it stopped")
+	mapping := flags.String("mapping", "", "the path of the column mapping spec in YAML or JSON, optional")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ingestTopic := newIngestTopic(*topic)
+	if ingestTopic == nil {
+		return fmt.Errorf("unknown topic:%s", *topic)
+	}
+	if *file == "" {
+		return fmt.Errorf("file is required")
+	}
+	fill := common.FillMessage
+	if *mapping != "" {
+		spec, err := common.LoadMappingSpec(*mapping)
+		if err != nil {
+			return err
+		}
+		if err = spec.Validate(ingestTopic.newMessage()); err != nil {
+			return fmt.Errorf("invalid mapping spec %s, %s", *mapping, err.Error())
+		}
+		fill = func(message proto.Message, row *common.Row) error {
+			return spec.Apply(row, message)
+		}
+	}
+	reader, err := common.OpenRowReader(*file, *format)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	var checkpoint *common.Checkpoint
+	if *checkpointPath != "" {
+		if checkpoint, err = common.OpenCheckpoint(*checkpointPath, *file); err != nil {
+			return err
+		}
+		defer checkpoint.Close()
+	}
+	helper := requestHelper.ForAPI(ingestTopic.api)
+	summary, err := common.Ingest(reader, &common.IngestConfig{
+		API:         ingestTopic.api,
+		BatchSize:   *batchSize,
+		Concurrency: *concurrency,
+		Checkpoint:  checkpoint,
+		Convert: func(row *common.Row) (interface{}, error) {
+			message := ingestTopic.newMessage()
+			if err := fill(message, row); err != nil {
+				return nil, err
+			}
+			return message, nil
+		},
+		Write: func(batch *common.IngestBatch, onFailure common.ItemFailureHandler) error {
+			// The records failing for server side reason are resubmitted,
+			// and the ones failing permanently are reported in the summary
+			return helper.DoWriteWithResubmit(ingestTopic.call, batch.Records,
+				batch.RequestOpts(defaultOptions(DefaultWriteTimeout)), DefaultRetryTimes, onFailure)
+		},
+	})
+	summary.Log(ingestTopic.api)
+	if err != nil {
+		logs.Error("[Ingest] read %s fail, msg:%s", *file, err.Error())
+	}
+	return err
+}